@@ -0,0 +1,44 @@
+package serialized_snapshot_isolation
+
+import (
+	"context"
+	"errors"
+	"serialized-snapshot-isolation/mvcc"
+	"serialized-snapshot-isolation/txn"
+)
+
+var InvalidHistoryPageSizeErr = errors.New("page size of the history must be greater than zero")
+
+// HistoryPage is a page of the versions of a key, returned by KeyValueDb.History.
+// Versions are in the increasing order of their commitTimestamps. If HasMore is true, the next page starts at
+// NextFromTimestamp, which should be passed as the fromTimestamp of the next invocation of KeyValueDb.History.
+type HistoryPage struct {
+	Versions          []mvcc.KeyVersion
+	HasMore           bool
+	NextFromTimestamp uint64
+}
+
+// History returns a page of the versions of the key with fromTimestamp <= commitTimestamp <= toTimestamp, each with its
+// commitTimestamp, value and whether it is a tombstone. A page holds at most pageSize versions.
+// History reads in a txn.ReadonlyTransaction, so it only returns the versions visible to a new transaction, and the versions
+// removed by the version collection are not a part of the history.
+func (db *KeyValueDb) History(key []byte, fromTimestamp, toTimestamp uint64, pageSize int) (HistoryPage, error) {
+	if pageSize <= 0 {
+		return HistoryPage{}, InvalidHistoryPageSizeErr
+	}
+	var page HistoryPage
+	err := db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		versions, err := transaction.Versions(key, fromTimestamp, toTimestamp, pageSize+1)
+		if err != nil {
+			return err
+		}
+		if len(versions) > pageSize {
+			page.HasMore = true
+			page.NextFromTimestamp = versions[pageSize].CommitTimestamp()
+			versions = versions[:pageSize]
+		}
+		page.Versions = versions
+		return nil
+	})
+	return page, err
+}
@@ -0,0 +1,79 @@
+package serialized_snapshot_isolation
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"serialized-snapshot-isolation/txn"
+	"strconv"
+	"testing"
+)
+
+func TestGetsTheHistoryOfAKeyInPages(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	for count := 1; count <= 5; count++ {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk-"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.Delete([]byte("HDD"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	page, err := db.History([]byte("HDD"), 0, 10, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, true, page.HasMore)
+	assert.Equal(t, 4, len(page.Versions))
+	for index, version := range page.Versions {
+		assert.Equal(t, uint64(index+1), version.CommitTimestamp())
+		assert.Equal(t, []byte("Hard disk-"+strconv.Itoa(index+1)), version.Value().Slice())
+		assert.Equal(t, false, version.IsTombstone())
+	}
+
+	page, err = db.History([]byte("HDD"), page.NextFromTimestamp, 10, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, false, page.HasMore)
+	assert.Equal(t, 2, len(page.Versions))
+	assert.Equal(t, uint64(5), page.Versions[0].CommitTimestamp())
+	assert.Equal(t, uint64(6), page.Versions[1].CommitTimestamp())
+	assert.Equal(t, true, page.Versions[1].IsTombstone())
+}
+
+func TestGetsTheHistoryOfAKeyInATimestampRange(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	for count := 1; count <= 5; count++ {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk-"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+
+	page, err := db.History([]byte("HDD"), 2, 3, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, false, page.HasMore)
+	assert.Equal(t, 2, len(page.Versions))
+	assert.Equal(t, uint64(2), page.Versions[0].CommitTimestamp())
+	assert.Equal(t, uint64(3), page.Versions[1].CommitTimestamp())
+}
+
+func TestAttemptsToGetTheHistoryOfAKeyWithAnInvalidPageSize(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	_, err := db.History([]byte("HDD"), 0, 10, 0)
+	assert.ErrorIs(t, err, InvalidHistoryPageSizeErr)
+}
@@ -1,13 +1,20 @@
 package serialized_snapshot_isolation
 
 import (
+	"context"
 	"errors"
+	"serialized-snapshot-isolation/checkpoint"
 	"serialized-snapshot-isolation/mvcc"
 	"serialized-snapshot-isolation/txn"
+	txnErrors "serialized-snapshot-isolation/txn/errors"
+	"serialized-snapshot-isolation/wal"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var DbAlreadyStoppedErr = errors.New("Db is stopped, can not perform the operation")
+var ConflictCounterDisabledErr = errors.New("conflicts are not counted per key, enable Options.CountConflictsPerKey")
 
 // KeyValueDb represents an in-memory store backed by multi-versioned SkipList.
 // It provides two behaviors: Get and PutOrUpdate which run in a transaction.
@@ -21,55 +28,434 @@ var DbAlreadyStoppedErr = errors.New("Db is stopped, can not perform the operati
 // multiple versions of each key in a SkipList. (Please refer to mvcc/ package).
 // Each transaction gets a beginTimestamp when it starts and a commitTimestamp when it is ready to commit.
 // These timestamps are provided by a central authority Oracle. Please refer to txn.Oracle.
-// This implementation uses monotonically increasing numbers as timestamps.
+// This implementation uses monotonically increasing numbers as timestamps, generated by a txn.TimestampSource.
 // Serialized snapshot isolation prevents RW conflicts which means a transaction Txn will commit successfully, if its read keys
 // are not written by another concurrent transaction with a commitTimestamp higher than the beginTimestamp of Txn.
 // If a transaction does not have any RW conflict, it gets a commitTimestamp which is used as a version in the keys that
 // get written to the SkipList.
+//
+// Every commit adds a new version of the keys it writes. The versions that can not be read by any active or future
+// transaction are removed in the background by txn.VersionCollector.
+//
+// Every operation (and every open manually managed Transaction) is registered in `operations`, so that Close can wait for
+// them. `operationLock` ensures that no operation is registered once the KeyValueDb is marked stopped.
+//
+// The read-write transactions run with the `isolationLevel` of the KeyValueDb (txn.SerializableSnapshotIsolation, unless
+// Options.IsolationLevel says otherwise), and PutOrUpdateWithIsolation runs a single transaction with a different txn.IsolationLevel.
 type KeyValueDb struct {
-	stopped atomic.Bool
-	oracle  *txn.Oracle
+	stopped          atomic.Bool
+	operationLock    sync.Mutex
+	operations       sync.WaitGroup
+	oracle           *txn.Oracle
+	versionCollector *txn.VersionCollector
+	isolationLevel   txn.IsolationLevel
 }
 
 // NewKeyValueDb creates a new instance of KeyValueDb.
 func NewKeyValueDb(skiplistMaxLevel uint8) *KeyValueDb {
+	return newKeyValueDb(
+		txn.NewOracle(txn.NewTransactionExecutor(mvcc.NewMemTable(skiplistMaxLevel)), txn.NewCounterTimestampSource()),
+		defaultVersionCollectionInterval,
+	)
+}
+
+// newKeyValueDb creates a new instance of KeyValueDb with the oracle, and starts the version collection.
+func newKeyValueDb(oracle *txn.Oracle, versionCollectionInterval time.Duration) *KeyValueDb {
 	return &KeyValueDb{
-		oracle: txn.NewOracle(
-			txn.NewTransactionExecutor(mvcc.NewMemTable(skiplistMaxLevel)),
-		),
+		oracle:           oracle,
+		versionCollector: txn.NewVersionCollector(oracle, versionCollectionInterval),
 	}
 }
 
+// Open opens a durable KeyValueDb in the directory.
+// Every commit is written to a write-ahead log (wal.WAL) in the directory before it is applied, and the doneChannel
+// returned from PutOrUpdate receives nil only after the commit is durable according to the wal.SyncPolicy in Options.
+// If the commit can not be written to the WAL (for example, the disk is full), the doneChannel receives a
+// txnErrors.ExecutorFailedError instead, and all the following commits fail with it; the KeyValueDb needs to be reopened.
+// Once the active mvcc.MemTable grows beyond Options.MemTableSizeLimit, it is flushed to an SSTable in the directory. (More on this in mvcc.Storage).
+// Open restores the state in an mvcc.Storage:
+// 1. The SSTables in the directory (if any) are loaded. Otherwise, the newest checkpoint in the directory (if any) is loaded
+// in the active mvcc.MemTable. (More on this in Checkpoint).
+// The SSTables, along with the WAL, hold all the commits, so a checkpoint is only needed when there is no SSTable.
+// Also, a checkpoint does not hold the deleted keys, so layering it over the SSTables could bring back the deleted keys.
+// 2. All the records of the WAL with a commitTimestamp greater than the last commitTimestamp of the SSTables (or the timestamp
+// of the checkpoint) are applied.
+// The txn.Oracle resumes from the last restored commitTimestamp: nextTimestamp and both the timestamp marks start from it,
+// and the next commitTimestamp is generated by Options.TimestampSource from it.
+func Open(directory string, options Options) (*KeyValueDb, error) {
+	storage, err := mvcc.OpenStorage(directory, options.SkiplistMaxLevel, options.MemTableSizeLimit)
+	if err != nil {
+		return nil, err
+	}
+	lastCommitTimestamp, err := restore(directory, storage)
+	if err != nil {
+		_ = storage.Close()
+		return nil, err
+	}
+	log, err := wal.Open(directory, options.SyncPolicy)
+	if err != nil {
+		_ = storage.Close()
+		return nil, err
+	}
+	timestampSource := options.TimestampSource
+	if timestampSource == nil {
+		timestampSource = txn.NewCounterTimestampSource()
+	}
+	oracle := txn.NewOracleResumingFrom(
+		txn.NewParallelTransactionExecutor(storage, log, options.ApplyWorkers),
+		timestampSource,
+		lastCommitTimestamp,
+	)
+	if options.CountConflictsPerKey {
+		oracle.EnableConflictCounter()
+	}
+	oracle.SetMaxWaitForCommits(options.MaxWaitForCommits)
+	db := newKeyValueDb(oracle, options.VersionCollectionInterval)
+	db.isolationLevel = options.IsolationLevel
+	return db, nil
+}
+
 // Get takes a callback which receives a pointer to a txn.ReadonlyTransaction.
 // txn.ReadonlyTransaction provides Get method to look up the value for the key.
-func (db *KeyValueDb) Get(callback func(transaction *txn.ReadonlyTransaction)) error {
-	if db.stopped.Load() {
-		return DbAlreadyStoppedErr
+// The error returned by the callback is returned to the caller.
+// If the context is done before the transaction begins, Get returns the error of the context without invoking the callback.
+func (db *KeyValueDb) Get(ctx context.Context, callback func(transaction *txn.ReadonlyTransaction) error) error {
+	if err := db.beginOperation(); err != nil {
+		return err
+	}
+	defer db.endOperation()
+
+	transaction, err := txn.NewReadonlyTransaction(ctx, db.oracle)
+	if err != nil {
+		return err
 	}
-	transaction := txn.NewReadonlyTransaction(db.oracle)
 	defer transaction.FinishBeginTimestampForReadonlyTransaction()
 
-	callback(transaction)
-	return nil
+	return callback(transaction)
+}
+
+// GetAt takes a callback which receives a pointer to a txn.ReadonlyTransaction that is pinned to the timestamp, instead of
+// the latest beginTimestamp. The transaction reads the keys where commitTimestampOf(Key) < timestamp, which makes it
+// possible to read the past states of the KeyValueDb (for example, for auditing).
+// GetAt returns errors.TimestampBeyondCommitWatermarkErr if the timestamp is beyond the commit watermark, and
+// errors.TimestampBelowVersionWatermarkErr if the versions visible at the timestamp may have been collected.
+// The error returned by the callback is returned to the caller.
+func (db *KeyValueDb) GetAt(timestamp uint64, callback func(transaction *txn.ReadonlyTransaction) error) error {
+	if err := db.beginOperation(); err != nil {
+		return err
+	}
+	defer db.endOperation()
+
+	transaction, err := txn.NewReadonlyTransactionAt(db.oracle, timestamp)
+	if err != nil {
+		return err
+	}
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	return callback(transaction)
 }
 
 // PutOrUpdate takes a callback which receives a pointer to a txn.ReadWriteTransaction.
 // ReadWriteTransaction provides Get and PutOrUpdate to perform the required operations.
-// This method performs a commit as soon as the callback is done.
-func (db *KeyValueDb) PutOrUpdate(callback func(transaction *txn.ReadWriteTransaction)) (<-chan struct{}, error) {
-	if db.stopped.Load() {
-		return nil, DbAlreadyStoppedErr
+// This method performs a commit as soon as the callback is done, and returns a doneChannel which receives nil once the
+// commit is applied, or the error if the commit failed to be written to the WAL. (More on this in txn.ReadWriteTransaction.Commit).
+// If the callback returns an error, the transaction is rolled back: the Batch is discarded without going through the
+// commit path of the Oracle, the beginTimestamp is released and the error is returned to the caller.
+// If the context is done before the transaction begins or before it gets a commitTimestamp, PutOrUpdate returns the error
+// of the context and nothing is committed. (More on this in txn.ReadWriteTransaction.Commit).
+// The transaction runs with the txn.IsolationLevel of the KeyValueDb.
+func (db *KeyValueDb) PutOrUpdate(
+	ctx context.Context,
+	callback func(transaction *txn.ReadWriteTransaction) error,
+) (<-chan error, error) {
+	return db.PutOrUpdateWithIsolation(ctx, db.isolationLevel, callback)
+}
+
+// PutOrUpdateWithIsolation behaves like PutOrUpdate, but runs the transaction with the isolationLevel instead of the
+// txn.IsolationLevel of the KeyValueDb.
+func (db *KeyValueDb) PutOrUpdateWithIsolation(
+	ctx context.Context,
+	isolationLevel txn.IsolationLevel,
+	callback func(transaction *txn.ReadWriteTransaction) error,
+) (<-chan error, error) {
+	if err := db.beginOperation(); err != nil {
+		return nil, err
+	}
+	defer db.endOperation()
+
+	transaction, err := txn.NewReadWriteTransactionWithIsolation(ctx, db.oracle, isolationLevel)
+	if err != nil {
+		return nil, err
 	}
-	transaction := txn.NewReadWriteTransaction(db.oracle)
 	defer transaction.FinishBeginTimestampForReadWriteTransaction()
 
-	callback(transaction)
-	return transaction.Commit()
+	if err := callback(transaction); err != nil {
+		return nil, err
+	}
+	return transaction.Commit(ctx)
+}
+
+// UpdateWithRetry runs the callback in a txn.ReadWriteTransaction and commits it, exactly like PutOrUpdate.
+// If the commit fails with errors.ConflictErr, the callback is run again in a fresh txn.ReadWriteTransaction (with a new
+// beginTimestamp), after an exponential backoff with jitter. (More on this in RetryOptions).
+// Any other error (including the error returned by the callback) is returned without a retry.
+// If all the attempts conflict, UpdateWithRetry returns a RetriesExhaustedError that wraps errors.ConflictErr.
+// If the context is done before or between the attempts, UpdateWithRetry returns the error of the context.
+func (db *KeyValueDb) UpdateWithRetry(
+	ctx context.Context,
+	options RetryOptions,
+	callback func(transaction *txn.ReadWriteTransaction) error,
+) (<-chan error, error) {
+	attempt := 1
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		doneChannel, err := db.PutOrUpdate(ctx, callback)
+		if !errors.Is(err, txnErrors.ConflictErr) {
+			return doneChannel, err
+		}
+		if attempt >= options.MaxAttempts {
+			return nil, &RetriesExhaustedError{Attempts: attempt, Err: err}
+		}
+
+		timer := time.NewTimer(options.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		attempt = attempt + 1
+	}
+}
+
+// Checkpoint writes a point-in-time checkpoint of the KeyValueDb to the directory.
+// It takes a snapshot using a txn.ReadonlyTransaction and writes every key/value pair visible in the snapshot (deleted keys
+// are skipped), along with the commitTimestamp of the key, to a checksummed file. The readonly transaction reads the keys where commitTimestampOf(Key) < beginTimestamp,
+// so the checkpoint holds all the commits till beginTimestamp - 1, which is saved as the timestamp of the checkpoint.
+// Writes continue while the checkpoint is being written, they are not a part of the snapshot.
+func (db *KeyValueDb) Checkpoint(directory string) error {
+	if err := db.beginOperation(); err != nil {
+		return err
+	}
+	defer db.endOperation()
+
+	transaction, err := txn.NewReadonlyTransaction(context.Background(), db.oracle)
+	if err != nil {
+		return err
+	}
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	var timestamp uint64
+	if transaction.BeginTimestamp() > 0 {
+		timestamp = transaction.BeginTimestamp() - 1
+	}
+	writer, err := checkpoint.NewWriter(directory, timestamp)
+	if err != nil {
+		return err
+	}
+
+	iterator := transaction.NewIterator()
+	defer iterator.Close()
+
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		if err := writer.Add(iterator.Key(), iterator.Version(), iterator.Value().Slice()); err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		writer.Abort()
+		return err
+	}
+	_, err = writer.Finish()
+	return err
 }
 
-// Stop stops the KeyValueDb which in turn stops the Oracle.
-func (db *KeyValueDb) Stop() {
-	if db.stopped.CompareAndSwap(false, true) {
-		db.oracle.Stop()
+// NewTransaction creates a new manually managed Transaction.
+// A read-write Transaction is created if readWrite is true, else a readonly Transaction is created.
+// The client must end the Transaction by invoking Commit or Discard. (More on this in Transaction). Close waits for the
+// open Transactions to end.
+// If the context is done before the Transaction begins, NewTransaction returns the error of the context.
+// A read-write Transaction runs with the txn.IsolationLevel of the KeyValueDb.
+func (db *KeyValueDb) NewTransaction(ctx context.Context, readWrite bool) (*Transaction, error) {
+	if err := db.beginOperation(); err != nil {
+		return nil, err
 	}
+	if readWrite {
+		transaction, err := txn.NewReadWriteTransactionWithIsolation(ctx, db.oracle, db.isolationLevel)
+		if err != nil {
+			db.endOperation()
+			return nil, err
+		}
+		return newReadWriteTransaction(transaction, db.endOperation), nil
+	}
+	transaction, err := txn.NewReadonlyTransaction(ctx, db.oracle)
+	if err != nil {
+		db.endOperation()
+		return nil, err
+	}
+	return newReadonlyTransaction(transaction, db.endOperation), nil
+}
+
+// CollectVersions removes the obsolete versions right away (without waiting for the background collection), and returns
+// the number of versions removed by this collection, along with the bytes they take in the memtables (UnlinkedBytes).
+// The collection itself does not free any memory: a memtable allocates from an append-only arena. The unlinked bytes come
+// back when the active memtable is compacted into a new arena, which happens after a commit once the unlinked bytes take
+// half of the memtable (More on this in mvcc.Storage.MayBeCompact), or when a memtable is flushed to an SSTable and dropped.
+func (db *KeyValueDb) CollectVersions() (mvcc.CollectedVersions, error) {
+	if err := db.beginOperation(); err != nil {
+		return mvcc.CollectedVersions{}, err
+	}
+	defer db.endOperation()
+
+	return db.versionCollector.Collect(), nil
+}
+
+// CollectedVersions returns the total number of versions removed (and bytes unlinked) by all the version collections so far.
+// (More on this in CollectVersions).
+func (db *KeyValueDb) CollectedVersions() mvcc.CollectedVersions {
+	return db.versionCollector.Collected()
+}
+
+// HotKeys returns at most limit keys that caused the most conflicts, in the decreasing order of their conflicts.
+// It returns ConflictCounterDisabledErr if the KeyValueDb is not opened with Options.CountConflictsPerKey.
+func (db *KeyValueDb) HotKeys(limit int) ([]txn.KeyConflicts, error) {
+	counter := db.oracle.ConflictCounter()
+	if counter == nil {
+		return nil, ConflictCounterDisabledErr
+	}
+	return counter.HotKeys(limit), nil
+}
+
+// Close gracefully shuts the KeyValueDb down:
+// 1. New transactions are rejected with DbAlreadyStoppedErr.
+// 2. Close waits for the running operations (Get, PutOrUpdate, Checkpoint, ...) and the open manually managed Transactions
+// to finish.
+// 3. Close waits till every transaction that got a commitTimestamp is applied (txn.Oracle.WaitForCommits).
+// 4. The version collection and the Oracle are stopped. Stopping the Oracle applies the commits that are already submitted
+// to the txn.TransactionExecutor and closes their doneChannels (after syncing the WAL), flushes the immutable MemTables to
+// SSTables and closes the WAL.
+// If the context is done before the operations finish or the commits are applied, the KeyValueDb is still torn down, and
+// the error of the context is returned. Otherwise, the error of stopping the Oracle (if any, for example a failed flush) is
+// returned. An operation that is still running then fails with errors.MarkStoppedErr (instead of a panic), and a commit
+// that did not get a commitTimestamp is not committed.
+// Close returns DbAlreadyStoppedErr if the KeyValueDb is already closed (or stopped).
+func (db *KeyValueDb) Close(ctx context.Context) error {
+	if !db.markStopped() {
+		return DbAlreadyStoppedErr
+	}
+	err := db.waitForOperations(ctx)
+	if err == nil {
+		err = db.oracle.WaitForCommits(ctx)
+	}
+	db.versionCollector.Stop()
+	if stopErr := db.oracle.Stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// Stop stops the KeyValueDb which in turn stops the version collection and the Oracle, without waiting for the running
+// operations. Use Close for a graceful shutdown.
+// Stop returns the error of stopping the Oracle (for example, a failure to write the WAL or to flush the MemTables), and
+// DbAlreadyStoppedErr if the KeyValueDb is already stopped.
+func (db *KeyValueDb) Stop() error {
+	if !db.markStopped() {
+		return DbAlreadyStoppedErr
+	}
+	db.versionCollector.Stop()
+	return db.oracle.Stop()
+}
+
+// markStopped marks the KeyValueDb as stopped, so that no new operation begins. It returns false if the KeyValueDb is
+// already stopped.
+func (db *KeyValueDb) markStopped() bool {
+	db.operationLock.Lock()
+	defer db.operationLock.Unlock()
+
+	return db.stopped.CompareAndSwap(false, true)
+}
+
+// beginOperation registers a new operation with the KeyValueDb, so that Close waits for it to end.
+// It returns DbAlreadyStoppedErr if the KeyValueDb is stopped.
+func (db *KeyValueDb) beginOperation() error {
+	db.operationLock.Lock()
+	defer db.operationLock.Unlock()
+
+	if db.stopped.Load() {
+		return DbAlreadyStoppedErr
+	}
+	db.operations.Add(1)
+	return nil
+}
+
+// endOperation indicates that an operation registered using beginOperation has ended.
+func (db *KeyValueDb) endOperation() {
+	db.operations.Done()
+}
+
+// waitForOperations waits till all the registered operations end, or returns the error of the context if it is done before that.
+// The KeyValueDb is marked stopped before waiting, so no new operation is registered during the wait.
+func (db *KeyValueDb) waitForOperations(ctx context.Context) error {
+	operationsEnded := make(chan struct{})
+	go func() {
+		db.operations.Wait()
+		close(operationsEnded)
+	}()
+	select {
+	case <-operationsEnded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// restore restores the state of the storage from the SSTables (or the newest checkpoint) and the WAL in the directory,
+// and returns the last restored commitTimestamp.
+func restore(directory string, storage *mvcc.Storage) (uint64, error) {
+	restoredTimestamp, ok := storage.LastFlushedCommitTimestamp()
+	if !ok {
+		checkpointTimestamp, err := loadCheckpoint(directory, storage)
+		if err != nil {
+			return 0, err
+		}
+		storage.MayBeRotate(checkpointTimestamp)
+		restoredTimestamp = checkpointTimestamp
+	}
+	return replayWAL(directory, storage, restoredTimestamp)
+}
+
+// loadCheckpoint loads the newest checkpoint in the directory into the storage, and returns the timestamp of the checkpoint.
+// All the pairs of the checkpoint are put in the storage with their saved commitTimestamp as the version.
+func loadCheckpoint(directory string, storage *mvcc.Storage) (uint64, error) {
+	timestamp, _, err := checkpoint.LoadLatest(directory, func(key []byte, version uint64, value []byte) error {
+		storage.PutOrUpdate(mvcc.NewVersionedKey(key, version), mvcc.NewValue(value))
+		return nil
+	})
+	return timestamp, err
+}
+
+// replayWAL applies the records of the WAL in the directory with a commitTimestamp greater than the afterTimestamp to
+// the storage, and returns the last commitTimestamp. It returns the afterTimestamp if there is no such record.
+// The storage gets a chance to rotate its active mvcc.MemTable after every record, exactly like txn.TransactionExecutor.
+func replayWAL(directory string, storage *mvcc.Storage, afterTimestamp uint64) (uint64, error) {
+	lastCommitTimestamp := afterTimestamp
+	err := wal.Replay(directory, func(record wal.Record) error {
+		if record.Timestamp <= afterTimestamp {
+			return nil
+		}
+		for _, entry := range record.Entries {
+			value := mvcc.NewValue(entry.Value)
+			if entry.Deleted {
+				value = mvcc.NewDeletedValue()
+			}
+			storage.PutOrUpdate(mvcc.NewVersionedKey(entry.Key, record.Timestamp), value)
+		}
+		storage.MayBeRotate(record.Timestamp)
+		lastCommitTimestamp = record.Timestamp
+		return nil
+	})
+	return lastCommitTimestamp, err
 }
@@ -1,7 +1,10 @@
 package serialized_snapshot_isolation
 
 import (
+	"context"
+	goErrors "errors"
 	"github.com/stretchr/testify/assert"
+	"path/filepath"
 	"serialized-snapshot-isolation/txn"
 	"serialized-snapshot-isolation/txn/errors"
 	"strconv"
@@ -12,57 +15,124 @@ import (
 
 func TestGetsTheValueOfANonExistingKey(t *testing.T) {
 	db := NewKeyValueDb(10)
-	_ = db.Get(func(transaction *txn.ReadonlyTransaction) {
-		_, exists := transaction.Get([]byte("non-existing"))
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		_, exists, _ := transaction.Get([]byte("non-existing"))
 		assert.Equal(t, false, exists)
+		return nil
 	})
 }
 
 func TestGetsTheValueOfAnExistingKey(t *testing.T) {
 	db := NewKeyValueDb(10)
-	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	_ = db.Get(func(transaction *txn.ReadonlyTransaction) {
-		value, exists := transaction.Get([]byte("HDD"))
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		value, exists, _ := transaction.Get([]byte("HDD"))
 		assert.Equal(t, true, exists)
 		assert.Equal(t, []byte("Hard disk"), value.Slice())
+		return nil
 	})
 }
 
 func TestPutsMultipleKeyValuesInATransaction(t *testing.T) {
 	db := NewKeyValueDb(10)
-	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 		for count := 1; count <= 100; count++ {
 			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value:"+strconv.Itoa(count)))
 		}
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 		for count := 1; count <= 100; count++ {
 			_ = transaction.PutOrUpdate([]byte("Key:"+strconv.Itoa(count)), []byte("Value#"+strconv.Itoa(count)))
 		}
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
-	_ = db.Get(func(transaction *txn.ReadonlyTransaction) {
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
 		for count := 1; count <= 100; count++ {
-			value, exists := transaction.Get([]byte("Key:" + strconv.Itoa(count)))
+			value, exists, _ := transaction.Get([]byte("Key:" + strconv.Itoa(count)))
 			assert.Equal(t, true, exists)
 			assert.Equal(t, []byte("Value:"+strconv.Itoa(count)), value.Slice())
 		}
+		return nil
+	})
+}
+
+func TestDeletesAnExistingKey(t *testing.T) {
+	db := NewKeyValueDb(10)
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.Delete([]byte("HDD"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		_, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, false, exists)
+		return nil
+	})
+}
+
+func TestIteratesOverTheKeys(t *testing.T) {
+	db := NewKeyValueDb(10)
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+		return nil
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		iterator := transaction.NewIterator()
+		defer iterator.Close()
+
+		var keys []string
+		for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+			keys = append(keys, string(iterator.Key()))
+		}
+		assert.Equal(t, []string{"HDD", "SSD"}, keys)
+		return nil
 	})
 }
 
@@ -73,26 +143,28 @@ func TestInvolvesConflictingTransactions(t *testing.T) {
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		_, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+		_, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 			delayCommit := func() {
 				time.Sleep(25 * time.Millisecond)
 			}
-			_, _ = transaction.Get([]byte("HDD"))
+			_, _, _ = transaction.Get([]byte("HDD"))
 			_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
 			delayCommit()
+			return nil
 		})
 		assert.Error(t, err)
-		assert.Equal(t, errors.ConflictErr, err)
+		assert.ErrorIs(t, err, errors.ConflictErr)
 	}()
 
 	go func() {
 		defer wg.Done()
-		waitChannelTwo, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+		waitChannelTwo, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 			delayCommit := func() {
 				time.Sleep(10 * time.Millisecond)
 			}
 			_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 			delayCommit()
+			return nil
 		})
 		assert.Nil(t, err)
 		<-waitChannelTwo
@@ -102,22 +174,24 @@ func TestInvolvesConflictingTransactions(t *testing.T) {
 
 func TestCommitTransactionAndCheckTheCommittedTransactionsInOracle(t *testing.T) {
 	db := NewKeyValueDb(10)
-	waitChannel, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
 
 	time.Sleep(10 * time.Millisecond) //allow transactionBeginTimestamp mark to be processed
 
-	_, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {})
+	_, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error { return nil })
 	assert.Error(t, err)
 	assert.Equal(t, errors.EmptyTransactionErr, err)
 
 	time.Sleep(10 * time.Millisecond) //allow transactionBeginTimestamp mark to be processed
 
-	waitChannel, err = db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+		return nil
 	})
 	assert.Nil(t, err)
 	<-waitChannel
@@ -125,12 +199,399 @@ func TestCommitTransactionAndCheckTheCommittedTransactionsInOracle(t *testing.T)
 	assert.Equal(t, 1, db.oracle.CommittedTransactionLength())
 }
 
+func TestRollsBackATransactionGivenTheCallbackReturnsAnError(t *testing.T) {
+	db := NewKeyValueDb(10)
+	validationErr := goErrors.New("invalid quantity")
+
+	_, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		return validationErr
+	})
+	assert.Error(t, err)
+	assert.Equal(t, validationErr, err)
+	assert.Equal(t, 0, db.oracle.CommittedTransactionLength())
+
+	for count := 1; count <= 2; count++ {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("SSD"+strconv.Itoa(count)), []byte("Solid state drive"))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		_, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, false, exists)
+		return nil
+	})
+}
+
+func TestReturnsTheErrorFromTheCallbackOfGet(t *testing.T) {
+	db := NewKeyValueDb(10)
+	notFoundErr := goErrors.New("key not found")
+
+	err := db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		if _, exists, _ := transaction.Get([]byte("HDD")); !exists {
+			return notFoundErr
+		}
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, notFoundErr, err)
+}
+
+func TestRetriesAConflictingTransaction(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	attempts := 0
+	waitChannel, err := db.UpdateWithRetry(context.Background(), DefaultRetryOptions(), func(transaction *txn.ReadWriteTransaction) error {
+		attempts = attempts + 1
+		_, _, _ = transaction.Get([]byte("HDD"))
+		if attempts == 1 {
+			concurrentWaitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+				return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+			})
+			assert.Nil(t, err)
+			<-concurrentWaitChannel
+		}
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	assert.Equal(t, 2, attempts)
+}
+
+func TestGivesUpRetryingAConflictingTransaction(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	attempts := 0
+	options := RetryOptions{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	_, err := db.UpdateWithRetry(context.Background(), options, func(transaction *txn.ReadWriteTransaction) error {
+		attempts = attempts + 1
+		_, _, _ = transaction.Get([]byte("HDD"))
+		concurrentWaitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		})
+		assert.Nil(t, err)
+		<-concurrentWaitChannel
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+
+	assert.Equal(t, 3, attempts)
+	assert.True(t, goErrors.Is(err, errors.ConflictErr))
+
+	var retriesExhaustedError *RetriesExhaustedError
+	assert.True(t, goErrors.As(err, &retriesExhaustedError))
+	assert.Equal(t, 3, retriesExhaustedError.Attempts)
+}
+
+func TestDoesNotRetryAConflictingTransactionGivenZeroMaxAttempts(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	attempts := 0
+	_, err := db.UpdateWithRetry(context.Background(), RetryOptions{}, func(transaction *txn.ReadWriteTransaction) error {
+		attempts = attempts + 1
+		_, _, _ = transaction.Get([]byte("HDD"))
+		concurrentWaitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		})
+		assert.Nil(t, err)
+		<-concurrentWaitChannel
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+
+	assert.Equal(t, 1, attempts)
+	var retriesExhaustedError *RetriesExhaustedError
+	assert.True(t, goErrors.As(err, &retriesExhaustedError))
+	assert.Equal(t, 1, retriesExhaustedError.Attempts)
+}
+
+func TestDoesNotRetryATransactionGivenTheCallbackReturnsAnError(t *testing.T) {
+	db := NewKeyValueDb(10)
+	validationErr := goErrors.New("invalid quantity")
+
+	attempts := 0
+	_, err := db.UpdateWithRetry(context.Background(), DefaultRetryOptions(), func(transaction *txn.ReadWriteTransaction) error {
+		attempts = attempts + 1
+		return validationErr
+	})
+
+	assert.Equal(t, validationErr, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestStopsRetryingATransactionGivenTheContextIsDone(t *testing.T) {
+	db := NewKeyValueDb(10)
+	ctx, cancelFunction := context.WithCancel(context.Background())
+
+	attempts := 0
+	_, err := db.UpdateWithRetry(ctx, DefaultRetryOptions(), func(transaction *txn.ReadWriteTransaction) error {
+		attempts = attempts + 1
+		_, _, _ = transaction.Get([]byte("HDD"))
+		concurrentWaitChannel, _ := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		})
+		<-concurrentWaitChannel
+		cancelFunction()
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestReopensADurableDb(t *testing.T) {
+	directory := t.TempDir()
+	db, err := Open(directory, DefaultOptions())
+	assert.Nil(t, err)
+
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.Delete([]byte("HDD"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+	db.Stop()
+
+	db, err = Open(directory, DefaultOptions())
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("NVMe"), []byte("Non volatile memory"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		_, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, false, exists)
+
+		value, exists, _ := transaction.Get([]byte("SSD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Solid state drive"), value.Slice())
+		return nil
+	})
+}
+
+func TestRestoresADbFromACheckpoint(t *testing.T) {
+	db, err := Open(t.TempDir(), DefaultOptions())
+	assert.Nil(t, err)
+
+	for _, keyValue := range [][]string{{"HDD", "Hard disk"}, {"SSD", "Solid state drive"}, {"NVMe", "Non volatile memory"}} {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte(keyValue[0]), []byte(keyValue[1]))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+
+	checkpointDirectory := t.TempDir()
+	assert.Nil(t, db.Checkpoint(checkpointDirectory))
+	db.Stop()
+
+	restored, err := Open(checkpointDirectory, DefaultOptions())
+	assert.Nil(t, err)
+	defer restored.Stop()
+
+	_ = restored.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		assert.Equal(t, uint64(2), transaction.BeginTimestamp())
+
+		value, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+		_, exists, _ = transaction.Get([]byte("NVMe"))
+		assert.Equal(t, false, exists)
+		return nil
+	})
+}
+
+func TestRestoresADbFromACheckpointAndTheWAL(t *testing.T) {
+	directory := t.TempDir()
+	db, err := Open(directory, DefaultOptions())
+	assert.Nil(t, err)
+
+	put := func(db *KeyValueDb, key, value string) {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte(key), []byte(value))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+	put(db, "HDD", "Hard disk")
+	put(db, "SSD", "Solid state")
+	assert.Nil(t, db.Checkpoint(directory))
+
+	put(db, "HDD", "Hard disk drive")
+	put(db, "SSD", "Solid state drive")
+	db.Stop()
+
+	restored, err := Open(directory, DefaultOptions())
+	assert.Nil(t, err)
+	defer restored.Stop()
+
+	put(restored, "NVMe", "Non volatile memory")
+	_ = restored.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		value, _, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+
+		value, _, _ = transaction.Get([]byte("SSD"))
+		assert.Equal(t, []byte("Solid state drive"), value.Slice())
+		return nil
+	})
+}
+
+func TestReopensADurableDbWithFlushedMemTables(t *testing.T) {
+	directory := t.TempDir()
+	options := DefaultOptions()
+	options.MemTableSizeLimit = 512
+
+	db, err := Open(directory, options)
+	assert.Nil(t, err)
+
+	for count := 1; count <= 100; count++ {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("Key-"+strconv.Itoa(count)), []byte("Value-"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.Delete([]byte("Key-1"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+	db.Stop()
+
+	sstables, err := filepath.Glob(filepath.Join(directory, "sstable-*.sst"))
+	assert.Nil(t, err)
+	assert.Greater(t, len(sstables), 1)
+
+	walSegments, err := filepath.Glob(filepath.Join(directory, "wal-*.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(walSegments))
+
+	db, err = Open(directory, options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("NVMe"), []byte("Non volatile memory"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		_, exists, _ := transaction.Get([]byte("Key-1"))
+		assert.Equal(t, false, exists)
+
+		for count := 2; count <= 100; count++ {
+			value, exists, _ := transaction.Get([]byte("Key-" + strconv.Itoa(count)))
+			assert.Equal(t, true, exists)
+			assert.Equal(t, []byte("Value-"+strconv.Itoa(count)), value.Slice())
+		}
+
+		iterator := transaction.NewIterator()
+		defer iterator.Close()
+
+		keys := 0
+		for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+			keys++
+		}
+		assert.Equal(t, 99, keys)
+		return nil
+	})
+}
+
+func TestCollectsTheObsoleteVersionsInTheDb(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	for count := 1; count <= 5; count++ {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk-"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+
+	assert.Eventually(t, func() bool {
+		_, err := db.CollectVersions()
+		assert.Nil(t, err)
+		return db.CollectedVersions().Versions == 2
+	}, 5*time.Second, time.Millisecond)
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		value, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk-4"), value.Slice())
+		return nil
+	})
+}
+
+func TestGetsTheValueOfAKeyAtAHistoricalTimestamp(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	for count := 1; count <= 3; count++ {
+		waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk-"+strconv.Itoa(count)))
+		})
+		assert.Nil(t, err)
+		<-waitChannel
+	}
+
+	assert.Eventually(t, func() bool {
+		return db.GetAt(3, func(transaction *txn.ReadonlyTransaction) error { return nil }) == nil
+	}, 5*time.Second, time.Millisecond)
+
+	err := db.GetAt(2, func(transaction *txn.ReadonlyTransaction) error {
+		value, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk-1"), value.Slice())
+		return nil
+	})
+	assert.Nil(t, err)
+
+	err = db.GetAt(3, func(transaction *txn.ReadonlyTransaction) error {
+		value, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk-2"), value.Slice())
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestAttemptsToGetAtATimestampBeyondTheCommitWatermark(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	err := db.GetAt(5, func(transaction *txn.ReadonlyTransaction) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, errors.TimestampBeyondCommitWatermarkErr)
+}
+
 func TestAttemptsToGetFromAStoppedDb(t *testing.T) {
 	db := NewKeyValueDb(10)
 	db.Stop()
 
-	err := db.Get(func(transaction *txn.ReadonlyTransaction) {
-		_, _ = transaction.Get([]byte("non-existing"))
+	err := db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		_, _, _ = transaction.Get([]byte("non-existing"))
+		return nil
 	})
 
 	assert.Error(t, err)
@@ -141,8 +602,9 @@ func TestAttemptsToPutInAStoppedDb(t *testing.T) {
 	db := NewKeyValueDb(10)
 	db.Stop()
 
-	_, err := db.PutOrUpdate(func(transaction *txn.ReadWriteTransaction) {
+	_, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
 		_ = transaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+		return nil
 	})
 
 	assert.Error(t, err)
@@ -165,9 +627,229 @@ func TestStopsTheDbConcurrently(t *testing.T) {
 	}()
 
 	wg.Wait()
-	err := db.Get(func(transaction *txn.ReadonlyTransaction) {
-		_, _ = transaction.Get([]byte("HDD"))
+	err := db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		_, _, _ = transaction.Get([]byte("HDD"))
+		return nil
 	})
 	assert.Error(t, err)
 	assert.Equal(t, DbAlreadyStoppedErr, err)
 }
+
+func TestAttemptsToPutOrUpdateWithACancelledContext(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	invoked := false
+	_, err := db.PutOrUpdate(ctx, func(transaction *txn.ReadWriteTransaction) error {
+		invoked = true
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, false, invoked)
+
+	err = db.Get(ctx, func(transaction *txn.ReadonlyTransaction) error {
+		invoked = true
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, false, invoked)
+}
+
+func TestReturnsTheHotKeysThatCausedTheConflicts(t *testing.T) {
+	options := DefaultOptions()
+	options.CountConflictsPerKey = true
+	db, err := Open(t.TempDir(), options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	_, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_, _, _ = transaction.Get([]byte("HDD"))
+		concurrentWaitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		})
+		assert.Nil(t, err)
+		<-concurrentWaitChannel
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+	assert.ErrorIs(t, err, errors.ConflictErr)
+
+	hotKeys, err := db.HotKeys(10)
+	assert.Nil(t, err)
+	assert.Equal(t, []txn.KeyConflicts{{Key: []byte("HDD"), Conflicts: 1}}, hotKeys)
+}
+
+func TestAttemptsToGetTheHotKeysWithoutCountingTheConflicts(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	_, err := db.HotKeys(10)
+	assert.ErrorIs(t, err, ConflictCounterDisabledErr)
+}
+
+func TestRunsTransactionsWithTheIsolationLevelOfTheDb(t *testing.T) {
+	options := DefaultOptions()
+	options.IsolationLevel = txn.SnapshotIsolation
+	db, err := Open(t.TempDir(), options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	_, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		assert.Equal(t, txn.SnapshotIsolation, transaction.IsolationLevel())
+		_, _, _ = transaction.Get([]byte("HDD"))
+		concurrentWaitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		})
+		assert.Nil(t, err)
+		<-concurrentWaitChannel
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+	assert.Nil(t, err)
+
+	_, err = db.PutOrUpdateWithIsolation(
+		context.Background(),
+		txn.SerializableSnapshotIsolation,
+		func(transaction *txn.ReadWriteTransaction) error {
+			assert.Equal(t, txn.SerializableSnapshotIsolation, transaction.IsolationLevel())
+			_, _, _ = transaction.Get([]byte("HDD"))
+			concurrentWaitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+				return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+			})
+			assert.Nil(t, err)
+			<-concurrentWaitChannel
+			return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid-state drive"))
+		},
+	)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+}
+
+func TestReopensADurableDbWithTheHybridLogicalClockTimestampSource(t *testing.T) {
+	directory := t.TempDir()
+	options := DefaultOptions()
+	options.TimestampSource = txn.NewHybridLogicalClockTimestampSource()
+	db, err := Open(directory, options)
+	assert.Nil(t, err)
+
+	waitChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+	db.Stop()
+
+	db, err = Open(directory, options)
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	waitChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+	assert.Nil(t, err)
+	<-waitChannel
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		value, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+		physicalTime := options.TimestampSource.(*txn.HybridLogicalClockTimestampSource).PhysicalTime(transaction.BeginTimestamp())
+		assert.WithinDuration(t, time.Now(), physicalTime, time.Minute)
+		return nil
+	})
+}
+
+func TestClosesTheDbAfterTheInFlightCommitsAreApplied(t *testing.T) {
+	directory := t.TempDir()
+	db, err := Open(directory, DefaultOptions())
+	assert.Nil(t, err)
+
+	callbackStarted, releaseCallback := make(chan struct{}), make(chan struct{})
+	commitChannel := make(chan (<-chan error))
+	go func() {
+		doneChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			close(callbackStarted)
+			<-releaseCallback
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+		})
+		assert.Nil(t, err)
+		commitChannel <- doneChannel
+	}()
+	<-callbackStarted
+
+	closeChannel := make(chan error)
+	go func() {
+		closeChannel <- db.Close(context.Background())
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+		})
+		return err == DbAlreadyStoppedErr
+	}, time.Second, time.Millisecond)
+
+	select {
+	case <-closeChannel:
+		t.Fatal("Close returned before the in-flight commit was applied")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(releaseCallback)
+	doneChannel := <-commitChannel
+	assert.Nil(t, <-closeChannel)
+	<-doneChannel
+
+	db, err = Open(directory, DefaultOptions())
+	assert.Nil(t, err)
+	defer db.Stop()
+
+	doneChannel, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("NVMe"), []byte("Non volatile memory"))
+	})
+	assert.Nil(t, err)
+	<-doneChannel
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		value, exists, _ := transaction.Get([]byte("HDD"))
+		assert.Equal(t, true, exists)
+		assert.Equal(t, []byte("Hard disk"), value.Slice())
+		return nil
+	})
+}
+
+func TestClosesTheDbWithAnOpenTransactionOnReachingTheDeadline(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, err := db.NewTransaction(context.Background(), false)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, db.Close(ctx), context.DeadlineExceeded)
+	transaction.Discard()
+
+	_, err = db.NewTransaction(context.Background(), true)
+	assert.Equal(t, DbAlreadyStoppedErr, err)
+	assert.Equal(t, DbAlreadyStoppedErr, db.Close(context.Background()))
+}
+
+func TestClosesTheDbAfterTheOpenTransactionsFinish(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, err := db.NewTransaction(context.Background(), true)
+	assert.Nil(t, err)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	closeChannel := make(chan error)
+	go func() {
+		closeChannel <- db.Close(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, <-closeChannel)
+	<-doneChannel
+}
@@ -0,0 +1,87 @@
+package serialized_snapshot_isolation
+
+import (
+	"log"
+	"net/http"
+	"serialized-snapshot-isolation/metrics"
+	"serialized-snapshot-isolation/txn"
+)
+
+// Metrics returns a point-in-time snapshot of the metrics of the KeyValueDb: the counters of the transactions, the
+// timestamp watermarks, the depth of the commit queue, the number of versions in the memtables, and the histograms of
+// the commit latency and the wait for the commits. (More on this in txn.Metrics).
+// Metrics can be invoked after the KeyValueDb is stopped, it then returns the final values.
+func (db *KeyValueDb) Metrics() txn.Metrics {
+	return db.oracle.Metrics()
+}
+
+// MetricsHandler returns an http.Handler that serves the Metrics of the KeyValueDb in the Prometheus text exposition format.
+// All the metrics are prefixed with `ssi_`, the counters end with `_total`, and the durations are in seconds.
+func (db *KeyValueDb) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", metrics.PrometheusContentType)
+		if err := writePrometheusMetrics(metrics.NewPrometheusWriter(writer), db.Metrics()); err != nil {
+			log.Printf("failed to write the metrics to %v: %v", request.RemoteAddr, err)
+		}
+	})
+}
+
+// writePrometheusMetrics writes the snapshot using the PrometheusWriter, and returns the first error of the writes.
+func writePrometheusMetrics(writer *metrics.PrometheusWriter, snapshot txn.Metrics) error {
+	writer.WriteCounter("ssi_commits_total", "Read-write transactions whose commits were applied.", snapshot.Commits)
+	writer.WriteCounter(
+		"ssi_failed_commits_total",
+		"Read-write transactions that got a commit timestamp, but failed to be written to the WAL.",
+		snapshot.FailedCommits,
+	)
+	writer.WriteCounter("ssi_conflicts_total", "Read-write transactions aborted because of a conflict.", snapshot.Conflicts)
+	writer.WriteCounter(
+		"ssi_empty_transaction_rejections_total",
+		"Commits rejected because the transaction has no writes.",
+		snapshot.EmptyTransactionRejections,
+	)
+	writer.WriteCounter(
+		"ssi_readonly_transactions_started_total",
+		"Readonly transactions started.",
+		snapshot.ReadonlyTransactionsStarted,
+	)
+	writer.WriteCounter(
+		"ssi_read_write_transactions_started_total",
+		"Read-write transactions started.",
+		snapshot.ReadWriteTransactionsStarted,
+	)
+	writer.WriteGauge(
+		"ssi_committed_transactions",
+		"Committed transactions tracked for the conflict detection.",
+		snapshot.CommittedTransactions,
+	)
+	writer.WriteGauge(
+		"ssi_begin_timestamp_done_till",
+		"Timestamp till which all the transactions have begun and finished.",
+		snapshot.BeginTimestampDoneTill,
+	)
+	writer.WriteGauge(
+		"ssi_commit_timestamp_done_till",
+		"Timestamp till which all the commits are applied.",
+		snapshot.CommitTimestampDoneTill,
+	)
+	writer.WriteGauge("ssi_next_timestamp", "One more than the last commit timestamp.", snapshot.NextTimestamp)
+	writer.WriteGauge("ssi_memtable_nodes", "Versions held by the memtables.", snapshot.MemTableNodes)
+	writer.WriteGauge("ssi_submitted_batches", "Commits waiting to be applied.", snapshot.SubmittedBatches)
+	writer.WriteGauge(
+		"ssi_blocked_transactions",
+		"New transactions waiting for the commits before their begin timestamps.",
+		snapshot.BlockedTransactions,
+	)
+	writer.WriteHistogram(
+		"ssi_commit_latency_seconds",
+		"Time from the start of a commit till the commit is applied.",
+		snapshot.CommitLatency,
+	)
+	writer.WriteHistogram(
+		"ssi_wait_for_mark_duration_seconds",
+		"Time the new transactions wait for the commits before their begin timestamps.",
+		snapshot.WaitForMarkDuration,
+	)
+	return writer.Err()
+}
@@ -0,0 +1,98 @@
+package serialized_snapshot_isolation
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http/httptest"
+	"serialized-snapshot-isolation/metrics"
+	"serialized-snapshot-isolation/txn"
+	"serialized-snapshot-isolation/txn/errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReturnsTheMetricsOfTheDb(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	doneChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+	<-doneChannel
+
+	_, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		_, _, _ = transaction.Get([]byte("HDD"))
+		concurrentDoneChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+			return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+		})
+		assert.Nil(t, err)
+		<-concurrentDoneChannel
+		return transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	})
+	assert.ErrorIs(t, err, errors.ConflictErr)
+
+	_, err = db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return nil
+	})
+	assert.Equal(t, errors.EmptyTransactionErr, err)
+
+	_ = db.Get(context.Background(), func(transaction *txn.ReadonlyTransaction) error {
+		return nil
+	})
+
+	assert.Eventually(t, func() bool {
+		return db.Metrics().CommitTimestampDoneTill == 2
+	}, time.Second, time.Millisecond)
+
+	snapshot := db.Metrics()
+	assert.Equal(t, uint64(2), snapshot.Commits)
+	assert.Equal(t, uint64(1), snapshot.Conflicts)
+	assert.Equal(t, uint64(1), snapshot.EmptyTransactionRejections)
+	assert.Equal(t, uint64(1), snapshot.ReadonlyTransactionsStarted)
+	assert.Equal(t, uint64(4), snapshot.ReadWriteTransactionsStarted)
+	assert.Equal(t, uint64(3), snapshot.NextTimestamp)
+	assert.Equal(t, uint64(2), snapshot.MemTableNodes)
+	assert.Equal(t, uint64(2), snapshot.CommitLatency.Count)
+	assert.True(t, snapshot.WaitForMarkDuration.Count >= 5)
+}
+
+func TestServesTheMetricsOfTheDbInThePrometheusTextFormat(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	doneChannel, err := db.PutOrUpdate(context.Background(), func(transaction *txn.ReadWriteTransaction) error {
+		return transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	})
+	assert.Nil(t, err)
+	<-doneChannel
+
+	recorder := httptest.NewRecorder()
+	db.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	response := recorder.Result()
+	body, _ := io.ReadAll(response.Body)
+
+	assert.Equal(t, metrics.PrometheusContentType, response.Header.Get("Content-Type"))
+	assert.True(t, strings.Contains(string(body), "# TYPE ssi_commits_total counter\nssi_commits_total 1\n"))
+	assert.True(t, strings.Contains(string(body), "# TYPE ssi_failed_commits_total counter\nssi_failed_commits_total 0\n"))
+	assert.True(t, strings.Contains(string(body), "# TYPE ssi_memtable_nodes gauge\nssi_memtable_nodes 1\n"))
+	assert.True(t, strings.Contains(string(body), "ssi_commit_latency_seconds_count 1\n"))
+	assert.True(t, strings.Contains(string(body), "ssi_wait_for_mark_duration_seconds_bucket{le=\"+Inf\"}"))
+}
+
+type failingWriter struct{}
+
+func (writer failingWriter) Write(bytes []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestReturnsTheErrorOfWritingTheMetrics(t *testing.T) {
+	db := NewKeyValueDb(10)
+	defer db.Stop()
+
+	err := writePrometheusMetrics(metrics.NewPrometheusWriter(failingWriter{}), db.Metrics())
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
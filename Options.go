@@ -0,0 +1,51 @@
+package serialized_snapshot_isolation
+
+import (
+	"serialized-snapshot-isolation/txn"
+	"serialized-snapshot-isolation/wal"
+	"time"
+)
+
+// defaultVersionCollectionInterval is the interval of the background version collection.
+const defaultVersionCollectionInterval = 30 * time.Second
+
+// Options configures a KeyValueDb that is opened using Open.
+// SkiplistMaxLevel is the maximum level of the SkipList of mvcc.MemTable.
+// SyncPolicy determines when the write-ahead log is synced to the disk, and hence when the doneChannel of a commit is closed.
+// MemTableSizeLimit is the (approximate) size in bytes after which the active mvcc.MemTable is rotated and flushed to an
+// SSTable. A MemTableSizeLimit of 0 keeps all the data in a single mvcc.MemTable.
+// VersionCollectionInterval is the interval at which the obsolete versions are removed by txn.VersionCollector. A
+// VersionCollectionInterval of 0 disables the background collection.
+// ApplyWorkers is the number of workers that apply the commits touching disjoint keys concurrently (More on this in
+// txn.TransactionExecutor). An ApplyWorkers of 1 applies all the commits from a single goroutine.
+// IsolationLevel is the default txn.IsolationLevel of the read-write transactions (More on this in txn.IsolationLevel).
+// TimestampSource generates the commitTimestamps (More on this in txn.TimestampSource). A nil TimestampSource uses
+// txn.CounterTimestampSource.
+// MaxWaitForCommits bounds the time a new transaction waits for the commits before its beginTimestamp to be applied
+// (More on this in txn.Oracle). A MaxWaitForCommits of 0 waits till the commits are applied or the context is done.
+// CountConflictsPerKey enables the counting of the conflicts per key (txn.ConflictCounter), which is queried using KeyValueDb.HotKeys.
+type Options struct {
+	SkiplistMaxLevel          uint8
+	SyncPolicy                wal.SyncPolicy
+	MemTableSizeLimit         uint64
+	VersionCollectionInterval time.Duration
+	ApplyWorkers              int
+	CountConflictsPerKey      bool
+	IsolationLevel            txn.IsolationLevel
+	TimestampSource           txn.TimestampSource
+	MaxWaitForCommits         time.Duration
+}
+
+// DefaultOptions returns the Options with a SkiplistMaxLevel of 16, wal.SyncEveryCommit, a MemTableSizeLimit of 64MB,
+// a VersionCollectionInterval of 30 seconds, a single apply worker, txn.SerializableSnapshotIsolation and txn.CounterTimestampSource.
+func DefaultOptions() Options {
+	return Options{
+		SkiplistMaxLevel:          16,
+		SyncPolicy:                wal.SyncEveryCommit(),
+		MemTableSizeLimit:         64 << 20,
+		VersionCollectionInterval: defaultVersionCollectionInterval,
+		ApplyWorkers:              1,
+		IsolationLevel:            txn.SerializableSnapshotIsolation,
+		TimestampSource:           txn.NewCounterTimestampSource(),
+	}
+}
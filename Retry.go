@@ -0,0 +1,74 @@
+package serialized_snapshot_isolation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryOptions configures KeyValueDb.UpdateWithRetry.
+// MaxAttempts is the maximum number of times the callback is run, including the first attempt. A MaxAttempts of 1 (or
+// less) runs the callback once, without any retry.
+// The backoff between two attempts starts at InitialBackoff and doubles after every conflicting attempt, up to MaxBackoff.
+// A MaxBackoff of 0 does not cap the backoff (it only stops growing at the largest time.Duration), and an InitialBackoff of
+// 0 retries right away.
+// A random jitter is applied to every backoff, so that the transactions that conflict with each other do not retry in lockstep.
+type RetryOptions struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryOptions returns the RetryOptions with 10 attempts, and a backoff starting at 1ms that is capped at 100ms.
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		MaxAttempts:    10,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+	}
+}
+
+// RetriesExhaustedError is returned by KeyValueDb.UpdateWithRetry when the transaction conflicts in all the attempts.
+// It wraps the error of the last attempt (errors.ConflictErr), so errors.Is(err, errors.ConflictErr) holds.
+type RetriesExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+// Error returns the error message.
+func (err *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("%v (gave up after %d attempts)", err.Err, err.Attempts)
+}
+
+// Unwrap returns the error of the last attempt.
+func (err *RetriesExhaustedError) Unwrap() error {
+	return err.Err
+}
+
+// backoff computes the delay before the next attempt.
+// The delay for the attempt (starting at 1) is InitialBackoff * 2^(attempt-1), capped at MaxBackoff (or at the largest
+// time.Duration, if MaxBackoff is 0).
+// Jitter picks a random delay between half of the computed delay and the computed delay.
+func (options RetryOptions) backoff(attempt int) time.Duration {
+	maxBackoff := options.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = time.Duration(math.MaxInt64)
+	}
+	delay := options.InitialBackoff
+	for count := 1; count < attempt && delay > 0 && delay < maxBackoff; count++ {
+		if delay > maxBackoff/2 {
+			delay = maxBackoff
+			break
+		}
+		delay = delay * 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
@@ -0,0 +1,52 @@
+package serialized_snapshot_isolation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBackoffForTheFirstAttempt(t *testing.T) {
+	options := RetryOptions{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	backoff := options.backoff(1)
+
+	assert.GreaterOrEqual(t, backoff, 5*time.Millisecond)
+	assert.LessOrEqual(t, backoff, 10*time.Millisecond)
+}
+
+func TestBackoffGrowsExponentially(t *testing.T) {
+	options := RetryOptions{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	backoff := options.backoff(3)
+
+	assert.GreaterOrEqual(t, backoff, 20*time.Millisecond)
+	assert.LessOrEqual(t, backoff, 40*time.Millisecond)
+}
+
+func TestBackoffIsCappedAtMaxBackoff(t *testing.T) {
+	options := RetryOptions{MaxAttempts: 50, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	backoff := options.backoff(40)
+
+	assert.GreaterOrEqual(t, backoff, 50*time.Millisecond)
+	assert.LessOrEqual(t, backoff, 100*time.Millisecond)
+}
+
+func TestNoBackoffGivenZeroInitialBackoff(t *testing.T) {
+	options := RetryOptions{MaxAttempts: 5}
+	assert.Equal(t, time.Duration(0), options.backoff(2))
+}
+
+func TestBackoffIsNotCappedGivenZeroMaxBackoff(t *testing.T) {
+	options := RetryOptions{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond}
+	backoff := options.backoff(4)
+
+	assert.GreaterOrEqual(t, backoff, 40*time.Millisecond)
+	assert.LessOrEqual(t, backoff, 80*time.Millisecond)
+}
+
+func TestBackoffStopsGrowingAtTheLargestDurationGivenZeroMaxBackoff(t *testing.T) {
+	options := RetryOptions{MaxAttempts: 100, InitialBackoff: 10 * time.Millisecond}
+	backoff := options.backoff(100)
+
+	assert.GreaterOrEqual(t, backoff, time.Duration(math.MaxInt64/2))
+}
@@ -0,0 +1,121 @@
+package serialized_snapshot_isolation
+
+import (
+	"context"
+	"errors"
+	"serialized-snapshot-isolation/mvcc"
+	"serialized-snapshot-isolation/txn"
+	"sync/atomic"
+)
+
+var TransactionAlreadyFinishedErr = errors.New("transaction is already committed or discarded, can not perform the operation")
+var ReadonlyTransactionWriteErr = errors.New("transaction is readonly, can not perform a write operation")
+
+// Transaction is a manually managed transaction, created using KeyValueDb.NewTransaction.
+// Unlike the callback style of KeyValueDb.Get and KeyValueDb.PutOrUpdate, a Transaction can be kept open across function
+// boundaries, and it is the responsibility of the client to end it, either by invoking Commit or Discard.
+// A Transaction wraps either a txn.ReadonlyTransaction or a txn.ReadWriteTransaction.
+//
+// A Transaction is finished after Commit or Discard. Any operation on a finished Transaction returns TransactionAlreadyFinishedErr,
+// except Discard which can be invoked any number of times. This makes it safe to `defer transaction.Discard()` right after
+// creating the Transaction.
+// Finishing a Transaction releases it from the KeyValueDb (`release`), KeyValueDb.Close waits for the open Transactions.
+type Transaction struct {
+	readonlyTransaction  *txn.ReadonlyTransaction
+	readWriteTransaction *txn.ReadWriteTransaction
+	finished             atomic.Bool
+	release              func()
+}
+
+// newReadonlyTransaction creates a new instance of Transaction which wraps a txn.ReadonlyTransaction.
+// release is invoked once the Transaction is finished.
+func newReadonlyTransaction(transaction *txn.ReadonlyTransaction, release func()) *Transaction {
+	return &Transaction{readonlyTransaction: transaction, release: release}
+}
+
+// newReadWriteTransaction creates a new instance of Transaction which wraps a txn.ReadWriteTransaction.
+// release is invoked once the Transaction is finished.
+func newReadWriteTransaction(transaction *txn.ReadWriteTransaction, release func()) *Transaction {
+	return &Transaction{readWriteTransaction: transaction, release: release}
+}
+
+// Get looks up the value for the key.
+// It returns (mvcc.Value, true, nil) if the value exists for the key, (nil, false, nil) otherwise, and the error if the
+// storage fails to read the key.
+func (transaction *Transaction) Get(key []byte) (mvcc.Value, bool, error) {
+	if transaction.finished.Load() {
+		return mvcc.Value{}, false, TransactionAlreadyFinishedErr
+	}
+	if transaction.isReadonly() {
+		return transaction.readonlyTransaction.Get(key)
+	}
+	return transaction.readWriteTransaction.Get(key)
+}
+
+// PutOrUpdate adds the key/value pair to the (read-write) Transaction.
+func (transaction *Transaction) PutOrUpdate(key []byte, value []byte) error {
+	if err := transaction.ensureWritable(); err != nil {
+		return err
+	}
+	return transaction.readWriteTransaction.PutOrUpdate(key, value)
+}
+
+// Delete deletes the key in the (read-write) Transaction.
+func (transaction *Transaction) Delete(key []byte) error {
+	if err := transaction.ensureWritable(); err != nil {
+		return err
+	}
+	return transaction.readWriteTransaction.Delete(key)
+}
+
+// Commit commits the Transaction and finishes it.
+// For a read-write Transaction, it returns the doneChannel of txn.ReadWriteTransaction.Commit.
+// For a readonly Transaction, there is nothing to commit, and it returns an already closed channel.
+// The beginTimestamp of the Transaction is released, irrespective of the result of the commit.
+// The context is passed to txn.ReadWriteTransaction.Commit.
+func (transaction *Transaction) Commit(ctx context.Context) (<-chan error, error) {
+	if !transaction.finished.CompareAndSwap(false, true) {
+		return nil, TransactionAlreadyFinishedErr
+	}
+	defer transaction.release()
+
+	if transaction.isReadonly() {
+		transaction.readonlyTransaction.FinishBeginTimestampForReadonlyTransaction()
+		doneChannel := make(chan error)
+		close(doneChannel)
+		return doneChannel, nil
+	}
+	defer transaction.readWriteTransaction.FinishBeginTimestampForReadWriteTransaction()
+	return transaction.readWriteTransaction.Commit(ctx)
+}
+
+// Discard finishes the Transaction without committing it, and releases its beginTimestamp.
+// Discard is idempotent: invoking it more than once, or after Commit, has no effect.
+func (transaction *Transaction) Discard() {
+	if !transaction.finished.CompareAndSwap(false, true) {
+		return
+	}
+	defer transaction.release()
+
+	if transaction.isReadonly() {
+		transaction.readonlyTransaction.FinishBeginTimestampForReadonlyTransaction()
+		return
+	}
+	transaction.readWriteTransaction.FinishBeginTimestampForReadWriteTransaction()
+}
+
+// ensureWritable returns an error if the Transaction is finished or readonly.
+func (transaction *Transaction) ensureWritable() error {
+	if transaction.finished.Load() {
+		return TransactionAlreadyFinishedErr
+	}
+	if transaction.isReadonly() {
+		return ReadonlyTransactionWriteErr
+	}
+	return nil
+}
+
+// isReadonly returns true if the Transaction wraps a txn.ReadonlyTransaction, false otherwise.
+func (transaction *Transaction) isReadonly() bool {
+	return transaction.readonlyTransaction != nil
+}
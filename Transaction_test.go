@@ -0,0 +1,110 @@
+package serialized_snapshot_isolation
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"serialized-snapshot-isolation/txn/errors"
+	"testing"
+)
+
+func TestCommitsAReadWriteTransaction(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, err := db.NewTransaction(context.Background(), true)
+	assert.Nil(t, err)
+	defer transaction.Discard()
+
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	value, exists, err := transaction.Get([]byte("HDD"))
+	assert.Nil(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	<-doneChannel
+
+	assert.Equal(t, 1, db.oracle.CommittedTransactionLength())
+}
+
+func TestCommitsAReadonlyTransaction(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, err := db.NewTransaction(context.Background(), false)
+	assert.Nil(t, err)
+
+	_, exists, err := transaction.Get([]byte("HDD"))
+	assert.Nil(t, err)
+	assert.Equal(t, false, exists)
+
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	<-doneChannel
+}
+
+func TestAttemptsToWriteInAReadonlyTransaction(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, _ := db.NewTransaction(context.Background(), false)
+	defer transaction.Discard()
+
+	err := transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	assert.Error(t, err)
+	assert.Equal(t, ReadonlyTransactionWriteErr, err)
+
+	err = transaction.Delete([]byte("HDD"))
+	assert.Error(t, err)
+	assert.Equal(t, ReadonlyTransactionWriteErr, err)
+}
+
+func TestAttemptsToUseADiscardedTransaction(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	transaction.Discard()
+	transaction.Discard()
+
+	_, _, err := transaction.Get([]byte("HDD"))
+	assert.Equal(t, TransactionAlreadyFinishedErr, err)
+
+	err = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	assert.Equal(t, TransactionAlreadyFinishedErr, err)
+
+	_, err = transaction.Commit(context.Background())
+	assert.Equal(t, TransactionAlreadyFinishedErr, err)
+}
+
+func TestAttemptsToUseACommittedTransaction(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	doneChannel, _ := transaction.Commit(context.Background())
+	<-doneChannel
+
+	transaction.Discard()
+
+	_, err := transaction.Commit(context.Background())
+	assert.Equal(t, TransactionAlreadyFinishedErr, err)
+}
+
+func TestDiscardsAnEmptyReadWriteTransactionAfterAFailedCommit(t *testing.T) {
+	db := NewKeyValueDb(10)
+
+	transaction, _ := db.NewTransaction(context.Background(), true)
+	_, err := transaction.Commit(context.Background())
+	assert.Equal(t, errors.EmptyTransactionErr, err)
+
+	transaction.Discard()
+	_, _, err = transaction.Get([]byte("HDD"))
+	assert.Equal(t, TransactionAlreadyFinishedErr, err)
+}
+
+func TestAttemptsToCreateATransactionInAStoppedDb(t *testing.T) {
+	db := NewKeyValueDb(10)
+	db.Stop()
+
+	_, err := db.NewTransaction(context.Background(), true)
+	assert.Error(t, err)
+	assert.Equal(t, DbAlreadyStoppedErr, err)
+}
@@ -0,0 +1,269 @@
+package checkpoint
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var CorruptCheckpointErr = errors.New("checkpoint is corrupt, checksum mismatch")
+var NoValidCheckpointErr = errors.New("none of the checkpoints in the directory is valid")
+
+const (
+	filePrefix    = "checkpoint-"
+	fileExtension = ".ckpt"
+	footerSize    = 8 + 8 + 4 + 4
+	magic         = uint32(0x53534943)
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Writer writes a point-in-time checkpoint: all the key/value pairs visible at a timestamp, along with the version
+// (commitTimestamp) of every key.
+// A checkpoint file is encoded as:
+// | entry ... | footer |
+// where every entry is:
+// | version (uint64) | key length (uint32) | key | value length (uint32) | value |
+// and the footer is:
+// | number of entries (uint64) | timestamp (uint64) | crc32 of all the entries (uint32) | magic (uint32) |
+// All the integers are encoded in little-endian.
+//
+// The checkpoint is written to a temporary file which is synced and renamed to `checkpoint-<timestamp>.ckpt` in Finish,
+// so a checkpoint file is either complete or absent.
+type Writer struct {
+	directory  string
+	timestamp  uint64
+	file       *os.File
+	writer     *bufio.Writer
+	checksum   hash.Hash32
+	entryCount uint64
+}
+
+// NewWriter creates a new Writer for the checkpoint of the timestamp in the directory.
+// The timestamp is the commitTimestamp till which all the commits are a part of the checkpoint.
+func NewWriter(directory string, timestamp uint64) (*Writer, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(directory, filePrefix+"*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	checksum := crc32.New(crcTable)
+	return &Writer{
+		directory: directory,
+		timestamp: timestamp,
+		file:      file,
+		writer:    bufio.NewWriter(io.MultiWriter(file, checksum)),
+		checksum:  checksum,
+	}, nil
+}
+
+// Add adds the key/value pair with its version to the checkpoint.
+func (writer *Writer) Add(key []byte, version uint64, value []byte) error {
+	var encodedVersion [8]byte
+	binary.LittleEndian.PutUint64(encodedVersion[:], version)
+	if _, err := writer.writer.Write(encodedVersion[:]); err != nil {
+		return err
+	}
+	for _, bytes := range [][]byte{key, value} {
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(bytes)))
+		if _, err := writer.writer.Write(length[:]); err != nil {
+			return err
+		}
+		if _, err := writer.writer.Write(bytes); err != nil {
+			return err
+		}
+	}
+	writer.entryCount++
+	return nil
+}
+
+// Finish writes the footer, syncs the checkpoint file and renames it to its final name.
+// It returns the path of the checkpoint file.
+func (writer *Writer) Finish() (string, error) {
+	if err := writer.writer.Flush(); err != nil {
+		writer.Abort()
+		return "", err
+	}
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer[0:], writer.entryCount)
+	binary.LittleEndian.PutUint64(footer[8:], writer.timestamp)
+	binary.LittleEndian.PutUint32(footer[16:], writer.checksum.Sum32())
+	binary.LittleEndian.PutUint32(footer[20:], magic)
+
+	if _, err := writer.file.Write(footer); err != nil {
+		writer.Abort()
+		return "", err
+	}
+	if err := writer.file.Sync(); err != nil {
+		writer.Abort()
+		return "", err
+	}
+	if err := writer.file.Close(); err != nil {
+		_ = os.Remove(writer.file.Name())
+		return "", err
+	}
+	path := filepath.Join(writer.directory, fileNameFor(writer.timestamp))
+	if err := os.Rename(writer.file.Name(), path); err != nil {
+		_ = os.Remove(writer.file.Name())
+		return "", err
+	}
+	return path, syncDirectory(writer.directory)
+}
+
+// Abort discards the checkpoint that is being written.
+func (writer *Writer) Abort() {
+	_ = writer.file.Close()
+	_ = os.Remove(writer.file.Name())
+}
+
+// LoadLatest loads the newest valid checkpoint in the directory and invokes the callback for each of its key/value pairs,
+// along with the version of the key.
+// It returns the timestamp of the loaded checkpoint and true, or (0, false) if there is no checkpoint in the directory.
+// A checkpoint is verified against its checksum before any of its pairs is passed to the callback. If the newest
+// checkpoint is corrupt, LoadLatest falls back to the next older checkpoint.
+func LoadLatest(directory string, callback func(key []byte, version uint64, value []byte) error) (uint64, bool, error) {
+	timestamps, err := listTimestamps(directory)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(timestamps) == 0 {
+		return 0, false, nil
+	}
+	for index := len(timestamps) - 1; index >= 0; index-- {
+		path := filepath.Join(directory, fileNameFor(timestamps[index]))
+		timestamp, err := load(path, callback)
+		if errors.Is(err, CorruptCheckpointErr) {
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		return timestamp, true, nil
+	}
+	return 0, false, NoValidCheckpointErr
+}
+
+// load verifies the checkpoint file and invokes the callback for each of its key/value pairs.
+func load(path string, callback func(key []byte, version uint64, value []byte) error) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < footerSize {
+		return 0, CorruptCheckpointErr
+	}
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, info.Size()-footerSize); err != nil {
+		return 0, err
+	}
+	if binary.LittleEndian.Uint32(footer[20:]) != magic {
+		return 0, CorruptCheckpointErr
+	}
+	entryCount := binary.LittleEndian.Uint64(footer[0:])
+	timestamp := binary.LittleEndian.Uint64(footer[8:])
+	expectedChecksum := binary.LittleEndian.Uint32(footer[16:])
+
+	entriesSize := info.Size() - footerSize
+	checksum := crc32.New(crcTable)
+	if _, err := io.Copy(checksum, io.NewSectionReader(file, 0, entriesSize)); err != nil {
+		return 0, err
+	}
+	if checksum.Sum32() != expectedChecksum {
+		return 0, CorruptCheckpointErr
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, 0, entriesSize))
+	for count := uint64(0); count < entryCount; count++ {
+		var version [8]byte
+		if _, err := io.ReadFull(reader, version[:]); err != nil {
+			return 0, CorruptCheckpointErr
+		}
+		key, err := readBytes(reader)
+		if err != nil {
+			return 0, CorruptCheckpointErr
+		}
+		value, err := readBytes(reader)
+		if err != nil {
+			return 0, CorruptCheckpointErr
+		}
+		if err := callback(key, binary.LittleEndian.Uint64(version[:]), value); err != nil {
+			return 0, err
+		}
+	}
+	return timestamp, nil
+}
+
+// readBytes reads a length prefixed byte slice.
+func readBytes(reader io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(reader, length[:]); err != nil {
+		return nil, err
+	}
+	bytes := make([]byte, binary.LittleEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(reader, bytes); err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+// listTimestamps returns the timestamps of all the checkpoint files in the directory, in the increasing order.
+func listTimestamps(directory string) ([]uint64, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var timestamps []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileExtension) {
+			continue
+		}
+		timestamp, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps, nil
+}
+
+// fileNameFor returns the name of the checkpoint file for the timestamp.
+func fileNameFor(timestamp uint64) string {
+	return fmt.Sprintf("%s%020d%s", filePrefix, timestamp, fileExtension)
+}
+
+// syncDirectory syncs the directory, so that the rename of the checkpoint file is durable.
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dir.Close()
+	}()
+	return dir.Sync()
+}
@@ -0,0 +1,101 @@
+package checkpoint
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type pair struct {
+	key     string
+	version uint64
+	value   string
+}
+
+func writeCheckpoint(t *testing.T, directory string, timestamp uint64, pairs ...pair) string {
+	writer, err := NewWriter(directory, timestamp)
+	assert.Nil(t, err)
+	for _, pair := range pairs {
+		assert.Nil(t, writer.Add([]byte(pair.key), pair.version, []byte(pair.value)))
+	}
+	path, err := writer.Finish()
+	assert.Nil(t, err)
+	return path
+}
+
+func loadLatest(t *testing.T, directory string) (uint64, bool, []pair, error) {
+	var pairs []pair
+	timestamp, found, err := LoadLatest(directory, func(key []byte, version uint64, value []byte) error {
+		pairs = append(pairs, pair{key: string(key), version: version, value: string(value)})
+		return nil
+	})
+	return timestamp, found, pairs, err
+}
+
+func TestWritesAndLoadsACheckpoint(t *testing.T) {
+	directory := t.TempDir()
+	writeCheckpoint(t, directory, 5, pair{"HDD", 2, "Hard disk"}, pair{"SSD", 5, "Solid state"})
+
+	timestamp, found, pairs, err := loadLatest(t, directory)
+	assert.Nil(t, err)
+	assert.Equal(t, true, found)
+	assert.Equal(t, uint64(5), timestamp)
+	assert.Equal(t, []pair{{"HDD", 2, "Hard disk"}, {"SSD", 5, "Solid state"}}, pairs)
+}
+
+func TestLoadsTheNewestCheckpoint(t *testing.T) {
+	directory := t.TempDir()
+	writeCheckpoint(t, directory, 5, pair{"HDD", 3, "Hard disk"})
+	writeCheckpoint(t, directory, 12, pair{"HDD", 10, "Hard disk drive"})
+
+	timestamp, _, pairs, err := loadLatest(t, directory)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(12), timestamp)
+	assert.Equal(t, []pair{{"HDD", 10, "Hard disk drive"}}, pairs)
+}
+
+func TestLoadsFromADirectoryWithoutCheckpoints(t *testing.T) {
+	_, found, _, err := loadLatest(t, t.TempDir())
+	assert.Nil(t, err)
+	assert.Equal(t, false, found)
+}
+
+func TestFallsBackToAnOlderCheckpointGivenTheNewestIsCorrupt(t *testing.T) {
+	directory := t.TempDir()
+	writeCheckpoint(t, directory, 5, pair{"HDD", 3, "Hard disk"})
+	path := writeCheckpoint(t, directory, 12, pair{"HDD", 10, "Hard disk drive"})
+
+	contents, _ := os.ReadFile(path)
+	contents[5] = contents[5] + 1
+	_ = os.WriteFile(path, contents, 0644)
+
+	timestamp, _, pairs, err := loadLatest(t, directory)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), timestamp)
+	assert.Equal(t, []pair{{"HDD", 3, "Hard disk"}}, pairs)
+}
+
+func TestLoadsADirectoryWithOnlyACorruptCheckpoint(t *testing.T) {
+	directory := t.TempDir()
+	path := writeCheckpoint(t, directory, 5, pair{"HDD", 3, "Hard disk"})
+	_ = os.Truncate(path, 10)
+
+	_, _, _, err := loadLatest(t, directory)
+	assert.Error(t, err)
+	assert.Equal(t, NoValidCheckpointErr, err)
+}
+
+func TestAbortsACheckpoint(t *testing.T) {
+	directory := t.TempDir()
+	writer, _ := NewWriter(directory, 5)
+	_ = writer.Add([]byte("HDD"), 1, []byte("Hard disk"))
+	writer.Abort()
+
+	entries, _ := os.ReadDir(directory)
+	assert.Equal(t, 0, len(entries))
+
+	_, found, _, _ := loadLatest(t, directory)
+	assert.Equal(t, false, found)
+	assert.NoFileExists(t, filepath.Join(directory, fileNameFor(5)))
+}
@@ -0,0 +1,18 @@
+package metrics
+
+import "sync/atomic"
+
+// Counter is a monotonically increasing count (for example, the number of commits), which is safe for concurrent use.
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Increment increments the Counter by 1.
+func (counter *Counter) Increment() {
+	counter.value.Add(1)
+}
+
+// Value returns the current value of the Counter.
+func (counter *Counter) Value() uint64 {
+	return counter.value.Load()
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBounds are the upper bounds of the buckets of a latency Histogram, from 50 microseconds to 2.5 seconds.
+var DefaultLatencyBounds = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// Histogram counts the observed durations in buckets, in the style of a Prometheus histogram.
+// Every bucket has an (inclusive) upper bound, and the last bucket (+Inf) counts the durations beyond the largest bound.
+// Observe is lock-free: the bucket counts, the count and the sum are atomic, so a HistogramSnapshot taken during an Observe
+// may be off by that single observation.
+type Histogram struct {
+	bounds  []time.Duration
+	buckets []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64
+}
+
+// NewHistogram creates a new instance of Histogram with the bounds, which must be in the increasing order.
+func NewHistogram(bounds []time.Duration) *Histogram {
+	return &Histogram{
+		bounds:  bounds,
+		buckets: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+// NewLatencyHistogram creates a new instance of Histogram with the DefaultLatencyBounds.
+func NewLatencyHistogram() *Histogram {
+	return NewHistogram(DefaultLatencyBounds)
+}
+
+// Observe adds the duration to the first bucket with the bound >= duration.
+func (histogram *Histogram) Observe(duration time.Duration) {
+	bucket := len(histogram.bounds)
+	for index, bound := range histogram.bounds {
+		if duration <= bound {
+			bucket = index
+			break
+		}
+	}
+	histogram.buckets[bucket].Add(1)
+	histogram.count.Add(1)
+	histogram.sum.Add(int64(duration))
+}
+
+// Snapshot returns a HistogramSnapshot of the Histogram.
+func (histogram *Histogram) Snapshot() HistogramSnapshot {
+	bucketCounts := make([]uint64, len(histogram.buckets))
+	for index := range histogram.buckets {
+		bucketCounts[index] = histogram.buckets[index].Load()
+	}
+	return HistogramSnapshot{
+		Bounds:       histogram.bounds,
+		BucketCounts: bucketCounts,
+		Count:        histogram.count.Load(),
+		Sum:          time.Duration(histogram.sum.Load()),
+	}
+}
+
+// HistogramSnapshot is a point-in-time copy of a Histogram.
+// BucketCounts has one count per bound, followed by the count of the +Inf bucket; the counts are not cumulative.
+type HistogramSnapshot struct {
+	Bounds       []time.Duration
+	BucketCounts []uint64
+	Count        uint64
+	Sum          time.Duration
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestObservesDurationsInTheirBuckets(t *testing.T) {
+	histogram := NewHistogram([]time.Duration{time.Millisecond, 10 * time.Millisecond})
+	histogram.Observe(500 * time.Microsecond)
+	histogram.Observe(time.Millisecond)
+	histogram.Observe(5 * time.Millisecond)
+	histogram.Observe(time.Second)
+
+	snapshot := histogram.Snapshot()
+
+	assert.Equal(t, []uint64{2, 1, 1}, snapshot.BucketCounts)
+	assert.Equal(t, uint64(4), snapshot.Count)
+	assert.Equal(t, 1006500*time.Microsecond, snapshot.Sum)
+}
+
+func TestIncrementsACounter(t *testing.T) {
+	var counter Counter
+	counter.Increment()
+	counter.Increment()
+
+	assert.Equal(t, uint64(2), counter.Value())
+}
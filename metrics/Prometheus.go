@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// PrometheusWriter writes the metrics in the Prometheus text exposition format (version 0.0.4).
+// The first error from the underlying io.Writer is retained, and all the later writes are skipped; Err returns it.
+type PrometheusWriter struct {
+	writer io.Writer
+	err    error
+}
+
+// PrometheusContentType is the content type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// NewPrometheusWriter creates a new instance of PrometheusWriter that writes to the writer.
+func NewPrometheusWriter(writer io.Writer) *PrometheusWriter {
+	return &PrometheusWriter{writer: writer}
+}
+
+// WriteCounter writes a counter metric with the name, the help text and the value.
+func (prometheusWriter *PrometheusWriter) WriteCounter(name, help string, value uint64) {
+	prometheusWriter.writeHeader(name, help, "counter")
+	prometheusWriter.printf("%s %d\n", name, value)
+}
+
+// WriteGauge writes a gauge metric with the name, the help text and the value.
+func (prometheusWriter *PrometheusWriter) WriteGauge(name, help string, value uint64) {
+	prometheusWriter.writeHeader(name, help, "gauge")
+	prometheusWriter.printf("%s %d\n", name, value)
+}
+
+// WriteHistogram writes a histogram metric with the name, the help text and the HistogramSnapshot.
+// The bounds and the sum are written in seconds, and the buckets are cumulative, as expected by Prometheus.
+// The count is the sum of all the buckets (which is also the +Inf bucket), so that the output is consistent even if the
+// snapshot was taken during an observation.
+func (prometheusWriter *PrometheusWriter) WriteHistogram(name, help string, snapshot HistogramSnapshot) {
+	prometheusWriter.writeHeader(name, help, "histogram")
+
+	var cumulativeCount uint64
+	for index, bound := range snapshot.Bounds {
+		cumulativeCount = cumulativeCount + snapshot.BucketCounts[index]
+		prometheusWriter.printf("%s_bucket{le=\"%s\"} %d\n", name, formatSeconds(bound.Seconds()), cumulativeCount)
+	}
+	cumulativeCount = cumulativeCount + snapshot.BucketCounts[len(snapshot.Bounds)]
+	prometheusWriter.printf("%s_bucket{le=\"+Inf\"} %d\n", name, cumulativeCount)
+	prometheusWriter.printf("%s_sum %s\n", name, formatSeconds(snapshot.Sum.Seconds()))
+	prometheusWriter.printf("%s_count %d\n", name, cumulativeCount)
+}
+
+// Err returns the first error from the underlying io.Writer, nil if there is no error.
+func (prometheusWriter *PrometheusWriter) Err() error {
+	return prometheusWriter.err
+}
+
+// writeHeader writes the HELP and the TYPE lines of a metric.
+func (prometheusWriter *PrometheusWriter) writeHeader(name, help, metricType string) {
+	prometheusWriter.printf("# HELP %s %s\n", name, help)
+	prometheusWriter.printf("# TYPE %s %s\n", name, metricType)
+}
+
+// printf writes the formatted line, unless an earlier write has failed.
+func (prometheusWriter *PrometheusWriter) printf(format string, arguments ...any) {
+	if prometheusWriter.err != nil {
+		return
+	}
+	_, prometheusWriter.err = fmt.Fprintf(prometheusWriter.writer, format, arguments...)
+}
+
+// formatSeconds formats the seconds with the shortest representation that parses back to the same value.
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'g', -1, 64)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWritesACounterAndAGaugeInThePrometheusTextFormat(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := NewPrometheusWriter(&buffer)
+	writer.WriteCounter("commits_total", "Commits.", 10)
+	writer.WriteGauge("next_timestamp", "Next timestamp.", 11)
+
+	assert.Nil(t, writer.Err())
+	assert.Equal(t,
+		"# HELP commits_total Commits.\n"+
+			"# TYPE commits_total counter\n"+
+			"commits_total 10\n"+
+			"# HELP next_timestamp Next timestamp.\n"+
+			"# TYPE next_timestamp gauge\n"+
+			"next_timestamp 11\n",
+		buffer.String(),
+	)
+}
+
+func TestWritesAHistogramWithCumulativeBucketsInThePrometheusTextFormat(t *testing.T) {
+	histogram := NewHistogram([]time.Duration{time.Millisecond, 250 * time.Millisecond})
+	histogram.Observe(500 * time.Microsecond)
+	histogram.Observe(100 * time.Millisecond)
+	histogram.Observe(time.Second)
+
+	var buffer bytes.Buffer
+	writer := NewPrometheusWriter(&buffer)
+	writer.WriteHistogram("commit_latency_seconds", "Commit latency.", histogram.Snapshot())
+
+	assert.Nil(t, writer.Err())
+	assert.Equal(t,
+		"# HELP commit_latency_seconds Commit latency.\n"+
+			"# TYPE commit_latency_seconds histogram\n"+
+			"commit_latency_seconds_bucket{le=\"0.001\"} 1\n"+
+			"commit_latency_seconds_bucket{le=\"0.25\"} 2\n"+
+			"commit_latency_seconds_bucket{le=\"+Inf\"} 3\n"+
+			"commit_latency_seconds_sum 1.1005\n"+
+			"commit_latency_seconds_count 3\n",
+		buffer.String(),
+	)
+}
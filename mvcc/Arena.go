@@ -0,0 +1,93 @@
+package mvcc
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	// DefaultArenaChunkSize is the size of every chunk of the Arena that is created by NewMemTable.
+	DefaultArenaChunkSize = 1 << 20
+	// arenaAlignment is the alignment of every allocation, so that the uint64 fields of the nodes can be accessed atomically.
+	arenaAlignment = 8
+	// nilOffset is never handed out by the Arena, and it represents a nil node.
+	nilOffset = uint64(0)
+)
+
+// Arena is an append-only allocator that packs the SkiplistNodes, their keys and their values into large preallocated byte
+// buffers (chunks). Everything in the Arena is addressed by an offset: the index of the chunk in the upper 32 bits and the
+// position inside the chunk in the lower 32 bits. This keeps the number of heap objects (and hence the work of the Go GC)
+// independent of the number of versions held by the MemTable.
+//
+// Allocation is guarded by `allocationLock`; the chunks are published with an atomic pointer (copied on every new chunk),
+// so reading from the Arena never blocks. An allocation that does not fit in the remaining space of the current chunk
+// starts a new chunk, and an allocation that is larger than the chunk size gets a chunk of its own.
+// Memory is never freed individually; all the chunks are released together when the Arena is no longer referenced.
+type Arena struct {
+	allocationLock sync.Mutex
+	chunks         atomic.Pointer[[][]byte]
+	chunkSize      int
+	position       int
+	size           atomic.Uint64
+}
+
+// NewArena creates a new instance of Arena with chunks of chunkSize bytes.
+// The first arenaAlignment bytes of the first chunk are reserved, so that no allocation gets the nilOffset.
+func NewArena(chunkSize int) *Arena {
+	arena := &Arena{chunkSize: chunkSize}
+	chunks := [][]byte{make([]byte, chunkSize)}
+	arena.chunks.Store(&chunks)
+	arena.position = arenaAlignment
+	arena.size.Store(arenaAlignment)
+	return arena
+}
+
+// Size returns the exact number of bytes allocated from the Arena, including the alignment padding.
+func (arena *Arena) Size() uint64 {
+	return arena.size.Load()
+}
+
+// allocate allocates size bytes (rounded up to the arenaAlignment) and returns the offset of the allocation.
+func (arena *Arena) allocate(size int) uint64 {
+	alignedSize := (size + arenaAlignment - 1) &^ (arenaAlignment - 1)
+
+	arena.allocationLock.Lock()
+	defer arena.allocationLock.Unlock()
+
+	chunks := *arena.chunks.Load()
+	current := chunks[len(chunks)-1]
+	if arena.position+alignedSize > len(current) {
+		chunkSize := arena.chunkSize
+		if alignedSize > chunkSize {
+			chunkSize = alignedSize
+		}
+		grownChunks := make([][]byte, len(chunks), len(chunks)+1)
+		copy(grownChunks, chunks)
+		grownChunks = append(grownChunks, make([]byte, chunkSize))
+		arena.chunks.Store(&grownChunks)
+		chunks, arena.position = grownChunks, 0
+	}
+	offset := uint64(len(chunks)-1)<<32 | uint64(arena.position)
+	arena.position = arena.position + alignedSize
+	arena.size.Add(uint64(alignedSize))
+	return offset
+}
+
+// bytes returns the length bytes at the offset. The returned slice shares the memory of the Arena.
+func (arena *Arena) bytes(offset uint64, length int) []byte {
+	chunk, position := arena.locate(offset)
+	return chunk[position : position+length : position+length]
+}
+
+// uint64At returns a pointer to the (aligned) uint64 at the offset, which can be accessed atomically.
+func (arena *Arena) uint64At(offset uint64) *uint64 {
+	chunk, position := arena.locate(offset)
+	return (*uint64)(unsafe.Pointer(&chunk[position]))
+}
+
+// locate returns the chunk and the position inside the chunk for the offset.
+func (arena *Arena) locate(offset uint64) ([]byte, int) {
+	chunks := *arena.chunks.Load()
+	return chunks[offset>>32], int(offset & 0xFFFFFFFF)
+}
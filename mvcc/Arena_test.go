@@ -0,0 +1,71 @@
+package mvcc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestArenaNeverAllocatesTheNilOffset(t *testing.T) {
+	arena := NewArena(64)
+	offset := arena.allocate(8)
+
+	assert.NotEqual(t, nilOffset, offset)
+}
+
+func TestArenaAlignsTheAllocations(t *testing.T) {
+	arena := NewArena(64)
+	first := arena.allocate(3)
+	second := arena.allocate(5)
+
+	assert.Equal(t, uint64(0), first%arenaAlignment)
+	assert.Equal(t, uint64(0), second%arenaAlignment)
+	assert.Equal(t, first+arenaAlignment, second)
+}
+
+func TestArenaReportsTheExactAllocatedSize(t *testing.T) {
+	arena := NewArena(64)
+	arena.allocate(3)
+	arena.allocate(16)
+
+	assert.Equal(t, uint64(arenaAlignment+8+16), arena.Size())
+}
+
+func TestArenaStartsANewChunkWhenTheAllocationDoesNotFit(t *testing.T) {
+	arena := NewArena(64)
+	arena.allocate(48)
+	offset := arena.allocate(16)
+
+	assert.Equal(t, uint64(1), offset>>32)
+	assert.Equal(t, uint64(0), offset&0xFFFFFFFF)
+}
+
+func TestArenaAllocatesAChunkOfItsOwnForALargeAllocation(t *testing.T) {
+	arena := NewArena(64)
+	offset := arena.allocate(200)
+
+	copy(arena.bytes(offset, 200), make([]byte, 200))
+	assert.Equal(t, 200, len(arena.bytes(offset, 200)))
+	assert.Equal(t, uint64(1), offset>>32)
+}
+
+func TestArenaKeepsTheBytesAcrossChunks(t *testing.T) {
+	arena := NewArena(32)
+	first := arena.allocate(5)
+	copy(arena.bytes(first, 5), "first")
+	second := arena.allocate(24)
+	copy(arena.bytes(second, 6), "second")
+
+	assert.Equal(t, []byte("first"), arena.bytes(first, 5))
+	assert.Equal(t, []byte("second"), arena.bytes(second, 6))
+}
+
+func TestMemTableReportsItsSizeFromTheArena(t *testing.T) {
+	memTable := NewMemTable(10)
+	sizeBeforePut := memTable.Size()
+
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+
+	node := memTable.head.next()
+	assert.Equal(t, sizeBeforePut+node.size(), memTable.Size())
+	assert.Equal(t, uint64(0), memTable.Size()%arenaAlignment)
+}
@@ -0,0 +1,18 @@
+package mvcc
+
+// CollectedVersions represents the obsolete versions that are removed by a version collection: the number of versions,
+// and the number of bytes that the removed versions take in the Arena of their MemTables (UnlinkedBytes).
+// The Arena is append-only, so the UnlinkedBytes are not freed by the collection itself; they are a part of the Size of the
+// MemTable till the MemTable is compacted into a new Arena (Storage.MayBeCompact), or dropped after it is flushed to an SSTable.
+type CollectedVersions struct {
+	Versions      uint64
+	UnlinkedBytes uint64
+}
+
+// Add returns the sum of the two CollectedVersions.
+func (collectedVersions CollectedVersions) Add(other CollectedVersions) CollectedVersions {
+	return CollectedVersions{
+		Versions:      collectedVersions.Versions + other.Versions,
+		UnlinkedBytes: collectedVersions.UnlinkedBytes + other.UnlinkedBytes,
+	}
+}
@@ -0,0 +1,28 @@
+package mvcc
+
+// KeyVersion represents a version of a key: the commitTimestamp that wrote the version and its Value.
+// The Value of a deleted version is a tombstone.
+type KeyVersion struct {
+	commitTimestamp uint64
+	value           Value
+}
+
+// newKeyVersion creates a new instance of KeyVersion.
+func newKeyVersion(key VersionedKey, value Value) KeyVersion {
+	return KeyVersion{commitTimestamp: key.getVersion(), value: value}
+}
+
+// CommitTimestamp returns the commitTimestamp of the version.
+func (keyVersion KeyVersion) CommitTimestamp() uint64 {
+	return keyVersion.commitTimestamp
+}
+
+// Value returns the Value of the version.
+func (keyVersion KeyVersion) Value() Value {
+	return keyVersion.value
+}
+
+// IsTombstone returns true if the key was deleted in this version.
+func (keyVersion KeyVersion) IsTombstone() bool {
+	return keyVersion.value.IsDeleted()
+}
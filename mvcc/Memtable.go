@@ -2,37 +2,128 @@ package mvcc
 
 import (
 	"serialized-snapshot-isolation/mvcc/utils"
-	"sync"
+	"sync/atomic"
 )
 
 // MemTable is an in-memory structure built on top of SkipList.
+// The SkipList is lock-free (More on this in SkiplistNode): reads never block, the insertions do not block each other, and
+// the version collection (CollectVersionsBelow) removes the nodes without blocking the insertions or the reads.
+// All the nodes, keys and values of the SkipList are allocated from the `arena` of the MemTable (More on this in Arena).
+// `nodes` is the number of versions linked in the SkipList: it grows with the insertions and shrinks with the version collection.
+// `unlinkedBytes` is the number of bytes of the Arena taken by the versions removed by the version collection, and by the nodes
+// that lost the insertion race to a concurrent insertion of the same version of a key. The Arena is append-only, so these bytes
+// come back only when the MemTable is compacted into a new Arena (More on this in compact), or
+// when the whole MemTable is dropped after it is flushed to an SSTable.
 type MemTable struct {
-	lock           sync.RWMutex
-	head           *SkiplistNode
+	arena          *Arena
+	nodes          atomic.Uint64
+	unlinkedBytes  atomic.Uint64
+	head           SkiplistNode
 	levelGenerator utils.LevelGenerator
 }
 
 // NewMemTable creates a new instance of MemTable.
 func NewMemTable(maxLevel uint8) *MemTable {
+	arena := NewArena(DefaultArenaChunkSize)
 	return &MemTable{
-		head:           newSkiplistNode(emptyVersionedKey(), emptyValue(), maxLevel),
+		arena:          arena,
+		head:           newSkiplistNode(arena, emptyVersionedKey(), emptyValue(), maxLevel),
 		levelGenerator: utils.NewLevelGenerator(maxLevel),
 	}
 }
 
 // PutOrUpdate puts or updates the key and the value pair in the SkipList.
 func (memTable *MemTable) PutOrUpdate(key VersionedKey, value Value) {
-	memTable.lock.Lock()
-	defer memTable.lock.Unlock()
+	memTable.putOrUpdate(key, value)
+}
+
+// PutOrUpdateAll puts or updates all the key and value pairs in the SkipList.
+func (memTable *MemTable) PutOrUpdateAll(pairs []VersionedKeyValue) {
+	for _, pair := range pairs {
+		memTable.putOrUpdate(pair.key, pair.value)
+	}
+}
+
+// putOrUpdate puts the key and the value pair in the SkipList, and counts the linked node, or the bytes of the node that lost
+// the insertion race (More on this in SkiplistNode.putOrUpdate) as unlinked.
+func (memTable *MemTable) putOrUpdate(key VersionedKey, value Value) {
+	linked, wastedBytes := memTable.head.putOrUpdate(key, value, memTable.levelGenerator)
+	if linked {
+		memTable.nodes.Add(1)
+		return
+	}
+	memTable.unlinkedBytes.Add(wastedBytes)
+}
 
-	memTable.head.putOrUpdate(key, value, memTable.levelGenerator)
+// CollectVersionsBelow removes the versions of every key that are older than the newest version of the key which is less
+// than the watermark, and returns the CollectedVersions. (More on this in SkiplistNode.collectVersionsBelow).
+// The removed versions are only unlinked from the SkipList: the Arena is append-only, so the collection does not reduce the
+// Size of the MemTable. The UnlinkedBytes of the CollectedVersions are freed when the MemTable is compacted, or dropped.
+// The watermark must be a timestamp such that no active or future transaction has a beginTimestamp less than it.
+// It runs concurrently with the insertions and the reads.
+func (memTable *MemTable) CollectVersionsBelow(watermark uint64) CollectedVersions {
+	versions, unlinkedBytes := memTable.head.collectVersionsBelow(watermark)
+	memTable.nodes.Add(-versions)
+	memTable.unlinkedBytes.Add(unlinkedBytes)
+	return CollectedVersions{Versions: versions, UnlinkedBytes: unlinkedBytes}
 }
 
 // Get returns a pair of (Value, bool) for the incoming key.
 // It returns (Value, true) if the value exists for the incoming key, else (nil, false).
 func (memTable *MemTable) Get(key VersionedKey) (Value, bool) {
-	memTable.lock.RLock()
-	defer memTable.lock.RUnlock()
-
 	return memTable.head.get(key)
 }
+
+// NodeCount returns the number of versions (of all the keys) in the SkipList.
+func (memTable *MemTable) NodeCount() uint64 {
+	return memTable.nodes.Load()
+}
+
+// Size returns the exact number of bytes allocated from the Arena of the MemTable.
+func (memTable *MemTable) Size() uint64 {
+	return memTable.arena.Size()
+}
+
+// UnlinkedBytes returns the number of bytes of the Arena taken by the versions that are removed by the version collection, and
+// by the nodes that lost the insertion race.
+func (memTable *MemTable) UnlinkedBytes() uint64 {
+	return memTable.unlinkedBytes.Load()
+}
+
+// needsCompaction returns true if the UnlinkedBytes take at least half of the Size of the MemTable, and the MemTable has
+// grown beyond a single chunk of its Arena (a compacted MemTable takes at least one chunk anyway).
+func (memTable *MemTable) needsCompaction() bool {
+	size := memTable.Size()
+	return size > uint64(memTable.arena.chunkSize) && memTable.UnlinkedBytes() >= size/2
+}
+
+// compact returns a new MemTable, with a new Arena, that holds all the versions of the MemTable that are not removed.
+// The MemTable itself is left untouched, so the readers that are still walking it are not affected, and its Arena is
+// released once it is no longer referenced.
+// compact must not run concurrently with the insertions, otherwise the versions inserted during the compaction may be missed.
+func (memTable *MemTable) compact() *MemTable {
+	compacted := NewMemTable(uint8(memTable.head.height()))
+	for node := memTable.head.next(); !node.isNil(); node = node.next() {
+		compacted.PutOrUpdate(node.key(), node.value())
+	}
+	return compacted
+}
+
+// Versions returns the versions of the key with fromVersion <= version <= toVersion in the increasing order of the versions,
+// at most limit of them. It walks the SkiplistNode chain of the key, which holds all the versions next to each other.
+func (memTable *MemTable) Versions(key []byte, fromVersion, toVersion uint64, limit int) []KeyVersion {
+	var versions []KeyVersion
+	for node := memTable.head.seek(NewVersionedKey(key, fromVersion)); !node.isNil() && len(versions) < limit; node = node.next() {
+		if !node.key().matchesKeyPrefix(key) || node.version() > toVersion {
+			break
+		}
+		versions = append(versions, newKeyVersion(node.key(), node.value()))
+	}
+	return versions
+}
+
+// NewIterator creates a new MemTableIterator that yields the keys where version of the key < the incoming version.
+// The iterator is not positioned, Seek needs to be invoked before reading from it.
+func (memTable *MemTable) NewIterator(version uint64) *MemTableIterator {
+	return newMemTableIterator(memTable, version)
+}
@@ -0,0 +1,90 @@
+package mvcc
+
+// MemTableIterator iterates over the keys of the MemTable in the increasing order.
+// SkiplistNode maintains all the versions of a key next to each other (in the increasing order of the versions), and
+// MemTableIterator yields only one version for every key: the latest version that is less than the version of the iterator.
+// The version of the iterator is the beginTimestamp of the transaction that creates the iterator.
+// Keys that have no version less than the version of the iterator are skipped.
+// Tombstones are yielded as they are; it is the responsibility of the caller to skip the deleted keys.
+//
+// MemTableIterator walks the lock-free SkipList without acquiring any lock, so an open iterator never blocks the writes to
+// the MemTable. The keys that are inserted after the iterator moves past their position are not yielded, and they are not
+// visible at the version of the iterator anyway.
+type MemTableIterator struct {
+	memTable *MemTable
+	version  uint64
+	nextNode SkiplistNode
+	key      VersionedKey
+	value    Value
+	valid    bool
+}
+
+// newMemTableIterator creates a new instance of MemTableIterator.
+func newMemTableIterator(memTable *MemTable, version uint64) *MemTableIterator {
+	return &MemTableIterator{
+		memTable: memTable,
+		version:  version,
+	}
+}
+
+// Seek positions the iterator at the first key that is greater than or equal to the incoming key.
+// Seek(nil) positions the iterator at the first key of the MemTable.
+func (iterator *MemTableIterator) Seek(key []byte) {
+	iterator.moveTo(iterator.memTable.head.seek(NewVersionedKey(key, 0)))
+}
+
+// Next moves the iterator to the next key.
+func (iterator *MemTableIterator) Next() {
+	if !iterator.valid {
+		return
+	}
+	iterator.moveTo(iterator.nextNode)
+}
+
+// Valid returns true if the iterator is positioned at a key, false otherwise.
+func (iterator *MemTableIterator) Valid() bool {
+	return iterator.valid
+}
+
+// Key returns the key at the current position of the iterator.
+func (iterator *MemTableIterator) Key() []byte {
+	return iterator.key.getKey()
+}
+
+// Version returns the version (commitTimestamp) of the key at the current position of the iterator.
+func (iterator *MemTableIterator) Version() uint64 {
+	return iterator.key.getVersion()
+}
+
+// Value returns the Value at the current position of the iterator. The Value could be a tombstone.
+func (iterator *MemTableIterator) Value() Value {
+	return iterator.value
+}
+
+// Err always returns nil, reading from a MemTable can not fail.
+func (iterator *MemTableIterator) Err() error {
+	return nil
+}
+
+// moveTo walks all the versions of the key starting at the node, and positions the iterator at the latest version of the key
+// that is less than the version of the iterator. If there is no such version, moveTo continues with the next key.
+func (iterator *MemTableIterator) moveTo(node SkiplistNode) {
+	for !node.isNil() {
+		key := node.key().getKey()
+		var visibleNode SkiplistNode
+		for !node.isNil() && node.key().matchesKeyPrefix(key) {
+			if node.version() < iterator.version {
+				visibleNode = node
+			}
+			node = node.next()
+		}
+		if !visibleNode.isNil() {
+			iterator.key = visibleNode.key()
+			iterator.value = visibleNode.value()
+			iterator.nextNode = node
+			iterator.valid = true
+			return
+		}
+	}
+	iterator.key, iterator.value, iterator.nextNode, iterator.valid = emptyVersionedKey(), emptyValue(), SkiplistNode{}, false
+}
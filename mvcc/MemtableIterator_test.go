@@ -0,0 +1,66 @@
+package mvcc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIteratesOverAnEmptyMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	iterator := memTable.NewIterator(5)
+	iterator.Seek(nil)
+
+	assert.Equal(t, false, iterator.Valid())
+}
+
+func TestIteratesOverTheLatestVersionsOfAllTheKeysInMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 1), NewValue([]byte("Solid state")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 2), NewValue([]byte("Hard disk drive")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("NVMe"), 3), NewValue([]byte("Non volatile memory")))
+
+	iterator := memTable.NewIterator(3)
+	iterator.Seek(nil)
+
+	assert.Equal(t, true, iterator.Valid())
+	assert.Equal(t, []byte("HDD"), iterator.Key())
+	assert.Equal(t, []byte("Hard disk drive"), iterator.Value().Slice())
+
+	iterator.Next()
+	assert.Equal(t, true, iterator.Valid())
+	assert.Equal(t, []byte("SSD"), iterator.Key())
+	assert.Equal(t, []byte("Solid state"), iterator.Value().Slice())
+
+	iterator.Next()
+	assert.Equal(t, false, iterator.Valid())
+}
+
+func TestSeeksAKeyInMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("NVMe"), 1), NewValue([]byte("Non volatile memory")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 1), NewValue([]byte("Solid state")))
+
+	iterator := memTable.NewIterator(2)
+	iterator.Seek([]byte("Memory"))
+
+	assert.Equal(t, true, iterator.Valid())
+	assert.Equal(t, []byte("NVMe"), iterator.Key())
+
+	iterator.Next()
+	assert.Equal(t, []byte("SSD"), iterator.Key())
+}
+
+func TestIteratesOverADeletedKeyInMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 2), NewDeletedValue())
+
+	iterator := memTable.NewIterator(3)
+	iterator.Seek(nil)
+
+	assert.Equal(t, true, iterator.Valid())
+	assert.Equal(t, []byte("HDD"), iterator.Key())
+	assert.Equal(t, true, iterator.Value().IsDeleted())
+}
@@ -0,0 +1,49 @@
+package mvcc
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const benchmarkKeys = 10_000
+
+func benchmarkKey(count int) []byte {
+	return []byte(fmt.Sprintf("Key-%05d", count%benchmarkKeys))
+}
+
+// benchmarkReadsUnderConcurrentWrites runs a single writer (like TransactionExecutor) that keeps adding new versions,
+// and measures the throughput of the parallel readers.
+func benchmarkReadsUnderConcurrentWrites(b *testing.B, memTable *MemTable) {
+	for count := 0; count < benchmarkKeys; count++ {
+		memTable.PutOrUpdate(NewVersionedKey(benchmarkKey(count), 1), NewValue([]byte("value")))
+	}
+
+	var stop atomic.Bool
+	var writerDone sync.WaitGroup
+	writerDone.Add(1)
+	go func() {
+		defer writerDone.Done()
+		for version := uint64(2); !stop.Load(); version++ {
+			memTable.PutOrUpdate(NewVersionedKey(benchmarkKey(int(version)), version), NewValue([]byte("value")))
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		count := 0
+		for pb.Next() {
+			memTable.Get(NewVersionedKey(benchmarkKey(count), 2))
+			count++
+		}
+	})
+	b.StopTimer()
+
+	stop.Store(true)
+	writerDone.Wait()
+}
+
+func BenchmarkReadsUnderConcurrentWritesInMemTable(b *testing.B) {
+	benchmarkReadsUnderConcurrentWrites(b, NewMemTable(16))
+}
@@ -1,9 +1,14 @@
 package mvcc
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"math"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestPutsAKeyValueAndGetByKeyInMemTable(t *testing.T) {
@@ -18,6 +23,23 @@ func TestPutsAKeyValueAndGetByKeyInMemTable(t *testing.T) {
 	assert.Equal(t, []byte("Hard disk"), value.Slice())
 }
 
+func TestPutsAllTheKeyValuesAndGetByKeyInMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdateAll([]VersionedKeyValue{
+		NewVersionedKeyValue(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk"))),
+		NewVersionedKeyValue(NewVersionedKey([]byte("SSD"), 1), NewValue([]byte("Solid state"))),
+		NewVersionedKeyValue(NewVersionedKey([]byte("HDD"), 2), NewDeletedValue()),
+	})
+
+	value, ok := memTable.Get(NewVersionedKey([]byte("SSD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Solid state"), value.Slice())
+
+	value, ok = memTable.Get(NewVersionedKey([]byte("HDD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, value.IsDeleted())
+}
+
 func TestPutsTheSameKeyWithADifferentVersionInMemTable(t *testing.T) {
 	memTable := NewMemTable(10)
 	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
@@ -96,3 +118,273 @@ func TestPutsKeysValuesConcurrentlyInMemtable(t *testing.T) {
 	assert.Equal(t, true, ok)
 	assert.Equal(t, []byte("Solid state"), value.Slice())
 }
+
+func TestCountsTheNodeThatLosesTheInsertionRaceAsUnlinkedBytesInMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	var wg sync.WaitGroup
+
+	memTable.arena.allocationLock.Lock()
+	wg.Add(2)
+	for count := 0; count < 2; count++ {
+		go func() {
+			defer wg.Done()
+			memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	memTable.arena.allocationLock.Unlock()
+	wg.Wait()
+
+	assert.Equal(t, uint64(1), memTable.NodeCount())
+	assert.True(t, memTable.UnlinkedBytes() > 0)
+
+	linkedBytes := uint64(arenaAlignment) + memTable.head.size() + memTable.head.next().size()
+	assert.Equal(t, memTable.Size(), linkedBytes+memTable.UnlinkedBytes())
+}
+
+func TestCollectsTheVersionsOlderThanTheNewestVersionBelowTheWatermarkInMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 2), NewValue([]byte("Hard disk drive")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 3), NewValue([]byte("HDD")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 5), NewValue([]byte("Hard drive")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 1), NewValue([]byte("Solid state drive")))
+	sizeBeforeCollection := memTable.Size()
+	assert.Equal(t, uint64(5), memTable.NodeCount())
+
+	collectedVersions := memTable.CollectVersionsBelow(4)
+
+	assert.Equal(t, uint64(2), collectedVersions.Versions)
+	assert.Equal(t, uint64(3), memTable.NodeCount())
+	assert.True(t, collectedVersions.UnlinkedBytes > 0)
+	assert.Equal(t, sizeBeforeCollection, memTable.Size())
+
+	value, ok := memTable.Get(NewVersionedKey([]byte("HDD"), 4))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("HDD"), value.Slice())
+
+	value, ok = memTable.Get(NewVersionedKey([]byte("HDD"), 6))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard drive"), value.Slice())
+
+	value, ok = memTable.Get(NewVersionedKey([]byte("SSD"), 4))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Solid state drive"), value.Slice())
+}
+
+func TestCompactsTheMemTableIntoANewArena(t *testing.T) {
+	memTable := NewMemTable(10)
+	value := make([]byte, 8192)
+	for version := uint64(1); version <= 300; version++ {
+		memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), version), NewValue(append(value, strconv.FormatUint(version, 10)...)))
+	}
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 1), NewValue([]byte("Solid state drive")))
+	assert.Equal(t, false, memTable.needsCompaction())
+
+	collectedVersions := memTable.CollectVersionsBelow(300)
+	assert.Equal(t, uint64(298), collectedVersions.Versions)
+	assert.Equal(t, collectedVersions.UnlinkedBytes, memTable.UnlinkedBytes())
+	assert.Equal(t, true, memTable.needsCompaction())
+
+	compacted := memTable.compact()
+	assert.Equal(t, uint64(3), compacted.NodeCount())
+	assert.Equal(t, uint64(0), compacted.UnlinkedBytes())
+	assert.Less(t, compacted.Size(), memTable.Size()/10)
+
+	hddValue, ok := compacted.Get(NewVersionedKey([]byte("HDD"), 300))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, append(value, "299"...), hddValue.Slice())
+
+	hddValue, ok = compacted.Get(NewVersionedKey([]byte("HDD"), 301))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, append(value, "300"...), hddValue.Slice())
+
+	ssdValue, ok := compacted.Get(NewVersionedKey([]byte("SSD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Solid state drive"), ssdValue.Slice())
+}
+
+func TestDoesNotCompactAMemTableThatFitsInASingleChunk(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 2), NewValue([]byte("Hard disk drive")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 3), NewValue([]byte("HDD")))
+
+	memTable.CollectVersionsBelow(4)
+	assert.Equal(t, false, memTable.needsCompaction())
+}
+
+func TestCollectsVersionsOfManyKeysInMemTable(t *testing.T) {
+	memTable := NewMemTable(16)
+	for version := uint64(1); version <= 20; version++ {
+		for key := 0; key < 100; key++ {
+			memTable.PutOrUpdate(
+				NewVersionedKey([]byte(fmt.Sprintf("Key-%03d", key)), version),
+				NewValue([]byte(fmt.Sprintf("Value-%03d-%02d", key, version))),
+			)
+		}
+	}
+
+	collectedVersions := memTable.CollectVersionsBelow(11)
+	assert.Equal(t, uint64(100*9), collectedVersions.Versions)
+
+	for key := 0; key < 100; key++ {
+		for version := uint64(11); version <= 21; version++ {
+			value, ok := memTable.Get(NewVersionedKey([]byte(fmt.Sprintf("Key-%03d", key)), version))
+			assert.Equal(t, true, ok)
+			assert.Equal(t, []byte(fmt.Sprintf("Value-%03d-%02d", key, version-1)), value.Slice())
+		}
+	}
+
+	iterator := memTable.NewIterator(11)
+	keys := 0
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		assert.Equal(t, uint64(10), iterator.Version())
+		keys++
+	}
+	assert.Equal(t, 100, keys)
+}
+
+func TestGetsTheVersionsOfAKeyInMemTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 3), NewValue([]byte("Hard disk drive")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 4), NewDeletedValue())
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 6), NewValue([]byte("HDD")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 2), NewValue([]byte("Solid state drive")))
+
+	versions := memTable.Versions([]byte("HDD"), 2, 5, 10)
+
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, uint64(3), versions[0].CommitTimestamp())
+	assert.Equal(t, []byte("Hard disk drive"), versions[0].Value().Slice())
+	assert.Equal(t, false, versions[0].IsTombstone())
+	assert.Equal(t, uint64(4), versions[1].CommitTimestamp())
+	assert.Equal(t, true, versions[1].IsTombstone())
+
+	versions = memTable.Versions([]byte("HDD"), 0, 10, 3)
+	assert.Equal(t, 3, len(versions))
+	assert.Equal(t, uint64(1), versions[0].CommitTimestamp())
+}
+
+func TestPutsAndGetsManyKeysConcurrentlyInMemtable(t *testing.T) {
+	memTable := NewMemTable(16)
+	var wg sync.WaitGroup
+
+	const writers, keysPerWriter = 8, 500
+	for writer := 0; writer < writers; writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for count := 0; count < keysPerWriter; count++ {
+				key := []byte(fmt.Sprintf("Key-%d-%03d", writer, count))
+				memTable.PutOrUpdate(NewVersionedKey(key, 1), NewValue(key))
+			}
+		}(writer)
+	}
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for count := 0; count < keysPerWriter; count++ {
+				key := []byte(fmt.Sprintf("Key-0-%03d", count))
+				if value, ok := memTable.Get(NewVersionedKey(key, 2)); ok {
+					assert.Equal(t, key, value.Slice())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	iterator := memTable.NewIterator(2)
+	keys := 0
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		assert.Equal(t, iterator.Key(), iterator.Value().Slice())
+		keys++
+	}
+	assert.Equal(t, writers*keysPerWriter, keys)
+}
+
+func TestCollectsVersionsConcurrentlyWithThePutsAndGetsInMemTable(t *testing.T) {
+	memTable := NewMemTable(16)
+	const writers, keysPerWriter, versions = 4, 10, 200
+
+	var written [writers]atomic.Uint64
+	watermark := func() uint64 {
+		lowest := written[0].Load()
+		for writer := 1; writer < writers; writer++ {
+			if version := written[writer].Load(); version < lowest {
+				lowest = version
+			}
+		}
+		return lowest
+	}
+
+	var writersGroup, othersGroup sync.WaitGroup
+	var writersDone atomic.Bool
+	for writer := 0; writer < writers; writer++ {
+		writersGroup.Add(1)
+		go func(writer int) {
+			defer writersGroup.Done()
+			for version := uint64(1); version <= versions; version++ {
+				for key := 0; key < keysPerWriter; key++ {
+					memTable.PutOrUpdate(
+						NewVersionedKey([]byte(fmt.Sprintf("Key-%d-%02d", writer, key)), version),
+						NewValue([]byte(fmt.Sprintf("%d", version))),
+					)
+				}
+				written[writer].Store(version)
+			}
+		}(writer)
+	}
+	for collector := 0; collector < 2; collector++ {
+		othersGroup.Add(1)
+		go func() {
+			defer othersGroup.Done()
+			for !writersDone.Load() {
+				memTable.CollectVersionsBelow(watermark())
+			}
+		}()
+	}
+	othersGroup.Add(1)
+	go func() {
+		defer othersGroup.Done()
+		for !writersDone.Load() {
+			for writer := 0; writer < writers; writer++ {
+				version := written[writer].Load()
+				if version == 0 {
+					continue
+				}
+				value, ok := memTable.Get(NewVersionedKey([]byte(fmt.Sprintf("Key-%d-00", writer)), math.MaxUint64))
+				assert.Equal(t, true, ok)
+				latestVersion, _ := strconv.ParseUint(string(value.Slice()), 10, 64)
+				assert.GreaterOrEqual(t, latestVersion, version)
+			}
+		}
+	}()
+
+	writersGroup.Wait()
+	writersDone.Store(true)
+	othersGroup.Wait()
+
+	memTable.CollectVersionsBelow(versions + 1)
+	assert.Equal(t, uint64(writers*keysPerWriter), memTable.NodeCount())
+
+	for level := 0; level < memTable.head.height(); level++ {
+		previous := memTable.head
+		for node := previous.loadForward(level); !node.isNil(); previous, node = node, node.loadForward(level) {
+			assert.Equal(t, false, node.isRemovedAt(level))
+			if previous != memTable.head {
+				assert.Equal(t, -1, previous.key().compare(node.key()))
+			}
+		}
+	}
+
+	iterator := memTable.NewIterator(versions + 1)
+	keys := 0
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		assert.Equal(t, uint64(versions), iterator.Version())
+		keys++
+	}
+	assert.Equal(t, writers*keysPerWriter, keys)
+}
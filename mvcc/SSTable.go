@@ -0,0 +1,488 @@
+package mvcc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+var CorruptSSTableErr = errors.New("sstable is corrupt")
+
+const (
+	sstableBlockSize  = 4 * 1024
+	sstableFooterSize = 8 + 4 + 4 + 8 + 8 + 4
+	sstableMagic      = uint32(0x53535354)
+)
+
+var sstableCrcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// sstableEntry is a VersionedKey/Value pair stored in an SSTable.
+type sstableEntry struct {
+	key   VersionedKey
+	value Value
+}
+
+// blockHandle describes a data block of an SSTable: the first key of the block, its position in the file and its checksum.
+type blockHandle struct {
+	firstKey VersionedKey
+	offset   uint64
+	size     uint32
+	checksum uint32
+}
+
+// SSTable is an immutable sorted file that holds all the versions of all the keys of a flushed MemTable.
+// An SSTable file is encoded as:
+// | data block ... | index block | footer |
+// Every data block holds the entries in the order of the SkipList (increasing keys, and increasing versions of a key):
+// | key length (uint32) | key | version (uint64) | deleted (1 byte) | value length (uint32) | value |
+// A data block is cut once it grows beyond 4KB. The index block holds a blockHandle for every data block:
+// | number of blocks (uint32) | key length (uint32) | key | version (uint64) | offset (uint64) | size (uint32) | crc32 (uint32) | ...
+// and the footer is:
+// | index offset (uint64) | index size (uint32) | index crc32 (uint32) | last commit timestamp (uint64) | number of entries (uint64) | magic (uint32) |
+// The last commit timestamp is the commitTimestamp till which all the commits are a part of the SSTable (and the older SSTables).
+//
+// The index is kept in memory, and the data blocks are read from the file when they are needed. All the checksums are
+// verified when an SSTable is opened, and they are verified again whenever a data block is read. A failure to read a data
+// block (an I/O failure, or a block that got corrupt after the SSTable was opened) is returned from Get and Versions, and
+// it ends an SSTableIterator (see SSTableIterator.Err).
+type SSTable struct {
+	path                string
+	file                *os.File
+	index               []blockHandle
+	lastCommitTimestamp uint64
+	entryCount          uint64
+}
+
+// writeSSTable writes all the versions of all the keys of the MemTable to a new SSTable file at the path.
+// The file is written to a temporary file which is synced and renamed to the path, so an SSTable file is either complete or absent.
+func writeSSTable(path string, memTable *MemTable, lastCommitTimestamp uint64) error {
+	temporaryPath := path + ".tmp"
+	file, err := os.Create(temporaryPath)
+	if err != nil {
+		return err
+	}
+	abort := func(err error) error {
+		_ = file.Close()
+		_ = os.Remove(temporaryPath)
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	var index []blockHandle
+	var block []byte
+	var offset, entryCount uint64
+	var blockFirstKey VersionedKey
+
+	flushBlock := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		if _, err := writer.Write(block); err != nil {
+			return err
+		}
+		index = append(index, blockHandle{
+			firstKey: blockFirstKey,
+			offset:   offset,
+			size:     uint32(len(block)),
+			checksum: crc32.Checksum(block, sstableCrcTable),
+		})
+		offset = offset + uint64(len(block))
+		block = block[:0]
+		return nil
+	}
+
+	for node := memTable.head.next(); !node.isNil(); node = node.next() {
+		if len(block) == 0 {
+			blockFirstKey = node.key()
+		}
+		block = appendEntry(block, node.key(), node.value())
+		entryCount++
+		if len(block) >= sstableBlockSize {
+			if err := flushBlock(); err != nil {
+				return abort(err)
+			}
+		}
+	}
+	if err := flushBlock(); err != nil {
+		return abort(err)
+	}
+
+	indexBlock := encodeIndex(index)
+	footer := make([]byte, sstableFooterSize)
+	binary.LittleEndian.PutUint64(footer[0:], offset)
+	binary.LittleEndian.PutUint32(footer[8:], uint32(len(indexBlock)))
+	binary.LittleEndian.PutUint32(footer[12:], crc32.Checksum(indexBlock, sstableCrcTable))
+	binary.LittleEndian.PutUint64(footer[16:], lastCommitTimestamp)
+	binary.LittleEndian.PutUint64(footer[24:], entryCount)
+	binary.LittleEndian.PutUint32(footer[32:], sstableMagic)
+
+	for _, bytes := range [][]byte{indexBlock, footer} {
+		if _, err := writer.Write(bytes); err != nil {
+			return abort(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return abort(err)
+	}
+	if err := file.Sync(); err != nil {
+		return abort(err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(temporaryPath)
+		return err
+	}
+	return os.Rename(temporaryPath, path)
+}
+
+// openSSTable opens the SSTable at the path, loads its index and verifies the checksums of the index and all the data blocks.
+func openSSTable(path string) (*SSTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	table, err := loadSSTable(path, file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return table, nil
+}
+
+// loadSSTable loads the index of the SSTable file and verifies all the checksums.
+func loadSSTable(path string, file *os.File) (*SSTable, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < sstableFooterSize {
+		return nil, CorruptSSTableErr
+	}
+	footer := make([]byte, sstableFooterSize)
+	if _, err := file.ReadAt(footer, info.Size()-sstableFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[32:]) != sstableMagic {
+		return nil, CorruptSSTableErr
+	}
+	indexOffset := binary.LittleEndian.Uint64(footer[0:])
+	indexSize := binary.LittleEndian.Uint32(footer[8:])
+	if indexOffset+uint64(indexSize)+sstableFooterSize != uint64(info.Size()) {
+		return nil, CorruptSSTableErr
+	}
+
+	indexBlock := make([]byte, indexSize)
+	if _, err := file.ReadAt(indexBlock, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(indexBlock, sstableCrcTable) != binary.LittleEndian.Uint32(footer[12:]) {
+		return nil, CorruptSSTableErr
+	}
+	index, err := decodeIndex(indexBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &SSTable{
+		path:                path,
+		file:                file,
+		index:               index,
+		lastCommitTimestamp: binary.LittleEndian.Uint64(footer[16:]),
+		entryCount:          binary.LittleEndian.Uint64(footer[24:]),
+	}
+	for blockIndex := range index {
+		if _, err := table.readBlock(blockIndex); err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// LastCommitTimestamp returns the commitTimestamp till which all the commits are a part of the SSTable (and the older SSTables).
+func (table *SSTable) LastCommitTimestamp() uint64 {
+	return table.lastCommitTimestamp
+}
+
+// Path returns the path of the SSTable file.
+func (table *SSTable) Path() string {
+	return table.path
+}
+
+// Close closes the SSTable file.
+func (table *SSTable) Close() error {
+	return table.file.Close()
+}
+
+// Get returns a pair of (Value, bool) for the incoming key, with the same semantics as MemTable.Get:
+// it finds the latest version of the key that is less than the version of the incoming key.
+// Entries are sorted by (key, version), so the candidate is the greatest entry that is less than the incoming key. The
+// candidate lives in the last block whose first key is less than the incoming key.
+// It returns the error if the block can not be read.
+func (table *SSTable) Get(key VersionedKey) (Value, bool, error) {
+	blockIndex := sort.Search(len(table.index), func(index int) bool {
+		return table.index[index].firstKey.compare(key) >= 0
+	}) - 1
+	if blockIndex < 0 {
+		return emptyValue(), false, nil
+	}
+	entries, err := table.readBlock(blockIndex)
+	if err != nil {
+		return emptyValue(), false, err
+	}
+	position := sort.Search(len(entries), func(index int) bool {
+		return entries[index].key.compare(key) >= 0
+	}) - 1
+	if position >= 0 && entries[position].key.matchesKeyPrefix(key.getKey()) {
+		return entries[position].value, true, nil
+	}
+	return emptyValue(), false, nil
+}
+
+// Versions returns the versions of the key with fromVersion <= version <= toVersion in the increasing order of the versions,
+// at most limit of them. It returns the error if a block can not be read.
+func (table *SSTable) Versions(key []byte, fromVersion, toVersion uint64, limit int) ([]KeyVersion, error) {
+	iterator := table.NewIterator(0)
+	iterator.seekEntry(NewVersionedKey(key, fromVersion))
+
+	var versions []KeyVersion
+	for entry, ok := iterator.peek(); ok && len(versions) < limit; entry, ok = iterator.peek() {
+		if !entry.key.matchesKeyPrefix(key) || entry.key.getVersion() > toVersion {
+			break
+		}
+		versions = append(versions, newKeyVersion(entry.key, entry.value))
+		iterator.position++
+	}
+	return versions, iterator.Err()
+}
+
+// readBlock reads the data block, verifies its checksum and decodes all its entries.
+func (table *SSTable) readBlock(blockIndex int) ([]sstableEntry, error) {
+	handle := table.index[blockIndex]
+	block := make([]byte, handle.size)
+	if _, err := table.file.ReadAt(block, int64(handle.offset)); err != nil {
+		return nil, fmt.Errorf("failed to read block %v of sstable %v: %w", blockIndex, table.path, err)
+	}
+	if crc32.Checksum(block, sstableCrcTable) != handle.checksum {
+		return nil, fmt.Errorf("failed to read block %v of sstable %v: %w", blockIndex, table.path, CorruptSSTableErr)
+	}
+	entries, err := decodeEntries(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %v of sstable %v: %w", blockIndex, table.path, err)
+	}
+	return entries, nil
+}
+
+// appendEntry appends the encoded VersionedKey/Value pair to the block.
+func appendEntry(block []byte, key VersionedKey, value Value) []byte {
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(key.getKey())))
+	block = append(block, key.getKey()...)
+	block = binary.LittleEndian.AppendUint64(block, key.getVersion())
+	if value.IsDeleted() {
+		block = append(block, 1)
+	} else {
+		block = append(block, 0)
+	}
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(value.Slice())))
+	return append(block, value.Slice()...)
+}
+
+// decodeEntries decodes all the entries of a data block.
+func decodeEntries(block []byte) ([]sstableEntry, error) {
+	var entries []sstableEntry
+	for offset := 0; offset < len(block); {
+		key, size, ok := readLengthPrefixed(block[offset:])
+		if !ok || offset+size+8+1 > len(block) {
+			return nil, CorruptSSTableErr
+		}
+		offset = offset + size
+		version := binary.LittleEndian.Uint64(block[offset:])
+		deleted := block[offset+8] == 1
+		offset = offset + 8 + 1
+
+		value, size, ok := readLengthPrefixed(block[offset:])
+		if !ok {
+			return nil, CorruptSSTableErr
+		}
+		offset = offset + size
+
+		entry := sstableEntry{key: NewVersionedKey(key, version), value: NewValue(value)}
+		if deleted {
+			entry.value = NewDeletedValue()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// encodeIndex encodes the blockHandles of all the data blocks.
+func encodeIndex(index []blockHandle) []byte {
+	block := binary.LittleEndian.AppendUint32(nil, uint32(len(index)))
+	for _, handle := range index {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(handle.firstKey.getKey())))
+		block = append(block, handle.firstKey.getKey()...)
+		block = binary.LittleEndian.AppendUint64(block, handle.firstKey.getVersion())
+		block = binary.LittleEndian.AppendUint64(block, handle.offset)
+		block = binary.LittleEndian.AppendUint32(block, handle.size)
+		block = binary.LittleEndian.AppendUint32(block, handle.checksum)
+	}
+	return block
+}
+
+// decodeIndex decodes the blockHandles of all the data blocks.
+func decodeIndex(block []byte) ([]blockHandle, error) {
+	if len(block) < 4 {
+		return nil, CorruptSSTableErr
+	}
+	count := binary.LittleEndian.Uint32(block)
+	offset := 4
+	index := make([]blockHandle, 0, count)
+	for blockCount := uint32(0); blockCount < count; blockCount++ {
+		key, size, ok := readLengthPrefixed(block[offset:])
+		if !ok || offset+size+8+8+4+4 > len(block) {
+			return nil, CorruptSSTableErr
+		}
+		offset = offset + size
+		index = append(index, blockHandle{
+			firstKey: NewVersionedKey(key, binary.LittleEndian.Uint64(block[offset:])),
+			offset:   binary.LittleEndian.Uint64(block[offset+8:]),
+			size:     binary.LittleEndian.Uint32(block[offset+16:]),
+			checksum: binary.LittleEndian.Uint32(block[offset+20:]),
+		})
+		offset = offset + 24
+	}
+	return index, nil
+}
+
+// readLengthPrefixed reads a length prefixed byte slice and returns it along with the number of bytes read.
+func readLengthPrefixed(source []byte) ([]byte, int, bool) {
+	if len(source) < 4 {
+		return nil, 0, false
+	}
+	length := int(binary.LittleEndian.Uint32(source))
+	if len(source) < 4+length {
+		return nil, 0, false
+	}
+	target := make([]byte, length)
+	copy(target, source[4:4+length])
+	return target, 4 + length, true
+}
+
+// SSTableIterator iterates over the keys of an SSTable in the increasing order, yielding the latest version of every key
+// that is less than the version of the iterator (the same semantics as MemTableIterator).
+// If a data block can not be read, the iterator becomes invalid and Err returns the error.
+type SSTableIterator struct {
+	table      *SSTable
+	version    uint64
+	blockIndex int
+	entries    []sstableEntry
+	position   int
+	current    sstableEntry
+	valid      bool
+	err        error
+}
+
+// NewIterator creates a new SSTableIterator that yields the keys where version of the key < the incoming version.
+func (table *SSTable) NewIterator(version uint64) *SSTableIterator {
+	return &SSTableIterator{table: table, version: version}
+}
+
+// Seek positions the iterator at the first key that is greater than or equal to the incoming key.
+func (iterator *SSTableIterator) Seek(key []byte) {
+	iterator.seekEntry(NewVersionedKey(key, 0))
+	iterator.moveToNextVisibleKey()
+}
+
+// seekEntry positions the cursor of the iterator at the first entry that is greater than or equal to the seekKey.
+func (iterator *SSTableIterator) seekEntry(seekKey VersionedKey) {
+	table := iterator.table
+
+	blockIndex := sort.Search(len(table.index), func(index int) bool {
+		return table.index[index].firstKey.compare(seekKey) >= 0
+	}) - 1
+	if blockIndex < 0 {
+		blockIndex = 0
+	}
+	iterator.blockIndex, iterator.entries, iterator.position, iterator.err = blockIndex, nil, 0, nil
+	if blockIndex < len(table.index) {
+		iterator.entries, iterator.err = table.readBlock(blockIndex)
+		iterator.position = sort.Search(len(iterator.entries), func(index int) bool {
+			return iterator.entries[index].key.compare(seekKey) >= 0
+		})
+	}
+}
+
+// Next moves the iterator to the next key.
+func (iterator *SSTableIterator) Next() {
+	if !iterator.valid {
+		return
+	}
+	iterator.moveToNextVisibleKey()
+}
+
+// Valid returns true if the iterator is positioned at a key, false otherwise.
+func (iterator *SSTableIterator) Valid() bool {
+	return iterator.valid
+}
+
+// Key returns the key at the current position of the iterator.
+func (iterator *SSTableIterator) Key() []byte {
+	return iterator.current.key.getKey()
+}
+
+// Version returns the version of the key at the current position of the iterator.
+func (iterator *SSTableIterator) Version() uint64 {
+	return iterator.current.key.getVersion()
+}
+
+// Value returns the Value at the current position of the iterator. The Value could be a tombstone.
+func (iterator *SSTableIterator) Value() Value {
+	return iterator.current.value
+}
+
+// Err returns the error of reading a data block, which ended the iteration, nil otherwise.
+func (iterator *SSTableIterator) Err() error {
+	return iterator.err
+}
+
+// moveToNextVisibleKey walks all the versions of the next key, and positions the iterator at the latest version of the key
+// that is less than the version of the iterator. If there is no such version, it continues with the next key.
+func (iterator *SSTableIterator) moveToNextVisibleKey() {
+	for {
+		entry, ok := iterator.peek()
+		if !ok {
+			iterator.current, iterator.valid = sstableEntry{}, false
+			return
+		}
+		key := entry.key.getKey()
+		var visible *sstableEntry
+		for ok && entry.key.matchesKeyPrefix(key) {
+			if entry.key.getVersion() < iterator.version {
+				visibleEntry := entry
+				visible = &visibleEntry
+			}
+			iterator.position++
+			entry, ok = iterator.peek()
+		}
+		if visible != nil {
+			iterator.current, iterator.valid = *visible, true
+			return
+		}
+	}
+}
+
+// peek returns the entry at the current position, moving to the next data block if the current block is exhausted.
+// It returns false at the end of the SSTable, and if a data block can not be read.
+func (iterator *SSTableIterator) peek() (sstableEntry, bool) {
+	for iterator.position >= len(iterator.entries) {
+		if iterator.err != nil || iterator.blockIndex+1 >= len(iterator.table.index) {
+			return sstableEntry{}, false
+		}
+		iterator.blockIndex++
+		iterator.entries, iterator.err = iterator.table.readBlock(iterator.blockIndex)
+		iterator.position = 0
+	}
+	return iterator.entries[iterator.position], true
+}
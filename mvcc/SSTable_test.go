@@ -0,0 +1,180 @@
+package mvcc
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAndOpenSSTable(t *testing.T, memTable *MemTable, lastCommitTimestamp uint64) *SSTable {
+	path := filepath.Join(t.TempDir(), sstableFileNameFor(lastCommitTimestamp))
+	assert.Nil(t, writeSSTable(path, memTable, lastCommitTimestamp))
+
+	table, err := openSSTable(path)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = table.Close()
+	})
+	return table
+}
+
+func TestGetsTheValueOfAKeyWithTheNearestVersionInSSTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 2), NewValue([]byte("Hard disk drive")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 2), NewValue([]byte("Solid state drive")))
+
+	table := writeAndOpenSSTable(t, memTable, 2)
+
+	value, ok, _ := table.Get(NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	value, ok, _ = table.Get(NewVersionedKey([]byte("HDD"), 8))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+
+	_, ok, _ = table.Get(NewVersionedKey([]byte("SSD"), 2))
+	assert.Equal(t, false, ok)
+
+	_, ok, _ = table.Get(NewVersionedKey([]byte("NVMe"), 8))
+	assert.Equal(t, false, ok)
+	assert.Equal(t, uint64(2), table.LastCommitTimestamp())
+}
+
+func TestGetsADeletedValueFromSSTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 2), NewDeletedValue())
+
+	table := writeAndOpenSSTable(t, memTable, 2)
+
+	value, ok, _ := table.Get(NewVersionedKey([]byte("HDD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, value.IsDeleted())
+}
+
+func TestGetsValuesFromAnSSTableWithMultipleBlocks(t *testing.T) {
+	memTable := NewMemTable(10)
+	for count := 1; count <= 1000; count++ {
+		key := []byte(fmt.Sprintf("Key-%04d", count))
+		memTable.PutOrUpdate(NewVersionedKey(key, uint64(count)), NewValue([]byte(fmt.Sprintf("Value-%04d", count))))
+		memTable.PutOrUpdate(NewVersionedKey(key, uint64(count+1)), NewValue([]byte(fmt.Sprintf("Updated-%04d", count))))
+	}
+	table := writeAndOpenSSTable(t, memTable, 1001)
+	assert.Greater(t, len(table.index), 1)
+
+	for count := 1; count <= 1000; count++ {
+		key := []byte(fmt.Sprintf("Key-%04d", count))
+
+		value, ok, _ := table.Get(NewVersionedKey(key, uint64(count+1)))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte(fmt.Sprintf("Value-%04d", count)), value.Slice())
+
+		value, ok, _ = table.Get(NewVersionedKey(key, uint64(count+2)))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte(fmt.Sprintf("Updated-%04d", count)), value.Slice())
+	}
+}
+
+func TestIteratesOverAnSSTableWithMultipleBlocks(t *testing.T) {
+	memTable := NewMemTable(10)
+	for count := 1; count <= 1000; count++ {
+		key := []byte(fmt.Sprintf("Key-%04d", count))
+		memTable.PutOrUpdate(NewVersionedKey(key, 1), NewValue([]byte(fmt.Sprintf("Value-%04d", count))))
+		memTable.PutOrUpdate(NewVersionedKey(key, 5), NewValue([]byte(fmt.Sprintf("Updated-%04d", count))))
+	}
+	table := writeAndOpenSSTable(t, memTable, 5)
+
+	iterator := table.NewIterator(5)
+	count := 0
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		count++
+		assert.Equal(t, []byte(fmt.Sprintf("Key-%04d", count)), iterator.Key())
+		assert.Equal(t, []byte(fmt.Sprintf("Value-%04d", count)), iterator.Value().Slice())
+		assert.Equal(t, uint64(1), iterator.Version())
+	}
+	assert.Equal(t, 1000, count)
+
+	iterator = table.NewIterator(6)
+	iterator.Seek([]byte("Key-0500"))
+	assert.Equal(t, true, iterator.Valid())
+	assert.Equal(t, []byte("Key-0500"), iterator.Key())
+	assert.Equal(t, []byte("Updated-0500"), iterator.Value().Slice())
+}
+
+func TestIteratorSkipsTheKeysWithoutAVisibleVersionInSSTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("NVMe"), 4), NewValue([]byte("Non volatile memory")))
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 2), NewValue([]byte("Solid state drive")))
+
+	table := writeAndOpenSSTable(t, memTable, 4)
+
+	iterator := table.NewIterator(3)
+	var keys []string
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+	}
+	assert.Equal(t, []string{"HDD", "SSD"}, keys)
+}
+
+func TestAttemptsToOpenACorruptSSTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+
+	path := filepath.Join(t.TempDir(), sstableFileNameFor(1))
+	assert.Nil(t, writeSSTable(path, memTable, 1))
+	corruptTheFirstBlockOf(t, path)
+
+	_, err := openSSTable(path)
+	assert.ErrorIs(t, err, CorruptSSTableErr)
+}
+
+func TestGetsTheVersionsOfAKeyAcrossTheBlocksOfSSTable(t *testing.T) {
+	memTable := NewMemTable(10)
+	for version := uint64(1); version <= 500; version++ {
+		memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), version), NewValue([]byte(fmt.Sprintf("Hard disk-%03d", version))))
+	}
+	memTable.PutOrUpdate(NewVersionedKey([]byte("SSD"), 1), NewValue([]byte("Solid state drive")))
+	table := writeAndOpenSSTable(t, memTable, 500)
+	assert.Greater(t, len(table.index), 1)
+
+	versions, _ := table.Versions([]byte("HDD"), 100, 400, 1000)
+	assert.Equal(t, 301, len(versions))
+	for index, version := range versions {
+		assert.Equal(t, uint64(100+index), version.CommitTimestamp())
+		assert.Equal(t, []byte(fmt.Sprintf("Hard disk-%03d", 100+index)), version.Value().Slice())
+	}
+
+	versions, _ = table.Versions([]byte("SSD"), 0, 10, 10)
+	assert.Equal(t, 1, len(versions))
+}
+
+func corruptTheFirstBlockOf(t *testing.T, path string) {
+	contents, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	contents[0] = contents[0] ^ 0xFF
+	assert.Nil(t, os.WriteFile(path, contents, 0644))
+}
+
+func TestReturnsAnErrorIfABlockOfAnOpenSSTableIsCorrupt(t *testing.T) {
+	memTable := NewMemTable(10)
+	memTable.PutOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")))
+	table := writeAndOpenSSTable(t, memTable, 1)
+
+	corruptTheFirstBlockOf(t, table.Path())
+
+	_, _, err := table.Get(NewVersionedKey([]byte("HDD"), 2))
+	assert.ErrorIs(t, err, CorruptSSTableErr)
+
+	_, err = table.Versions([]byte("HDD"), 0, 10, 10)
+	assert.ErrorIs(t, err, CorruptSSTableErr)
+
+	iterator := table.NewIterator(2)
+	iterator.Seek(nil)
+	assert.Equal(t, false, iterator.Valid())
+	assert.ErrorIs(t, iterator.Err(), CorruptSSTableErr)
+}
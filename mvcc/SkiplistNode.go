@@ -1,7 +1,20 @@
 package mvcc
 
 import (
+	"encoding/binary"
 	"serialized-snapshot-isolation/mvcc/utils"
+	"sync/atomic"
+)
+
+const (
+	// nodeHeaderSize is the size of the fixed part of a SkiplistNode in the Arena:
+	// |version u64|keyLength u32|valueLength u32|deleted u32|height u32|.
+	nodeHeaderSize = 24
+	// forwardPointerSize is the size of a single forward pointer (the offset of the next node) in the Arena.
+	forwardPointerSize = 8
+	// removedMark is set in a forward pointer of a node that is being removed. Every offset handed out by the Arena is
+	// aligned to arenaAlignment, so the lowest bit of a forward pointer is free to carry the mark.
+	removedMark = uint64(1)
 )
 
 // SkiplistNode represents a node in the SkipList.
@@ -9,44 +22,156 @@ import (
 // SkipListNode maintains VersionedKeys: each key has a version which is the commitTimestamp.
 // A sample Level0 of SkipListNode with HDD as the key can be represented as:
 // HDD1: Hard Disk -> HDD2: Hard disk -> HDD5: Hard disk drive. Here, 1, 2, and 5 are the versions of the key HDD.
+//
+// A SkiplistNode lives entirely inside an Arena, and SkiplistNode itself is only a handle: the Arena and the offset of the node.
+// The layout of a node in the Arena is:
+// |version u64|keyLength u32|valueLength u32|deleted u32|height u32|forward pointers [height]u64|key|value|
+// A forward pointer is the offset of the next node at that level, and the nilOffset marks the end of the level.
+//
+// The SkipList is lock-free, in the style of [Badger's skiplist](https://github.com/dgraph-io/badger/blob/main/skl/skl.go).
+// The forward pointers are atomic, and a new node is linked in using compare-and-swap, starting at level 0 and moving up.
+// The key and the value of a node never change after the node is linked in, so a reader that finds a node through an
+// atomic load sees a completely initialized node. Readers never block, and concurrent insertions do not block each other.
+// A node is a part of the SkipList as soon as it is linked at level 0; the higher levels only speed up the search.
+//
+// The version collection removes the nodes in two steps, in the style of [Harris's linked list](https://timharris.uk/papers/2001-disc.pdf):
+// 1. mark: the removedMark is set in every forward pointer of the node, from the highest level down to level 0. A node is
+// removed (logically) as soon as its level 0 forward pointer is marked. A marked forward pointer never changes again.
+// 2. unlink: the marked node is unlinked from every level with a compare-and-swap on the forward pointer of its previous node.
+// An insertion can not link a new node after a removed node: its compare-and-swap expects an unmarked forward pointer, so
+// it fails, and the insertion finds its splice again. The insertions help unlink the marked nodes they come across, and
+// the readers skip them. A removed node keeps its (marked) forward pointers, so a reader that is at a removed node can
+// still move ahead.
 type SkiplistNode struct {
-	key      VersionedKey
-	value    Value
-	forwards []*SkiplistNode
+	arena  *Arena
+	offset uint64
 }
 
-// newSkiplistNode creates a new instance of SkiplistNode.
-func newSkiplistNode(key VersionedKey, value Value, level uint8) *SkiplistNode {
-	return &SkiplistNode{
-		key:      key,
-		value:    value,
-		forwards: make([]*SkiplistNode, level),
+// newSkiplistNode allocates a new SkiplistNode with the key, the value and level forward pointers in the Arena.
+func newSkiplistNode(arena *Arena, key VersionedKey, value Value, level uint8) SkiplistNode {
+	keyLength, valueLength := len(key.getKey()), len(value.Slice())
+	offset := arena.allocate(nodeSize(keyLength, valueLength, int(level)))
+
+	header := arena.bytes(offset, nodeHeaderSize)
+	binary.LittleEndian.PutUint64(header[0:8], key.getVersion())
+	binary.LittleEndian.PutUint32(header[8:12], uint32(keyLength))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(valueLength))
+	if value.IsDeleted() {
+		binary.LittleEndian.PutUint32(header[16:20], 1)
 	}
+	binary.LittleEndian.PutUint32(header[20:24], uint32(level))
+
+	node := SkiplistNode{arena: arena, offset: offset}
+	copy(arena.bytes(node.keyOffset(), keyLength), key.getKey())
+	copy(arena.bytes(node.keyOffset()+uint64(keyLength), valueLength), value.Slice())
+	return node
 }
 
-// putOrUpdate puts or updates the value corresponding to the incoming key.
-func (node *SkiplistNode) putOrUpdate(key VersionedKey, value Value, levelGenerator utils.LevelGenerator) bool {
-	current := node
-	positions := make([]*SkiplistNode, len(node.forwards))
+// nodeSize returns the number of bytes taken by a SkiplistNode in the Arena (before the alignment).
+func nodeSize(keyLength, valueLength, level int) int {
+	return nodeHeaderSize + level*forwardPointerSize + keyLength + valueLength
+}
 
-	for level := len(node.forwards) - 1; level >= 0; level-- {
-		for current.forwards[level] != nil && current.forwards[level].key.compare(key) < 0 {
-			current = current.forwards[level]
+// putOrUpdate puts the incoming key/value pair in the SkipList, if the key (with the same version) does not exist.
+// It returns (true, 0) if a new node is linked in, and (false, wastedBytes) if the key already exists.
+// putOrUpdate finds the splice (the pair of the previous and the next node) of the key at every level, and links the new
+// node in with a compare-and-swap on the forward pointer of the previous node, from level 0 upwards. If the compare-and-swap
+// fails because another node was linked in (or the previous node is being removed) concurrently, the splices are found
+// again. The new node is not linked at the higher levels once it is being removed itself.
+// The existence of the key is checked before the new node is allocated, but a concurrent insertion of the same key can still
+// win the race at level 0 after the allocation. The new node is then never linked, and its bytes can not be reclaimed from the
+// append-only Arena: they are returned as wastedBytes, so that the MemTable can count them (along with the removed versions)
+// towards its compaction.
+func (node SkiplistNode) putOrUpdate(key VersionedKey, value Value, levelGenerator utils.LevelGenerator) (bool, uint64) {
+	maxLevel := node.height()
+	previous := make([]SkiplistNode, maxLevel+1)
+	next := make([]SkiplistNode, maxLevel+1)
+
+	node.splicesFor(key, previous, next)
+	if !next[0].isNil() && next[0].key().compare(key) == 0 {
+		return false, 0
+	}
+
+	newLevel := int(levelGenerator.Generate())
+	newNode := newSkiplistNode(node.arena, key, value, uint8(newLevel))
+	for level := 0; level < newLevel; level++ {
+		for {
+			if !newNode.pointForwardTo(level, next[level]) {
+				return true, 0
+			}
+			if previous[level].compareAndSwapForward(level, next[level], newNode) {
+				break
+			}
+			node.splicesFor(key, previous, next)
+			if level == 0 && !next[level].isNil() && next[level].key().compare(key) == 0 {
+				return false, newNode.size()
+			}
 		}
-		positions[level] = current
 	}
+	return true, 0
+}
 
-	current = current.forwards[0]
-	if current == nil || current.key.compare(key) != 0 {
-		newLevel := levelGenerator.Generate()
-		newNode := newSkiplistNode(key, value, newLevel)
-		for level := uint8(0); level < newLevel; level++ {
-			newNode.forwards[level] = positions[level].forwards[level]
-			positions[level].forwards[level] = newNode
+// splicesFor finds the splice of the key at every level, starting from the node (the sentinel node of the SkipList),
+// and unlinks the removed nodes that it comes across. It starts again from the node if the previous node of a level is
+// being removed.
+func (node SkiplistNode) splicesFor(key VersionedKey, previous, next []SkiplistNode) {
+	maxLevel := node.height()
+	for {
+		previous[maxLevel] = node
+		found := true
+		for level := maxLevel - 1; level >= 0 && found; level-- {
+			previous[level], next[level], found = previous[level+1].spliceFor(key, level)
+		}
+		if found {
+			return
 		}
-		return true
 	}
-	return false
+}
+
+// spliceFor walks the level starting at the node, and returns the last node with the key less than the incoming key, and
+// the node after it (which is nil or has the key greater than or equal to the incoming key), along with true.
+// The removed (marked) nodes on the way are unlinked. It returns false if the node where the walk is, is being removed
+// itself; the splice needs to be found again from the sentinel node.
+func (node SkiplistNode) spliceFor(key VersionedKey, level int) (SkiplistNode, SkiplistNode, bool) {
+	previous := node
+	next, removed := previous.loadForwardAndMark(level)
+	for {
+		if removed {
+			return SkiplistNode{}, SkiplistNode{}, false
+		}
+		if next.isNil() {
+			return previous, next, true
+		}
+		successor, nextRemoved := next.loadForwardAndMark(level)
+		if nextRemoved {
+			if !previous.compareAndSwapForward(level, next, successor) {
+				next, removed = previous.loadForwardAndMark(level)
+				continue
+			}
+			next = successor
+			continue
+		}
+		if next.key().compare(key) >= 0 {
+			return previous, next, true
+		}
+		previous, next = next, successor
+	}
+}
+
+// searchFor walks the level starting at the node, and returns the last node with the key less than the incoming key.
+// Unlike spliceFor, searchFor is meant for the readers: it skips the removed nodes without unlinking them, so it never writes.
+func (node SkiplistNode) searchFor(key VersionedKey, level int) SkiplistNode {
+	previous := node
+	for {
+		next := previous.loadForward(level)
+		for !next.isNil() && next.isRemovedAt(level) {
+			next = next.loadForward(level)
+		}
+		if next.isNil() || next.key().compare(key) >= 0 {
+			return previous
+		}
+		previous = next
+	}
 }
 
 // get returns a pair of (Value, bool) for the incoming key.
@@ -55,28 +180,233 @@ func (node *SkiplistNode) putOrUpdate(key VersionedKey, value Value, levelGenera
 // 1. the version of the key < version of the incoming key &&
 // 2. the key prefixes match.
 // KeyPrefix is the actual key or the byte slice.
-func (node *SkiplistNode) get(key VersionedKey) (Value, bool) {
+func (node SkiplistNode) get(key VersionedKey) (Value, bool) {
 	node, ok := node.matchingNode(key)
 	if ok {
-		return node.value, true
+		return node.value(), true
 	}
 	return emptyValue(), false
 }
 
-func (node *SkiplistNode) matchingNode(key VersionedKey) (*SkiplistNode, bool) {
+// matchingNode returns the last node with the VersionedKey less than the incoming key, if its key prefix matches the incoming key.
+// Versions of a key are next to each other in the increasing order, so this node holds the latest version of the key that is
+// less than the version of the incoming key.
+func (node SkiplistNode) matchingNode(key VersionedKey) (SkiplistNode, bool) {
 	current := node
-	lastNodeWithTheKey := current
-	for level := len(node.forwards) - 1; level >= 0; level-- {
-		for current.forwards[level] != nil && current.forwards[level].key.compare(key) < 0 {
-			current = current.forwards[level]
-			lastNodeWithTheKey = current
-		}
+	for level := node.height() - 1; level >= 0; level-- {
+		current = current.searchFor(key, level)
 	}
-	if current != nil && current.key.matchesKeyPrefix(key.getKey()) {
+	if current != node && current.key().matchesKeyPrefix(key.getKey()) {
 		return current, true
 	}
-	if lastNodeWithTheKey != nil && lastNodeWithTheKey.key.matchesKeyPrefix(key.getKey()) {
-		return lastNodeWithTheKey, true
+	return SkiplistNode{}, false
+}
+
+// seek returns the first node at level 0 with the key greater than or equal to the incoming key, a nil node if there is no
+// such node. seek never returns the sentinel node.
+func (node SkiplistNode) seek(key VersionedKey) SkiplistNode {
+	current := node
+	for level := node.height() - 1; level >= 0; level-- {
+		current = current.searchFor(key, level)
+	}
+	return current.next()
+}
+
+// next returns the next node at level 0 that is not removed, a nil node if there is no such node.
+func (node SkiplistNode) next() SkiplistNode {
+	next := node.loadForward(0)
+	for !next.isNil() && next.isRemoved() {
+		next = next.loadForward(0)
 	}
-	return nil, false
+	return next
+}
+
+// collectVersionsBelow removes the versions of every key that are older than the newest version of the key which is less than
+// the watermark. No transaction with a beginTimestamp >= watermark can read such versions, because it reads the latest
+// version of a key that is less than its beginTimestamp.
+// collectVersionsBelow first marks all the obsolete nodes (see markRemoved), and then unlinks them from every level (see
+// unlinkRemoved). It is safe to run concurrently with the insertions, the readers and other collections; a node is counted
+// only by the collection that marks it.
+// It returns the number of removed versions and the number of bytes taken by them in the Arena. The Arena is append-only,
+// so these bytes are released only when the whole MemTable is dropped (after it is flushed to an SSTable).
+func (node SkiplistNode) collectVersionsBelow(watermark uint64) (uint64, uint64) {
+	var versions, unlinkedBytes uint64
+	current := node.next()
+	for !current.isNil() {
+		key := current.key().getKey()
+		var newestVersionBelowWatermark SkiplistNode
+		for candidate := current; !candidate.isNil() && candidate.key().matchesKeyPrefix(key); candidate = candidate.next() {
+			if candidate.version() < watermark {
+				newestVersionBelowWatermark = candidate
+			}
+		}
+
+		for ; !current.isNil() && current.key().matchesKeyPrefix(key); current = current.next() {
+			obsolete := !newestVersionBelowWatermark.isNil() &&
+				current.version() < newestVersionBelowWatermark.version()
+			if obsolete && current.markRemoved() {
+				versions++
+				unlinkedBytes = unlinkedBytes + current.size()
+			}
+		}
+	}
+	if versions > 0 {
+		node.unlinkRemoved()
+	}
+	return versions, unlinkedBytes
+}
+
+// markRemoved sets the removedMark in all the forward pointers of the node, from the highest level down to level 0.
+// It returns true if this invocation marked level 0, which removes the node, false if the node was already removed.
+func (node SkiplistNode) markRemoved() bool {
+	for level := node.height() - 1; level >= 0; level-- {
+		for {
+			forward := atomic.LoadUint64(node.forward(level))
+			if forward&removedMark != 0 {
+				if level == 0 {
+					return false
+				}
+				break
+			}
+			if atomic.CompareAndSwapUint64(node.forward(level), forward, forward|removedMark) {
+				if level == 0 {
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// unlinkRemoved walks every level starting at the node (the sentinel node of the SkipList), and unlinks the removed nodes.
+// A level is walked again from the node if the previous node of a removed node is being removed itself.
+func (node SkiplistNode) unlinkRemoved() {
+	for level := node.height() - 1; level >= 0; level-- {
+		for !node.unlinkRemovedAt(level) {
+		}
+	}
+}
+
+// unlinkRemovedAt walks the level starting at the node, and unlinks the removed nodes with a compare-and-swap on the
+// forward pointer of their previous node. It returns false if the previous node is being removed itself.
+func (node SkiplistNode) unlinkRemovedAt(level int) bool {
+	previous := node
+	for {
+		next, removed := previous.loadForwardAndMark(level)
+		if removed {
+			return false
+		}
+		if next.isNil() {
+			return true
+		}
+		successor, nextRemoved := next.loadForwardAndMark(level)
+		if !nextRemoved {
+			previous = next
+			continue
+		}
+		previous.compareAndSwapForward(level, next, successor)
+	}
+}
+
+// key returns the VersionedKey of the node. The key shares the memory of the Arena.
+func (node SkiplistNode) key() VersionedKey {
+	return NewVersionedKey(node.arena.bytes(node.keyOffset(), node.keyLength()), node.version())
+}
+
+// value returns the Value of the node. The value shares the memory of the Arena.
+func (node SkiplistNode) value() Value {
+	if binary.LittleEndian.Uint32(node.header()[16:20]) == 1 {
+		return NewDeletedValue()
+	}
+	return NewValue(node.arena.bytes(node.keyOffset()+uint64(node.keyLength()), node.valueLength()))
+}
+
+// version returns the version of the key of the node, without building the VersionedKey.
+func (node SkiplistNode) version() uint64 {
+	return binary.LittleEndian.Uint64(node.header()[0:8])
+}
+
+// height returns the number of forward pointers of the node.
+func (node SkiplistNode) height() int {
+	return int(binary.LittleEndian.Uint32(node.header()[20:24]))
+}
+
+// isNil returns true if the node does not refer to any node in the Arena.
+func (node SkiplistNode) isNil() bool {
+	return node.offset == nilOffset
+}
+
+// size returns the number of bytes taken by the node in the Arena.
+func (node SkiplistNode) size() uint64 {
+	size := nodeSize(node.keyLength(), node.valueLength(), node.height())
+	return uint64((size + arenaAlignment - 1) &^ (arenaAlignment - 1))
+}
+
+// isRemoved returns true if the node is removed, which is when its level 0 forward pointer is marked.
+func (node SkiplistNode) isRemoved() bool {
+	return node.isRemovedAt(0)
+}
+
+// isRemovedAt returns true if the forward pointer of the level is marked.
+func (node SkiplistNode) isRemovedAt(level int) bool {
+	return atomic.LoadUint64(node.forward(level))&removedMark != 0
+}
+
+// loadForward atomically loads the forward pointer of the level, without the removedMark.
+func (node SkiplistNode) loadForward(level int) SkiplistNode {
+	next, _ := node.loadForwardAndMark(level)
+	return next
+}
+
+// loadForwardAndMark atomically loads the forward pointer of the level, and returns the next node along with true if the
+// forward pointer is marked.
+func (node SkiplistNode) loadForwardAndMark(level int) (SkiplistNode, bool) {
+	forward := atomic.LoadUint64(node.forward(level))
+	return SkiplistNode{arena: node.arena, offset: forward &^ removedMark}, forward&removedMark != 0
+}
+
+// pointForwardTo atomically points the forward pointer of the level (of a node that is being linked in) to the next node.
+// It returns false if the forward pointer is marked, because the node is being removed.
+func (node SkiplistNode) pointForwardTo(level int, next SkiplistNode) bool {
+	for {
+		forward := atomic.LoadUint64(node.forward(level))
+		if forward&removedMark != 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(node.forward(level), forward, next.offset) {
+			return true
+		}
+	}
+}
+
+// compareAndSwapForward atomically replaces the forward pointer of the level with the replacement, if it still points to
+// the expected node and it is not marked.
+func (node SkiplistNode) compareAndSwapForward(level int, expected, replacement SkiplistNode) bool {
+	return atomic.CompareAndSwapUint64(node.forward(level), expected.offset, replacement.offset)
+}
+
+// forward returns the pointer to the forward pointer of the level inside the Arena.
+func (node SkiplistNode) forward(level int) *uint64 {
+	return node.arena.uint64At(node.offset + nodeHeaderSize + uint64(level*forwardPointerSize))
+}
+
+// header returns the fixed part of the node.
+func (node SkiplistNode) header() []byte {
+	return node.arena.bytes(node.offset, nodeHeaderSize)
+}
+
+// keyLength returns the length of the key of the node.
+func (node SkiplistNode) keyLength() int {
+	return int(binary.LittleEndian.Uint32(node.header()[8:12]))
+}
+
+// valueLength returns the length of the value of the node.
+func (node SkiplistNode) valueLength() int {
+	return int(binary.LittleEndian.Uint32(node.header()[12:16]))
+}
+
+// keyOffset returns the offset of the key of the node, which follows the forward pointers.
+func (node SkiplistNode) keyOffset() uint64 {
+	return node.offset + nodeHeaderSize + uint64(node.height()*forwardPointerSize)
 }
@@ -8,7 +8,7 @@ import (
 
 func TestPutsAKeyValueAndGetByKeyInNode(t *testing.T) {
 	const maxLevel = 8
-	sentinelNode := newSkiplistNode(emptyVersionedKey(), emptyValue(), maxLevel)
+	sentinelNode := newSkiplistNode(NewArena(DefaultArenaChunkSize), emptyVersionedKey(), emptyValue(), maxLevel)
 
 	key := NewVersionedKey([]byte("HDD"), 1)
 	value := NewValue([]byte("Hard disk"))
@@ -20,9 +20,26 @@ func TestPutsAKeyValueAndGetByKeyInNode(t *testing.T) {
 	assert.Equal(t, []byte("Hard disk"), value.Slice())
 }
 
+func TestDoesNotPutAnExistingVersionOfAKeyInNode(t *testing.T) {
+	const maxLevel = 8
+	arena := NewArena(DefaultArenaChunkSize)
+	sentinelNode := newSkiplistNode(arena, emptyVersionedKey(), emptyValue(), maxLevel)
+
+	levelGenerator := utils.NewLevelGenerator(maxLevel)
+	linked, wastedBytes := sentinelNode.putOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")), levelGenerator)
+	assert.Equal(t, true, linked)
+	assert.Equal(t, uint64(0), wastedBytes)
+
+	size := arena.Size()
+	linked, wastedBytes = sentinelNode.putOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk drive")), levelGenerator)
+	assert.Equal(t, false, linked)
+	assert.Equal(t, uint64(0), wastedBytes)
+	assert.Equal(t, size, arena.Size())
+}
+
 func TestUpdatesTheSameKeyWithADifferentVersion(t *testing.T) {
 	const maxLevel = 8
-	sentinelNode := newSkiplistNode(emptyVersionedKey(), emptyValue(), maxLevel)
+	sentinelNode := newSkiplistNode(NewArena(DefaultArenaChunkSize), emptyVersionedKey(), emptyValue(), maxLevel)
 
 	levelGenerator := utils.NewLevelGenerator(maxLevel)
 	sentinelNode.putOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")), levelGenerator)
@@ -35,7 +52,7 @@ func TestUpdatesTheSameKeyWithADifferentVersion(t *testing.T) {
 
 func TestGetsTheValueOfAKeyWithTheNearestVersion(t *testing.T) {
 	const maxLevel = 8
-	sentinelNode := newSkiplistNode(emptyVersionedKey(), emptyValue(), maxLevel)
+	sentinelNode := newSkiplistNode(NewArena(DefaultArenaChunkSize), emptyVersionedKey(), emptyValue(), maxLevel)
 
 	levelGenerator := utils.NewLevelGenerator(maxLevel)
 	sentinelNode.putOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")), levelGenerator)
@@ -48,7 +65,7 @@ func TestGetsTheValueOfAKeyWithTheNearestVersion(t *testing.T) {
 
 func TestGetsTheValueOfAKeyWithLatestVersion(t *testing.T) {
 	const maxLevel = 8
-	sentinelNode := newSkiplistNode(emptyVersionedKey(), emptyValue(), maxLevel)
+	sentinelNode := newSkiplistNode(NewArena(DefaultArenaChunkSize), emptyVersionedKey(), emptyValue(), maxLevel)
 
 	levelGenerator := utils.NewLevelGenerator(maxLevel)
 	sentinelNode.putOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")), levelGenerator)
@@ -74,7 +91,7 @@ func TestGetsTheValueOfAKeyWithLatestVersion(t *testing.T) {
 
 func TestGetsTheValueForNonExistingKey(t *testing.T) {
 	const maxLevel = 8
-	sentinelNode := newSkiplistNode(emptyVersionedKey(), emptyValue(), maxLevel)
+	sentinelNode := newSkiplistNode(NewArena(DefaultArenaChunkSize), emptyVersionedKey(), emptyValue(), maxLevel)
 
 	levelGenerator := utils.NewLevelGenerator(maxLevel)
 	sentinelNode.putOrUpdate(NewVersionedKey([]byte("HDD"), 1), NewValue([]byte("Hard disk")), levelGenerator)
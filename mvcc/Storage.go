@@ -0,0 +1,413 @@
+package mvcc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	sstableFilePrefix    = "sstable-"
+	sstableFileExtension = ".sst"
+)
+
+// immutableMemTable is a MemTable that has been rotated out, and is waiting to be flushed to an SSTable.
+// lastCommitTimestamp is the commitTimestamp till which all the commits are a part of the MemTable (and the older layers).
+type immutableMemTable struct {
+	memTable            *MemTable
+	lastCommitTimestamp uint64
+}
+
+// Storage layers the active MemTable, the immutable MemTables, and the SSTables.
+// All the writes go to the active MemTable. Once the active MemTable grows beyond the configured size limit, it is rotated
+// into an immutable MemTable and a background goroutine flushes it to an SSTable in the directory of the Storage.
+//
+// Every layer only holds versions that are newer than the versions held by the older layers, so a Get checks the active
+// MemTable, then the immutable MemTables (newest to oldest), and then the SSTables (newest to oldest), and returns the first
+// match. Rotation happens only between two commits (see MayBeRotate), so a commit is never split across the layers.
+//
+// A Storage without a directory (NewInMemoryStorage) holds a single MemTable and never rotates it.
+//
+// The version collection only unlinks the removed versions from the MemTables, and an Arena is append-only, so the active
+// MemTable is compacted into a new Arena once the removed versions take half of it (see MayBeCompact). This is the only way
+// the memory of the removed versions comes back for a Storage that never rotates its MemTable.
+// `compactionLock` keeps a compaction and a version collection from running at the same time, so a version removed
+// during a compaction is neither copied to the compacted MemTable, nor counted twice.
+type Storage struct {
+	directory           string
+	maxLevel            uint8
+	memTableSizeLimit   uint64
+	lock                sync.RWMutex
+	compactionLock      sync.Mutex
+	active              *MemTable
+	immutables          []immutableMemTable
+	tables              []*SSTable
+	flushChannel        chan struct{}
+	stopFlushChannel    chan struct{}
+	flushStoppedChannel chan struct{}
+	flushErr            error
+}
+
+// NewInMemoryStorage creates a new instance of Storage that holds only the incoming MemTable.
+func NewInMemoryStorage(memTable *MemTable) *Storage {
+	return &Storage{active: memTable}
+}
+
+// OpenStorage opens the Storage in the directory, loading all the existing SSTables.
+// The active MemTable is rotated once its size reaches memTableSizeLimit bytes; a memTableSizeLimit of 0 disables the rotation.
+// OpenStorage starts the goroutine that flushes the immutable MemTables, and it is stopped by Close.
+func OpenStorage(directory string, maxLevel uint8, memTableSizeLimit uint64) (*Storage, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+	tables, err := openSSTables(directory)
+	if err != nil {
+		return nil, err
+	}
+	storage := &Storage{
+		directory:           directory,
+		maxLevel:            maxLevel,
+		memTableSizeLimit:   memTableSizeLimit,
+		active:              NewMemTable(maxLevel),
+		tables:              tables,
+		flushChannel:        make(chan struct{}, 1),
+		stopFlushChannel:    make(chan struct{}),
+		flushStoppedChannel: make(chan struct{}),
+	}
+	go storage.spinFlush()
+	return storage, nil
+}
+
+// LastFlushedCommitTimestamp returns the commitTimestamp till which all the commits are a part of the SSTables, and true.
+// It returns (0, false) if there is no SSTable.
+func (storage *Storage) LastFlushedCommitTimestamp() (uint64, bool) {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
+	if len(storage.tables) == 0 {
+		return 0, false
+	}
+	return storage.tables[len(storage.tables)-1].LastCommitTimestamp(), true
+}
+
+// PutOrUpdate puts or updates the key and the value pair in the active MemTable.
+func (storage *Storage) PutOrUpdate(key VersionedKey, value Value) {
+	storage.lock.RLock()
+	active := storage.active
+	storage.lock.RUnlock()
+
+	active.PutOrUpdate(key, value)
+}
+
+// PutOrUpdateAll puts or updates all the key and value pairs in the active MemTable, with a single acquisition of the lock
+// of the Storage. The pairs are never split across MemTables.
+func (storage *Storage) PutOrUpdateAll(pairs []VersionedKeyValue) {
+	storage.lock.RLock()
+	active := storage.active
+	storage.lock.RUnlock()
+
+	active.PutOrUpdateAll(pairs)
+}
+
+// MayBeRotate rotates the active MemTable into an immutable MemTable if its size has reached the limit. appliedTill is the
+// commitTimestamp till which all the commits are applied, and it becomes the last commit timestamp of the rotated MemTable.
+// It must be invoked after all the pairs of a commit are applied, and never in the middle of a commit.
+// It returns true if the active MemTable is rotated.
+func (storage *Storage) MayBeRotate(appliedTill uint64) bool {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if storage.directory == "" || storage.memTableSizeLimit == 0 || storage.active.Size() < storage.memTableSizeLimit {
+		return false
+	}
+	storage.immutables = append(storage.immutables, immutableMemTable{
+		memTable:            storage.active,
+		lastCommitTimestamp: appliedTill,
+	})
+	storage.active = NewMemTable(storage.maxLevel)
+	select {
+	case storage.flushChannel <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// MayBeCompact replaces the active MemTable with its compacted copy (see MemTable.compact), if the versions removed by the
+// version collection take at least half of its Size. Like MayBeRotate, it must be invoked after all the pairs of a commit
+// are applied, and never in the middle of a commit, so that no insertion goes to the MemTable that is being compacted.
+// The compaction is skipped, without waiting, while a version collection is running; it is tried again on the next
+// invocation. It returns true if the active MemTable is compacted.
+func (storage *Storage) MayBeCompact() bool {
+	if !storage.compactionLock.TryLock() {
+		return false
+	}
+	defer storage.compactionLock.Unlock()
+
+	storage.lock.RLock()
+	active := storage.active
+	storage.lock.RUnlock()
+
+	if !active.needsCompaction() {
+		return false
+	}
+	compacted := active.compact()
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	storage.active = compacted
+	return true
+}
+
+// Get returns a pair of (Value, bool) for the incoming key, with the same semantics as MemTable.Get.
+// It checks the active MemTable, then the immutable MemTables and then the SSTables, from newest to oldest.
+// It returns the error if an SSTable can not be read.
+func (storage *Storage) Get(key VersionedKey) (Value, bool, error) {
+	active, immutables, tables := storage.layers()
+	if value, ok := active.Get(key); ok {
+		return value, true, nil
+	}
+	for index := len(immutables) - 1; index >= 0; index-- {
+		if value, ok := immutables[index].memTable.Get(key); ok {
+			return value, true, nil
+		}
+	}
+	for index := len(tables) - 1; index >= 0; index-- {
+		value, ok, err := tables[index].Get(key)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return emptyValue(), false, nil
+}
+
+// Versions returns the versions of the key with fromVersion <= version <= toVersion across all the layers, in the increasing
+// order of the versions, at most limit of them. It returns the error if an SSTable can not be read.
+func (storage *Storage) Versions(key []byte, fromVersion, toVersion uint64, limit int) ([]KeyVersion, error) {
+	active, immutables, tables := storage.layers()
+
+	var versions []KeyVersion
+	for _, table := range tables {
+		tableVersions, err := table.Versions(key, fromVersion, toVersion, limit)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, tableVersions...)
+	}
+	for _, immutable := range immutables {
+		versions = append(versions, immutable.memTable.Versions(key, fromVersion, toVersion, limit)...)
+	}
+	versions = append(versions, active.Versions(key, fromVersion, toVersion, limit)...)
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].CommitTimestamp() < versions[j].CommitTimestamp()
+	})
+	if len(versions) > limit {
+		versions = versions[:limit]
+	}
+	return versions, nil
+}
+
+// NewIterator creates a new StorageIterator that yields the keys where version of the key < the incoming version, across
+// all the layers of the Storage. The layers are captured when the iterator is created.
+// The iterator is not positioned, Seek needs to be invoked before reading from it.
+func (storage *Storage) NewIterator(version uint64) *StorageIterator {
+	active, immutables, tables := storage.layers()
+	iterators := []versionedIterator{active.NewIterator(version)}
+	for index := len(immutables) - 1; index >= 0; index-- {
+		iterators = append(iterators, immutables[index].memTable.NewIterator(version))
+	}
+	for index := len(tables) - 1; index >= 0; index-- {
+		iterators = append(iterators, tables[index].NewIterator(version))
+	}
+	return newStorageIterator(iterators)
+}
+
+// CollectVersionsBelow removes the obsolete versions below the watermark from the active and the immutable MemTables.
+// (More on this in MemTable.CollectVersionsBelow). The SSTables are immutable and they keep all their versions.
+// The memory of the removed versions comes back when the active MemTable is compacted (see MayBeCompact), or when an
+// immutable MemTable is flushed and dropped.
+func (storage *Storage) CollectVersionsBelow(watermark uint64) CollectedVersions {
+	storage.compactionLock.Lock()
+	defer storage.compactionLock.Unlock()
+
+	active, immutables, _ := storage.layers()
+	collectedVersions := active.CollectVersionsBelow(watermark)
+	for _, immutable := range immutables {
+		collectedVersions = collectedVersions.Add(immutable.memTable.CollectVersionsBelow(watermark))
+	}
+	return collectedVersions
+}
+
+// MemTableNodeCount returns the number of versions in the active and the immutable MemTables.
+func (storage *Storage) MemTableNodeCount() uint64 {
+	active, immutables, _ := storage.layers()
+	nodes := active.NodeCount()
+	for _, immutable := range immutables {
+		nodes = nodes + immutable.memTable.NodeCount()
+	}
+	return nodes
+}
+
+// MemTableSize returns the number of bytes allocated by the active and the immutable MemTables.
+func (storage *Storage) MemTableSize() uint64 {
+	active, immutables, _ := storage.layers()
+	size := active.Size()
+	for _, immutable := range immutables {
+		size = size + immutable.memTable.Size()
+	}
+	return size
+}
+
+// Close stops the flush goroutine after flushing all the immutable MemTables, and closes all the SSTables.
+// It returns the error of the last failed flush, if any immutable MemTable could not be flushed. The commits of such a
+// MemTable are not lost, they are replayed from the WAL on the next open.
+func (storage *Storage) Close() error {
+	if storage.directory == "" {
+		return nil
+	}
+	close(storage.stopFlushChannel)
+	<-storage.flushStoppedChannel
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	var err error
+	if len(storage.immutables) > 0 {
+		err = storage.flushErr
+	}
+	for _, table := range storage.tables {
+		if closeErr := table.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// layers returns the active MemTable, and copies of the immutable MemTables and the SSTables.
+func (storage *Storage) layers() (*MemTable, []immutableMemTable, []*SSTable) {
+	storage.lock.RLock()
+	defer storage.lock.RUnlock()
+
+	immutables := make([]immutableMemTable, len(storage.immutables))
+	copy(immutables, storage.immutables)
+	tables := make([]*SSTable, len(storage.tables))
+	copy(tables, storage.tables)
+	return storage.active, immutables, tables
+}
+
+// spinFlush is invoked as a single goroutine [`go spinFlush()`], and it flushes the immutable MemTables (oldest first)
+// whenever a MemTable is rotated. On stop, it flushes the remaining immutable MemTables before returning.
+// A failed flush leaves the MemTable in the immutable MemTables (it is still served for reads), and it is retried on
+// the next rotation.
+func (storage *Storage) spinFlush() {
+	defer close(storage.flushStoppedChannel)
+	for {
+		select {
+		case <-storage.flushChannel:
+			storage.flushAll()
+		case <-storage.stopFlushChannel:
+			storage.flushAll()
+			return
+		}
+	}
+}
+
+// flushAll flushes all the immutable MemTables, oldest first.
+func (storage *Storage) flushAll() {
+	for {
+		storage.lock.RLock()
+		if len(storage.immutables) == 0 {
+			storage.lock.RUnlock()
+			return
+		}
+		oldest := storage.immutables[0]
+		storage.lock.RUnlock()
+
+		table, err := storage.flush(oldest)
+		storage.lock.Lock()
+		if err != nil {
+			storage.flushErr = err
+			storage.lock.Unlock()
+			return
+		}
+		storage.tables = append(storage.tables, table)
+		storage.immutables = storage.immutables[1:]
+		storage.lock.Unlock()
+	}
+}
+
+// flush writes the immutable MemTable to an SSTable and opens it.
+func (storage *Storage) flush(immutable immutableMemTable) (*SSTable, error) {
+	path := filepath.Join(storage.directory, sstableFileNameFor(immutable.lastCommitTimestamp))
+	if err := writeSSTable(path, immutable.memTable, immutable.lastCommitTimestamp); err != nil {
+		return nil, fmt.Errorf("failed to flush the memtable to %v: %w", path, err)
+	}
+	if err := syncDirectory(storage.directory); err != nil {
+		return nil, err
+	}
+	return openSSTable(path)
+}
+
+// openSSTables opens all the SSTables in the directory, in the increasing order of their last commit timestamps.
+// Leftover temporary files of the flushes that did not finish are removed.
+func openSSTables(directory string) ([]*SSTable, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var timestamps []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, sstableFilePrefix) {
+			continue
+		}
+		if strings.HasSuffix(name, sstableFileExtension+".tmp") {
+			_ = os.Remove(filepath.Join(directory, name))
+			continue
+		}
+		if !strings.HasSuffix(name, sstableFileExtension) {
+			continue
+		}
+		timestamp, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, sstableFilePrefix), sstableFileExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	var tables []*SSTable
+	for _, timestamp := range timestamps {
+		table, err := openSSTable(filepath.Join(directory, sstableFileNameFor(timestamp)))
+		if err != nil {
+			for _, table := range tables {
+				_ = table.Close()
+			}
+			return nil, fmt.Errorf("failed to open the sstable with timestamp %v: %w", timestamp, err)
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// sstableFileNameFor returns the name of the SSTable file for the last commit timestamp.
+func sstableFileNameFor(timestamp uint64) string {
+	return fmt.Sprintf("%s%020d%s", sstableFilePrefix, timestamp, sstableFileExtension)
+}
+
+// syncDirectory syncs the directory, so that the rename of an SSTable file is durable.
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dir.Close()
+	}()
+	return dir.Sync()
+}
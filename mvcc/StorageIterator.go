@@ -0,0 +1,102 @@
+package mvcc
+
+import "bytes"
+
+// versionedIterator is implemented by the iterators of all the layers of the Storage.
+type versionedIterator interface {
+	Seek(key []byte)
+	Next()
+	Valid() bool
+	Key() []byte
+	Version() uint64
+	Value() Value
+	Err() error
+}
+
+// StorageIterator merges the iterators of all the layers of the Storage (MemTableIterator and SSTableIterator), and iterates
+// over the keys in the increasing order. Every layer yields the latest version of a key that is less than the version of
+// the iterator, and when more than one layer yields the same key, StorageIterator picks the one with the highest version.
+// Tombstones are yielded as they are; it is the responsibility of the caller to skip the deleted keys.
+// If any layer fails (an SSTable block can not be read), StorageIterator becomes invalid and Err returns the error, so
+// the keys of the other layers are never yielded without the keys of the failed layer.
+type StorageIterator struct {
+	iterators []versionedIterator
+	current   versionedIterator
+	err       error
+}
+
+// newStorageIterator creates a new instance of StorageIterator.
+func newStorageIterator(iterators []versionedIterator) *StorageIterator {
+	return &StorageIterator{iterators: iterators}
+}
+
+// Seek positions the iterator at the first key that is greater than or equal to the incoming key.
+// Seek(nil) positions the iterator at the first key.
+func (iterator *StorageIterator) Seek(key []byte) {
+	for _, layerIterator := range iterator.iterators {
+		layerIterator.Seek(key)
+	}
+	iterator.position()
+}
+
+// Next moves the iterator to the next key.
+func (iterator *StorageIterator) Next() {
+	if iterator.current == nil {
+		return
+	}
+	key := iterator.current.Key()
+	for _, layerIterator := range iterator.iterators {
+		if layerIterator.Valid() && bytes.Equal(layerIterator.Key(), key) {
+			layerIterator.Next()
+		}
+	}
+	iterator.position()
+}
+
+// Valid returns true if the iterator is positioned at a key, false otherwise.
+func (iterator *StorageIterator) Valid() bool {
+	return iterator.current != nil
+}
+
+// Key returns the key at the current position of the iterator.
+func (iterator *StorageIterator) Key() []byte {
+	return iterator.current.Key()
+}
+
+// Version returns the version (commitTimestamp) of the key at the current position of the iterator.
+func (iterator *StorageIterator) Version() uint64 {
+	return iterator.current.Version()
+}
+
+// Value returns the Value at the current position of the iterator. The Value could be a tombstone.
+func (iterator *StorageIterator) Value() Value {
+	return iterator.current.Value()
+}
+
+// Err returns the error of the layer that failed, which ended the iteration, nil otherwise.
+func (iterator *StorageIterator) Err() error {
+	return iterator.err
+}
+
+// position picks the layer iterator with the smallest key, and the highest version among the iterators with that key.
+// It leaves the iterator invalid if any layer iterator has failed.
+func (iterator *StorageIterator) position() {
+	iterator.current = nil
+	for _, layerIterator := range iterator.iterators {
+		if err := layerIterator.Err(); err != nil {
+			iterator.current, iterator.err = nil, err
+			return
+		}
+		if !layerIterator.Valid() {
+			continue
+		}
+		if iterator.current == nil {
+			iterator.current = layerIterator
+			continue
+		}
+		comparisonResult := bytes.Compare(layerIterator.Key(), iterator.current.Key())
+		if comparisonResult < 0 || (comparisonResult == 0 && layerIterator.Version() > iterator.current.Version()) {
+			iterator.current = layerIterator
+		}
+	}
+}
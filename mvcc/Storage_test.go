@@ -0,0 +1,205 @@
+package mvcc
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func putAndRotate(storage *Storage, key string, value string, version uint64) {
+	storage.PutOrUpdate(NewVersionedKey([]byte(key), version), NewValue([]byte(value)))
+	storage.MayBeRotate(version)
+}
+
+func awaitFlushOf(t *testing.T, storage *Storage, lastCommitTimestamp uint64) {
+	assert.Eventually(t, func() bool {
+		timestamp, ok := storage.LastFlushedCommitTimestamp()
+		return ok && timestamp >= lastCommitTimestamp
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestDoesNotRotateAnInMemoryStorage(t *testing.T) {
+	storage := NewInMemoryStorage(NewMemTable(10))
+	putAndRotate(storage, "HDD", "Hard disk", 1)
+
+	_, ok := storage.LastFlushedCommitTimestamp()
+	assert.Equal(t, false, ok)
+
+	value, ok, _ := storage.Get(NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+}
+
+func TestCompactsTheActiveMemTableOfAnInMemoryStorageAfterTheVersionCollection(t *testing.T) {
+	storage := NewInMemoryStorage(NewMemTable(10))
+	value := make([]byte, 8192)
+	for version := uint64(1); version <= 300; version++ {
+		storage.PutOrUpdate(NewVersionedKey([]byte("HDD"), version), NewValue(append(value, strconv.FormatUint(version, 10)...)))
+	}
+	assert.Equal(t, false, storage.MayBeCompact())
+
+	sizeBeforeCompaction := storage.MemTableSize()
+	storage.CollectVersionsBelow(300)
+	assert.Equal(t, true, storage.MayBeCompact())
+	assert.Equal(t, uint64(2), storage.MemTableNodeCount())
+	assert.Less(t, storage.MemTableSize(), sizeBeforeCompaction/2)
+	assert.Equal(t, false, storage.MayBeCompact())
+
+	storage.PutOrUpdate(NewVersionedKey([]byte("HDD"), 301), NewValue([]byte("Hard disk")))
+
+	hddValue, ok, _ := storage.Get(NewVersionedKey([]byte("HDD"), 301))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, append(value, "300"...), hddValue.Slice())
+
+	hddValue, ok, _ = storage.Get(NewVersionedKey([]byte("HDD"), 302))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), hddValue.Slice())
+}
+
+func TestFlushesTheMemTableToAnSSTableOnReachingTheSizeLimit(t *testing.T) {
+	storage, err := OpenStorage(t.TempDir(), 10, 1)
+	assert.Nil(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	putAndRotate(storage, "HDD", "Hard disk", 1)
+	awaitFlushOf(t, storage, 1)
+
+	value, ok, _ := storage.Get(NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+}
+
+func TestGetsTheLatestVersionAcrossTheLayersOfStorage(t *testing.T) {
+	storage, err := OpenStorage(t.TempDir(), 10, 1)
+	assert.Nil(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	putAndRotate(storage, "HDD", "Hard disk", 1)
+	putAndRotate(storage, "HDD", "Hard disk drive", 2)
+	awaitFlushOf(t, storage, 2)
+	storage.PutOrUpdate(NewVersionedKey([]byte("HDD"), 3), NewDeletedValue())
+
+	value, ok, _ := storage.Get(NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	value, ok, _ = storage.Get(NewVersionedKey([]byte("HDD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+
+	value, ok, _ = storage.Get(NewVersionedKey([]byte("HDD"), 4))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, value.IsDeleted())
+}
+
+func TestIteratesOverTheLayersOfStorage(t *testing.T) {
+	storage, err := OpenStorage(t.TempDir(), 10, 1)
+	assert.Nil(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	putAndRotate(storage, "HDD", "Hard disk", 1)
+	putAndRotate(storage, "SSD", "Solid state drive", 2)
+	awaitFlushOf(t, storage, 2)
+	storage.PutOrUpdate(NewVersionedKey([]byte("HDD"), 3), NewValue([]byte("Hard disk drive")))
+	storage.PutOrUpdate(NewVersionedKey([]byte("NVMe"), 3), NewValue([]byte("Non volatile memory")))
+
+	iterator := storage.NewIterator(4)
+	var pairs []string
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		pairs = append(pairs, fmt.Sprintf("%s@%d=%s", iterator.Key(), iterator.Version(), iterator.Value().Slice()))
+	}
+	assert.Equal(t, []string{"HDD@3=Hard disk drive", "NVMe@3=Non volatile memory", "SSD@2=Solid state drive"}, pairs)
+}
+
+func TestReopensAStorageWithSSTables(t *testing.T) {
+	directory := t.TempDir()
+	storage, err := OpenStorage(directory, 10, 1)
+	assert.Nil(t, err)
+
+	putAndRotate(storage, "HDD", "Hard disk", 1)
+	putAndRotate(storage, "SSD", "Solid state drive", 2)
+	assert.Nil(t, storage.Close())
+
+	storage, err = OpenStorage(directory, 10, 1)
+	assert.Nil(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	timestamp, ok := storage.LastFlushedCommitTimestamp()
+	assert.Equal(t, true, ok)
+	assert.Equal(t, uint64(2), timestamp)
+
+	value, ok, _ := storage.Get(NewVersionedKey([]byte("HDD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	value, ok, _ = storage.Get(NewVersionedKey([]byte("SSD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Solid state drive"), value.Slice())
+}
+
+func TestGetsTheVersionsOfAKeyAcrossTheLayersOfStorage(t *testing.T) {
+	storage, err := OpenStorage(t.TempDir(), 10, 1)
+	assert.Nil(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	putAndRotate(storage, "HDD", "Hard disk", 1)
+	putAndRotate(storage, "HDD", "Hard disk drive", 2)
+	awaitFlushOf(t, storage, 2)
+	storage.PutOrUpdate(NewVersionedKey([]byte("HDD"), 3), NewDeletedValue())
+
+	versions, _ := storage.Versions([]byte("HDD"), 0, 10, 10)
+
+	var commitTimestamps []uint64
+	for _, version := range versions {
+		commitTimestamps = append(commitTimestamps, version.CommitTimestamp())
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, commitTimestamps)
+	assert.Equal(t, true, versions[2].IsTombstone())
+
+	versions, _ = storage.Versions([]byte("HDD"), 0, 10, 2)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, uint64(2), versions[1].CommitTimestamp())
+}
+
+func TestReturnsTheErrorOfACorruptSSTableFromTheReadsOfStorage(t *testing.T) {
+	storage, err := OpenStorage(t.TempDir(), 10, 1)
+	assert.Nil(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	putAndRotate(storage, "HDD", "Hard disk", 1)
+	awaitFlushOf(t, storage, 1)
+	storage.PutOrUpdate(NewVersionedKey([]byte("SSD"), 2), NewValue([]byte("Solid state drive")))
+
+	_, _, tables := storage.layers()
+	corruptTheFirstBlockOf(t, tables[0].Path())
+
+	_, _, err = storage.Get(NewVersionedKey([]byte("HDD"), 3))
+	assert.ErrorIs(t, err, CorruptSSTableErr)
+
+	value, ok, err := storage.Get(NewVersionedKey([]byte("SSD"), 3))
+	assert.Nil(t, err)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Solid state drive"), value.Slice())
+
+	_, err = storage.Versions([]byte("HDD"), 0, 10, 10)
+	assert.ErrorIs(t, err, CorruptSSTableErr)
+
+	iterator := storage.NewIterator(3)
+	iterator.Seek(nil)
+	assert.Equal(t, false, iterator.Valid())
+	assert.ErrorIs(t, iterator.Err(), CorruptSSTableErr)
+}
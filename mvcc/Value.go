@@ -1,8 +1,10 @@
 package mvcc
 
 // Value wraps a []byte which acts as a value in the MemTable.
+// A Value can also be a tombstone, which marks the deletion of a key at a given version.
 type Value struct {
-	value []byte
+	value   []byte
+	deleted bool
 }
 
 // NewValue creates a new instance of the Value.
@@ -12,6 +14,14 @@ func NewValue(value []byte) Value {
 	}
 }
 
+// NewDeletedValue creates a tombstone Value.
+// A tombstone is stored as the value of a VersionedKey when the key is deleted in a transaction.
+func NewDeletedValue() Value {
+	return Value{
+		deleted: true,
+	}
+}
+
 // emptyValue returns an empty Value. Is used when the value for a key is not found.
 func emptyValue() Value {
 	return Value{}
@@ -21,3 +31,8 @@ func emptyValue() Value {
 func (value Value) Slice() []byte {
 	return value.value
 }
+
+// IsDeleted returns true if the Value is a tombstone, false otherwise.
+func (value Value) IsDeleted() bool {
+	return value.deleted
+}
@@ -0,0 +1,12 @@
+package mvcc
+
+// VersionedKeyValue represents a VersionedKey and its Value, which are put together with other pairs using PutOrUpdateAll.
+type VersionedKeyValue struct {
+	key   VersionedKey
+	value Value
+}
+
+// NewVersionedKeyValue creates a new instance of VersionedKeyValue.
+func NewVersionedKeyValue(key VersionedKey, value Value) VersionedKeyValue {
+	return VersionedKeyValue{key: key, value: value}
+}
@@ -2,15 +2,19 @@ package utils
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 )
 
 // LevelGenerator generates a new level for the SkipListNode.
 // The generated level is greater than or equal to 1 and less than the max level.
+// LevelGenerator is safe for concurrent use: the insertions in the lock-free SkipList generate the levels concurrently,
+// and `randomLock` guards the random source which is not safe for concurrent use.
 type LevelGenerator struct {
 	maxLevel   uint8
 	skipFactor int
 	random     *rand.Rand
+	randomLock *sync.Mutex
 }
 
 // NewLevelGenerator creates a new instance of the LevelGenerator.
@@ -22,16 +26,20 @@ func NewLevelGenerator(maxLevel uint8) LevelGenerator {
 		maxLevel:   maxLevel,
 		skipFactor: 2,
 		random:     random,
+		randomLock: &sync.Mutex{},
 	}
 }
 
 // Generate generates a new level.
 func (levelGenerator LevelGenerator) Generate() uint8 {
+	levelGenerator.randomLock.Lock()
+	defer levelGenerator.randomLock.Unlock()
+
 	level := uint8(1)
 	newRandom := levelGenerator.random.Float64()
 	for level < levelGenerator.GetMaxLevel() && newRandom < 1.0/float64(levelGenerator.skipFactor) {
 		level = level + 1
-		newRandom = rand.Float64()
+		newRandom = levelGenerator.random.Float64()
 	}
 	return level
 }
@@ -3,12 +3,16 @@ package txn
 import (
 	"bytes"
 	"serialized-snapshot-isolation/txn/errors"
+	"serialized-snapshot-isolation/wal"
+	"sort"
 )
 
 // KeyValuePair wraps a key and a value.
+// A KeyValuePair with deleted set to true represents the deletion of the key, and it does not carry any value.
 type KeyValuePair struct {
-	key   []byte
-	value []byte
+	key     []byte
+	value   []byte
+	deleted bool
 }
 
 func newKeyValuePair(key, value []byte) KeyValuePair {
@@ -18,6 +22,13 @@ func newKeyValuePair(key, value []byte) KeyValuePair {
 	}
 }
 
+func newDeletedKeyValuePair(key []byte) KeyValuePair {
+	return KeyValuePair{
+		key:     key,
+		deleted: true,
+	}
+}
+
 func (pair KeyValuePair) getKey() []byte {
 	return pair.key
 }
@@ -26,6 +37,10 @@ func (pair KeyValuePair) getValue() []byte {
 	return pair.value
 }
 
+func (pair KeyValuePair) isDeleted() bool {
+	return pair.deleted
+}
+
 // Batch maintains all the key/value pairs that are a part of one RW-transaction.
 // Every ReadWriteTransaction will batch the changes and when the changes are ready to be committed, the Commit() method will be invoked.
 type Batch struct {
@@ -38,8 +53,8 @@ type Batch struct {
 type TimestampedBatch struct {
 	batch          *Batch
 	timestamp      uint64
-	doneChannel    chan struct{}
-	commitCallback func()
+	doneChannel    chan error
+	commitCallback func(err error)
 }
 
 // NewBatch creates a new instance of Batch.
@@ -58,33 +73,88 @@ func (batch *Batch) Add(key, value []byte) error {
 	return nil
 }
 
+// Delete adds a deleted key/value pair (tombstone) for the key in the Batch.
+// Throws an error if the key is already present in the Batch.
+func (batch *Batch) Delete(key []byte) error {
+	if batch.Contains(key) {
+		return errors.DuplicateKeyInBatchErr
+	}
+	batch.pairs = append(batch.pairs, newDeletedKeyValuePair(key))
+	return nil
+}
+
 // Get returns the value for the key, is the value is present in the batch.
 // Returns (Value, true) is the value is present in the Batch, else returns (nil, false).
+// A key that is deleted in the Batch does not have a value, so Get returns (nil, false) for it.
 func (batch *Batch) Get(key []byte) ([]byte, bool) {
-	for _, pair := range batch.pairs {
-		if bytes.Compare(pair.key, key) == 0 {
-			return pair.value, true
-		}
+	pair, ok := batch.getPair(key)
+	if !ok || pair.isDeleted() {
+		return nil, false
 	}
-	return nil, false
+	return pair.value, true
 }
 
 // Contains returns true is the key is present in the Batch, false otherwise.
+// Contains considers both: the keys that are put (or updated) and the keys that are deleted.
 func (batch *Batch) Contains(key []byte) bool {
-	_, ok := batch.Get(key)
+	_, ok := batch.getPair(key)
 	return ok
 }
 
+// keys returns all the keys in the Batch, including the deleted keys.
+func (batch *Batch) keys() [][]byte {
+	keys := make([][]byte, 0, len(batch.pairs))
+	for _, pair := range batch.pairs {
+		keys = append(keys, pair.key)
+	}
+	return keys
+}
+
+// KeysIn returns all the keys in the Batch (including the deleted keys) that fall in the KeyRange.
+func (batch *Batch) KeysIn(keyRange KeyRange) [][]byte {
+	var keys [][]byte
+	for _, pair := range batch.pairs {
+		if keyRange.Contains(pair.key) {
+			keys = append(keys, pair.key)
+		}
+	}
+	return keys
+}
+
+// getPair returns the KeyValuePair for the key, including the deleted pairs.
+// Returns (KeyValuePair, true) is the key is present in the Batch, else returns (KeyValuePair{}, false).
+func (batch *Batch) getPair(key []byte) (KeyValuePair, bool) {
+	for _, pair := range batch.pairs {
+		if bytes.Compare(pair.key, key) == 0 {
+			return pair, true
+		}
+	}
+	return KeyValuePair{}, false
+}
+
+// sortedPairs returns a copy of all the key/value pairs of the Batch, sorted by the key.
+func (batch *Batch) sortedPairs() []KeyValuePair {
+	pairs := make([]KeyValuePair, len(batch.pairs))
+	copy(pairs, batch.pairs)
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].getKey(), pairs[j].getKey()) < 0
+	})
+	return pairs
+}
+
 // ToTimestampedBatch converts the batch to a TimestampedBatch.
-// TimestampedBatch also creates a doneChannel that will receive a notification when the transaction containing the TimestampedBatch is applied.
-// The notification is sent from TransactionExecutor.
+// TimestampedBatch also creates a doneChannel that will receive a nil error when the transaction containing the TimestampedBatch
+// is applied, or the error if the TransactionExecutor failed to make it durable.
+// The notification is sent from TransactionExecutor. The doneChannel is buffered, so that TransactionExecutor never waits for
+// the committer to receive the notification before moving to the next commit of a group.
 // ToTimestampedBatch also takes a callback which is a function that will be called when the transaction containing the
-// TimestampedBatch is committed. This will happen from TransactionExecutor.
-func (batch *Batch) ToTimestampedBatch(commitTimestamp uint64, commitCallback func()) TimestampedBatch {
+// TimestampedBatch is committed (or has failed). This will happen from TransactionExecutor. The callback receives the
+// same error as the doneChannel: nil if the transaction is applied, the error otherwise.
+func (batch *Batch) ToTimestampedBatch(commitTimestamp uint64, commitCallback func(err error)) TimestampedBatch {
 	return TimestampedBatch{
 		batch:          batch,
 		timestamp:      commitTimestamp,
-		doneChannel:    make(chan struct{}),
+		doneChannel:    make(chan error, 1),
 		commitCallback: commitCallback,
 	}
 }
@@ -100,6 +170,16 @@ func (timestampedBatch TimestampedBatch) AllPairs() []KeyValuePair {
 }
 
 // getCommitCallback returns the commit callback function.
-func (timestampedBatch TimestampedBatch) getCommitCallback() func() {
+func (timestampedBatch TimestampedBatch) getCommitCallback() func(err error) {
 	return timestampedBatch.commitCallback
 }
+
+// toWALRecord converts the TimestampedBatch to a wal.Record.
+func (timestampedBatch TimestampedBatch) toWALRecord() wal.Record {
+	pairs := timestampedBatch.AllPairs()
+	entries := make([]wal.Entry, 0, len(pairs))
+	for _, pair := range pairs {
+		entries = append(entries, wal.Entry{Key: pair.getKey(), Value: pair.getValue(), Deleted: pair.isDeleted()})
+	}
+	return wal.Record{Timestamp: timestampedBatch.timestamp, Entries: entries}
+}
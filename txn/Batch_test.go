@@ -63,8 +63,27 @@ func TestGetsTheTimestampedBatch(t *testing.T) {
 	batch := NewBatch()
 	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
 
-	noCallback := func() {}
+	noCallback := func(error) {}
 	timestampedBatch := batch.ToTimestampedBatch(1, noCallback)
 	assert.Equal(t, uint64(1), timestampedBatch.timestamp)
 	assert.Equal(t, []KeyValuePair{newKeyValuePair([]byte("HDD"), []byte("Hard disk"))}, timestampedBatch.batch.pairs)
 }
+
+func TestDeletesAKeyInBatch(t *testing.T) {
+	batch := NewBatch()
+	_ = batch.Delete([]byte("HDD"))
+
+	_, ok := batch.Get([]byte("HDD"))
+	assert.Equal(t, false, ok)
+	assert.Equal(t, true, batch.Contains([]byte("HDD")))
+	assert.Equal(t, false, batch.IsEmpty())
+}
+
+func TestDeletesAKeyThatIsAlreadyPresentInBatch(t *testing.T) {
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	err := batch.Delete([]byte("HDD"))
+
+	assert.Error(t, err)
+	assert.Equal(t, errors.DuplicateKeyInBatchErr, err)
+}
@@ -0,0 +1,67 @@
+package txn
+
+import (
+	"bytes"
+	txnErrors "serialized-snapshot-isolation/txn/errors"
+	"sort"
+	"sync"
+)
+
+// KeyConflicts represents the number of times the transactions aborted due to a conflict on the key.
+type KeyConflicts struct {
+	Key       []byte
+	Conflicts uint64
+}
+
+// ConflictCounter counts the conflicts per key, to find the hot keys that cause most of the aborts.
+// Every key of a txnErrors.ConflictError is counted once per aborted transaction.
+// ConflictCounter is optional, it is enabled using Oracle.EnableConflictCounter.
+type ConflictCounter struct {
+	lock               sync.Mutex
+	conflictCountByKey map[string]uint64
+}
+
+// NewConflictCounter creates a new instance of ConflictCounter.
+func NewConflictCounter() *ConflictCounter {
+	return &ConflictCounter{conflictCountByKey: make(map[string]uint64)}
+}
+
+// record counts a conflict for every key.
+func (counter *ConflictCounter) record(keys []txnErrors.ConflictingKey) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+
+	for _, key := range keys {
+		counter.conflictCountByKey[string(key.Key)]++
+	}
+}
+
+// ConflictsOf returns the number of conflicts on the key.
+func (counter *ConflictCounter) ConflictsOf(key []byte) uint64 {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+
+	return counter.conflictCountByKey[string(key)]
+}
+
+// HotKeys returns at most limit keys with the highest number of conflicts, in the decreasing order of the conflicts.
+// The keys with the same number of conflicts are ordered by the key.
+func (counter *ConflictCounter) HotKeys(limit int) []KeyConflicts {
+	counter.lock.Lock()
+	keyConflicts := make([]KeyConflicts, 0, len(counter.conflictCountByKey))
+	for key, conflicts := range counter.conflictCountByKey {
+		keyConflicts = append(keyConflicts, KeyConflicts{Key: []byte(key), Conflicts: conflicts})
+	}
+	counter.lock.Unlock()
+
+	sort.Slice(keyConflicts, func(i, j int) bool {
+		if keyConflicts[i].Conflicts != keyConflicts[j].Conflicts {
+			return keyConflicts[i].Conflicts > keyConflicts[j].Conflicts
+		}
+		return bytes.Compare(keyConflicts[i].Key, keyConflicts[j].Key) < 0
+	})
+	if limit >= 0 && len(keyConflicts) > limit {
+		keyConflicts = keyConflicts[:limit]
+	}
+	return keyConflicts
+}
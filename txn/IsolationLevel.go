@@ -0,0 +1,24 @@
+package txn
+
+// IsolationLevel determines the conflicts that a ReadWriteTransaction is checked for, before it gets a commitTimestamp.
+// Both the levels read from a snapshot: a transaction reads the keys where commitTimestampOf(Key) < beginTimestamp.
+//
+// - SerializableSnapshotIsolation (the default) detects RW conflicts: a transaction aborts if a key (or a key range) that it
+// read is written by a transaction that committed after it began. It prevents write skew.
+// - SnapshotIsolation detects WW conflicts: a transaction aborts if a key that it writes is written by a transaction that
+// committed after it began. The reads are not checked, so it allows write skew, but a transaction that reads a lot and
+// writes a little aborts less often.
+type IsolationLevel uint8
+
+const (
+	SerializableSnapshotIsolation IsolationLevel = iota
+	SnapshotIsolation
+)
+
+// String returns the name of the IsolationLevel.
+func (isolationLevel IsolationLevel) String() string {
+	if isolationLevel == SnapshotIsolation {
+		return "SnapshotIsolation"
+	}
+	return "SerializableSnapshotIsolation"
+}
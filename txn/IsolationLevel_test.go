@@ -0,0 +1,100 @@
+package txn
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"serialized-snapshot-isolation/mvcc"
+	"serialized-snapshot-isolation/txn/errors"
+	"testing"
+)
+
+// commitWriteSkew runs the classic write skew: two doctors are on call, and each of the two concurrent transactions
+// checks that both the doctors are on call before taking one of them off. It returns the errors of the two commits.
+func commitWriteSkew(t *testing.T, isolationLevel IsolationLevel) (error, error) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	setup, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = setup.PutOrUpdate([]byte("alice"), []byte("on-call"))
+	_ = setup.PutOrUpdate([]byte("bob"), []byte("on-call"))
+	done, err := setup.Commit(context.Background())
+	assert.Nil(t, err)
+	<-done
+	setup.FinishBeginTimestampForReadWriteTransaction()
+
+	aTransaction, _ := NewReadWriteTransactionWithIsolation(context.Background(), oracle, isolationLevel)
+	anotherTransaction, _ := NewReadWriteTransactionWithIsolation(context.Background(), oracle, isolationLevel)
+	defer aTransaction.FinishBeginTimestampForReadWriteTransaction()
+	defer anotherTransaction.FinishBeginTimestampForReadWriteTransaction()
+
+	for _, transaction := range []*ReadWriteTransaction{aTransaction, anotherTransaction} {
+		transaction.Get([]byte("alice"))
+		transaction.Get([]byte("bob"))
+	}
+	_ = aTransaction.PutOrUpdate([]byte("alice"), []byte("off-call"))
+	_ = anotherTransaction.PutOrUpdate([]byte("bob"), []byte("off-call"))
+
+	done, aCommitErr := aTransaction.Commit(context.Background())
+	if aCommitErr == nil {
+		<-done
+	}
+	done, anotherCommitErr := anotherTransaction.Commit(context.Background())
+	if anotherCommitErr == nil {
+		<-done
+	}
+	return aCommitErr, anotherCommitErr
+}
+
+func TestAllowsWriteSkewWithSnapshotIsolation(t *testing.T) {
+	aCommitErr, anotherCommitErr := commitWriteSkew(t, SnapshotIsolation)
+
+	assert.Nil(t, aCommitErr)
+	assert.Nil(t, anotherCommitErr)
+}
+
+func TestRejectsWriteSkewWithSerializableSnapshotIsolation(t *testing.T) {
+	aCommitErr, anotherCommitErr := commitWriteSkew(t, SerializableSnapshotIsolation)
+
+	assert.Nil(t, aCommitErr)
+	assert.ErrorIs(t, anotherCommitErr, errors.ConflictErr)
+}
+
+func TestRejectsAWriteWriteConflictWithSnapshotIsolation(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	aTransaction, _ := NewReadWriteTransactionWithIsolation(context.Background(), oracle, SnapshotIsolation)
+	_ = aTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	anotherTransaction, _ := NewReadWriteTransactionWithIsolation(context.Background(), oracle, SnapshotIsolation)
+	_ = anotherTransaction.Delete([]byte("HDD"))
+
+	commitTimestamp, err := oracle.mayBeCommitTimestampFor(aTransaction)
+	assert.Nil(t, err)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	_, err = oracle.mayBeCommitTimestampFor(anotherTransaction)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+
+	var conflictError *errors.ConflictError
+	assert.ErrorAs(t, err, &conflictError)
+	assert.Equal(t, []errors.ConflictingKey{{Key: []byte("HDD"), CommitTimestamp: commitTimestamp}}, conflictError.Keys)
+}
+
+func TestAllowsBlindWritesToTheSameKeyWithSerializableSnapshotIsolation(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = aTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+
+	commitTimestamp, err := oracle.mayBeCommitTimestampFor(aTransaction)
+	assert.Nil(t, err)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	_, err = oracle.mayBeCommitTimestampFor(anotherTransaction)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,196 @@
+package txn
+
+import (
+	"bytes"
+	"serialized-snapshot-isolation/mvcc"
+	"sort"
+)
+
+// Iterator iterates over the keys visible to a transaction in the increasing order of the keys.
+// It yields only the latest version of every key that is visible at the beginTimestamp of the transaction.
+// For a ReadWriteTransaction, the keys from mvcc.Storage are merged with the uncommitted key/value pairs of the Batch.
+// The Batch is captured when the iterator is created, and its pairs override the pairs from the mvcc.Storage.
+// Deleted keys (tombstones) are skipped.
+// If the mvcc.Storage fails to read (an SSTable block can not be read), the iterator becomes invalid and Err returns the error.
+//
+// Iterator is not positioned when it is created, Seek needs to be invoked before reading from it.
+// Seek(nil) positions the iterator at the first key.
+//
+// An Iterator can be bounded by a KeyRange, in which case it only yields the keys that fall in [start, end).
+// A ReadWriteTransaction tracks the KeyRange of its iterators (instead of the individual keys), the full key range for an
+// unbounded iterator, so that the keys that get inserted in the range by other concurrent transactions also take part in
+// the RW conflict check.
+type Iterator struct {
+	storageIterator *mvcc.StorageIterator
+	pendingPairs    []KeyValuePair
+	pendingIndex    int
+	keyRange        KeyRange
+	key             []byte
+	version         uint64
+	value           mvcc.Value
+	valid           bool
+	closed          bool
+}
+
+// newIterator creates a new instance of Iterator.
+func newIterator(
+	storage *mvcc.Storage,
+	beginTimestamp uint64,
+	batch *Batch,
+	keyRange KeyRange,
+) *Iterator {
+	var pendingPairs []KeyValuePair
+	if batch != nil {
+		pendingPairs = batch.sortedPairs()
+	}
+	return &Iterator{
+		storageIterator: storage.NewIterator(beginTimestamp),
+		pendingPairs:    pendingPairs,
+		keyRange:        keyRange,
+	}
+}
+
+// NewIterator creates a new Iterator over the keys visible at the beginTimestamp of the ReadonlyTransaction.
+func (transaction *ReadonlyTransaction) NewIterator() *Iterator {
+	return newIterator(transaction.storage, transaction.beginTimestamp, nil, NewKeyRange(nil, nil))
+}
+
+// NewRangeIterator creates a new Iterator over the keys in [start, end) visible at the beginTimestamp of the ReadonlyTransaction.
+func (transaction *ReadonlyTransaction) NewRangeIterator(start, end []byte) *Iterator {
+	return newIterator(transaction.storage, transaction.beginTimestamp, nil, NewKeyRange(start, end))
+}
+
+// NewIterator creates a new Iterator over the keys visible at the beginTimestamp of the ReadWriteTransaction,
+// merged with the key/value pairs of its Batch.
+// It is a NewRangeIterator over the full key range, so the full key range is tracked in `rangeReads` of the transaction.
+func (transaction *ReadWriteTransaction) NewIterator() *Iterator {
+	return transaction.NewRangeIterator(nil, nil)
+}
+
+// NewRangeIterator creates a new Iterator over the keys in [start, end) visible at the beginTimestamp of the ReadWriteTransaction,
+// merged with the key/value pairs of its Batch.
+// The range [start, end) is tracked in `rangeReads` of the transaction. The transaction will abort (with a RW conflict)
+// if another transaction that commits after its beginTimestamp writes any key in the range, including the keys that
+// did not exist when the range was read. This prevents phantoms.
+func (transaction *ReadWriteTransaction) NewRangeIterator(start, end []byte) *Iterator {
+	keyRange := NewKeyRange(start, end)
+	transaction.rangeReads = append(transaction.rangeReads, keyRange)
+	return newIterator(transaction.storage, transaction.beginTimestamp, transaction.batch, keyRange)
+}
+
+// Seek positions the iterator at the first key that is greater than or equal to the incoming key.
+// For a bounded iterator, Seek positions the iterator at the start of the range, if the incoming key is less than the start.
+func (iterator *Iterator) Seek(key []byte) {
+	if iterator.closed {
+		return
+	}
+	if bytes.Compare(key, iterator.keyRange.start) < 0 {
+		key = iterator.keyRange.start
+	}
+	iterator.storageIterator.Seek(key)
+	iterator.pendingIndex = sort.Search(len(iterator.pendingPairs), func(index int) bool {
+		return bytes.Compare(iterator.pendingPairs[index].getKey(), key) >= 0
+	})
+	iterator.position()
+}
+
+// Next moves the iterator to the next key.
+func (iterator *Iterator) Next() {
+	if !iterator.valid {
+		return
+	}
+	iterator.skipCurrentKey()
+	iterator.position()
+}
+
+// Valid returns true if the iterator is positioned at a key, false otherwise.
+func (iterator *Iterator) Valid() bool {
+	return iterator.valid
+}
+
+// Key returns the key at the current position of the iterator.
+func (iterator *Iterator) Key() []byte {
+	return iterator.key
+}
+
+// Version returns the commitTimestamp of the key at the current position of the iterator.
+// It returns 0 for a key that comes from the (uncommitted) Batch of a ReadWriteTransaction.
+func (iterator *Iterator) Version() uint64 {
+	return iterator.version
+}
+
+// Value returns the mvcc.Value at the current position of the iterator.
+func (iterator *Iterator) Value() mvcc.Value {
+	return iterator.value
+}
+
+// Err returns the error of the mvcc.Storage that ended the iteration, nil otherwise.
+// The clients need to check Err once Valid returns false, to tell the end of the keys from a failed read.
+func (iterator *Iterator) Err() error {
+	if iterator.storageIterator == nil {
+		return nil
+	}
+	return iterator.storageIterator.Err()
+}
+
+// Close closes the iterator. A closed iterator is not valid and can not be positioned again.
+func (iterator *Iterator) Close() {
+	iterator.closed = true
+	iterator.valid = false
+	iterator.storageIterator = nil
+	iterator.pendingPairs = nil
+}
+
+// position positions the iterator at the smallest key across the mvcc.Storage and the pending pairs of the Batch.
+// If the same key is present in both, the pending pair wins. Deleted keys are skipped.
+// The iterator becomes invalid if the mvcc.Storage has failed.
+func (iterator *Iterator) position() {
+	for {
+		if iterator.storageIterator.Err() != nil {
+			iterator.key, iterator.value, iterator.valid = nil, mvcc.Value{}, false
+			return
+		}
+		storageValid := iterator.storageIterator.Valid() && !iterator.keyRange.isBeyondEnd(iterator.storageIterator.Key())
+		pendingValid := iterator.pendingIndex < len(iterator.pendingPairs) &&
+			!iterator.keyRange.isBeyondEnd(iterator.pendingPairs[iterator.pendingIndex].getKey())
+		if !storageValid && !pendingValid {
+			iterator.key, iterator.value, iterator.valid = nil, mvcc.Value{}, false
+			return
+		}
+
+		fromBatch := pendingValid &&
+			(!storageValid || bytes.Compare(iterator.pendingPairs[iterator.pendingIndex].getKey(), iterator.storageIterator.Key()) <= 0)
+
+		if fromBatch {
+			pair := iterator.pendingPairs[iterator.pendingIndex]
+			iterator.key = pair.getKey()
+			if pair.isDeleted() {
+				iterator.skipCurrentKey()
+				continue
+			}
+			iterator.value = mvcc.NewValue(pair.getValue())
+			iterator.version = 0
+		} else {
+			iterator.key = iterator.storageIterator.Key()
+			iterator.value = iterator.storageIterator.Value()
+			iterator.version = iterator.storageIterator.Version()
+			if iterator.value.IsDeleted() {
+				iterator.skipCurrentKey()
+				continue
+			}
+		}
+		iterator.valid = true
+		return
+	}
+}
+
+// skipCurrentKey moves both the sources of the iterator past the current key.
+func (iterator *Iterator) skipCurrentKey() {
+	if iterator.storageIterator.Valid() && bytes.Equal(iterator.storageIterator.Key(), iterator.key) {
+		iterator.storageIterator.Next()
+	}
+	if iterator.pendingIndex < len(iterator.pendingPairs) &&
+		bytes.Equal(iterator.pendingPairs[iterator.pendingIndex].getKey(), iterator.key) {
+		iterator.pendingIndex++
+	}
+}
@@ -0,0 +1,127 @@
+package txn
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"serialized-snapshot-isolation/mvcc"
+	"testing"
+)
+
+func TestIteratesOverAllTheKeysInAReadonlyTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("SSD"), 1), mvcc.NewValue([]byte("Solid state")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 2), mvcc.NewValue([]byte("Hard disk drive")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("NVMe"), 2), mvcc.NewDeletedValue())
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("Tape"), 4), mvcc.NewValue([]byte("Magnetic tape")))
+
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 4
+	oracle.commitTimestampMark.Finish(3)
+
+	transaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+	iterator := transaction.NewIterator()
+	defer iterator.Close()
+
+	var keys, values []string
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+		values = append(values, string(iterator.Value().Slice()))
+	}
+	assert.Equal(t, []string{"HDD", "SSD"}, keys)
+	assert.Equal(t, []string{"Hard disk drive", "Solid state"}, values)
+}
+
+func TestSeeksAKeyInAReadonlyTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("SSD"), 1), mvcc.NewValue([]byte("Solid state")))
+
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 3
+	oracle.commitTimestampMark.Finish(2)
+
+	transaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+	iterator := transaction.NewIterator()
+	iterator.Seek([]byte("Memory"))
+
+	assert.Equal(t, true, iterator.Valid())
+	assert.Equal(t, []byte("SSD"), iterator.Key())
+
+	iterator.Close()
+	assert.Equal(t, false, iterator.Valid())
+}
+
+func TestIteratesOverTheKeysMergedWithTheBatchInAReadWriteTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("NVMe"), 1), mvcc.NewValue([]byte("Non volatile memory")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("SSD"), 1), mvcc.NewValue([]byte("Solid state")))
+
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 3
+	oracle.commitTimestampMark.Finish(2)
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	_ = transaction.PutOrUpdate([]byte("Disk"), []byte("Storage"))
+	_ = transaction.Delete([]byte("NVMe"))
+
+	iterator := transaction.NewIterator()
+	defer iterator.Close()
+
+	var keys, values []string
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+		values = append(values, string(iterator.Value().Slice()))
+	}
+	assert.Equal(t, []string{"Disk", "HDD", "SSD"}, keys)
+	assert.Equal(t, []string{"Storage", "Hard disk", "Solid state drive"}, values)
+}
+
+func TestTracksTheFullKeyRangeReadByTheIteratorOfAReadWriteTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("SSD"), 1), mvcc.NewValue([]byte("Solid state")))
+
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 3
+	oracle.commitTimestampMark.Finish(2)
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+
+	iterator := transaction.NewIterator()
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+	}
+	iterator.Close()
+
+	assert.Equal(t, []KeyRange{NewKeyRange(nil, nil)}, transaction.rangeReads)
+	assert.Equal(t, 0, len(transaction.reads))
+}
+
+func TestIteratesOverAKeyRangeInAReadWriteTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("order/41/item/1"), 1), mvcc.NewValue([]byte("Tape")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("order/42/item/1"), 1), mvcc.NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("order/42/item/3"), 1), mvcc.NewValue([]byte("Solid state")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("order/43/item/1"), 1), mvcc.NewValue([]byte("Memory")))
+
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 3
+	oracle.commitTimestampMark.Finish(2)
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("order/42/item/2"), []byte("NVMe"))
+
+	iterator := transaction.NewRangeIterator([]byte("order/42/"), []byte("order/43/"))
+	defer iterator.Close()
+
+	var keys []string
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+	}
+	assert.Equal(t, []string{"order/42/item/1", "order/42/item/2", "order/42/item/3"}, keys)
+	assert.Equal(t, []KeyRange{NewKeyRange([]byte("order/42/"), []byte("order/43/"))}, transaction.rangeReads)
+	assert.Equal(t, 0, len(transaction.reads))
+}
@@ -0,0 +1,27 @@
+package txn
+
+import "bytes"
+
+// KeyRange represents a half-open range of keys: [start, end).
+// A nil start denotes the smallest key and a nil end denotes a range without an upper bound.
+// ReadWriteTransaction tracks the KeyRanges that it reads in `rangeReads`. This tracking is essential to determine
+// RW conflict for the keys that did not exist when the range was read (phantoms).
+type KeyRange struct {
+	start []byte
+	end   []byte
+}
+
+// NewKeyRange creates a new instance of KeyRange.
+func NewKeyRange(start, end []byte) KeyRange {
+	return KeyRange{start: start, end: end}
+}
+
+// Contains returns true if the key is greater than or equal to start and less than end.
+func (keyRange KeyRange) Contains(key []byte) bool {
+	return bytes.Compare(key, keyRange.start) >= 0 && !keyRange.isBeyondEnd(key)
+}
+
+// isBeyondEnd returns true if the key is greater than or equal to the end of the KeyRange.
+func (keyRange KeyRange) isBeyondEnd(key []byte) bool {
+	return keyRange.end != nil && bytes.Compare(key, keyRange.end) >= 0
+}
@@ -0,0 +1,31 @@
+package txn
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKeyRangeContainsTheStartKey(t *testing.T) {
+	keyRange := NewKeyRange([]byte("order/42/"), []byte("order/43/"))
+	assert.Equal(t, true, keyRange.Contains([]byte("order/42/")))
+}
+
+func TestKeyRangeContainsAKeyInTheRange(t *testing.T) {
+	keyRange := NewKeyRange([]byte("order/42/"), []byte("order/43/"))
+	assert.Equal(t, true, keyRange.Contains([]byte("order/42/item/1")))
+}
+
+func TestKeyRangeDoesNotContainTheEndKey(t *testing.T) {
+	keyRange := NewKeyRange([]byte("order/42/"), []byte("order/43/"))
+	assert.Equal(t, false, keyRange.Contains([]byte("order/43/")))
+}
+
+func TestKeyRangeDoesNotContainAKeyBeforeTheStartKey(t *testing.T) {
+	keyRange := NewKeyRange([]byte("order/42/"), []byte("order/43/"))
+	assert.Equal(t, false, keyRange.Contains([]byte("order/41/item/1")))
+}
+
+func TestKeyRangeWithoutAnUpperBoundContainsAKey(t *testing.T) {
+	keyRange := NewKeyRange([]byte("order/42/"), nil)
+	assert.Equal(t, true, keyRange.Contains([]byte("payment/1")))
+}
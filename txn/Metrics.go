@@ -0,0 +1,58 @@
+package txn
+
+import "serialized-snapshot-isolation/metrics"
+
+// oracleMetrics holds the counters and the histogram that are updated by the Oracle and the transactions.
+type oracleMetrics struct {
+	commits                      metrics.Counter
+	failedCommits                metrics.Counter
+	conflicts                    metrics.Counter
+	emptyTransactionRejections   metrics.Counter
+	readonlyTransactionsStarted  metrics.Counter
+	readWriteTransactionsStarted metrics.Counter
+	commitLatency                *metrics.Histogram
+}
+
+// newOracleMetrics creates a new instance of oracleMetrics.
+func newOracleMetrics() *oracleMetrics {
+	return &oracleMetrics{commitLatency: metrics.NewLatencyHistogram()}
+}
+
+// Metrics is a point-in-time snapshot of the metrics of the Oracle, which is returned by Oracle.Metrics.
+//
+// The counters:
+// - Commits is the number of ReadWriteTransactions whose commits were applied by the TransactionExecutor.
+// - FailedCommits is the number of ReadWriteTransactions that got a commitTimestamp, but the TransactionExecutor failed to
+// write their commits to the WAL (or had already failed), so they were never applied.
+// - Conflicts is the number of ReadWriteTransactions that were aborted because of a conflict.
+// - EmptyTransactionRejections is the number of commits of ReadWriteTransactions without any write.
+// - ReadonlyTransactionsStarted and ReadWriteTransactionsStarted are the number of transactions that began.
+//
+// The gauges:
+// - CommittedTransactions is the number of committed transactions that are tracked for the conflict detection.
+// - BeginTimestampDoneTill and CommitTimestampDoneTill are the DoneTill of the beginTimestampMark and the commitTimestampMark.
+// - NextTimestamp is one more than the last commitTimestamp (More on this in Oracle).
+// - MemTableNodes is the number of versions held by the mvcc.MemTables.
+// - SubmittedBatches is the number of commits waiting for the TransactionExecutor (the depth of its queue).
+// - BlockedTransactions is the number of new transactions that are waiting for the commits before their beginTimestamps.
+//
+// The histograms:
+// - CommitLatency is the time from the start of a commit till the commit is applied. The failed commits are not observed.
+// - WaitForMarkDuration is the time the new transactions wait for the commits before their beginTimestamps to be applied.
+type Metrics struct {
+	Commits                      uint64
+	FailedCommits                uint64
+	Conflicts                    uint64
+	EmptyTransactionRejections   uint64
+	ReadonlyTransactionsStarted  uint64
+	ReadWriteTransactionsStarted uint64
+	CommittedTransactions        uint64
+	BeginTimestampDoneTill       uint64
+	CommitTimestampDoneTill      uint64
+	NextTimestamp                uint64
+	MemTableNodes                uint64
+	SubmittedBatches             uint64
+	BlockedTransactions          uint64
+	CommitLatency                metrics.HistogramSnapshot
+	WaitForMarkDuration          metrics.HistogramSnapshot
+}
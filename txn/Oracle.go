@@ -2,8 +2,10 @@ package txn
 
 import (
 	"context"
+	"hash/fnv"
 	txnErrors "serialized-snapshot-isolation/txn/errors"
 	"sync"
+	"time"
 )
 
 // CommittedTransaction is a concurrently running ReadWriteTransaction which is ready to be committed.
@@ -16,34 +18,67 @@ type CommittedTransaction struct {
 // Every transaction gets a beginTimestamp and only a ReadWriteTransaction gets a commit timestamp.
 // According to snapshot isolation (or serialized snapshot isolation), every transaction reads the keys where:
 // commitTimestampOf(Key) < beginTimestampOf(transaction).
-// The current implementation uses nextTimestamp which denotes the timestamp that will be assigned as the commit timestamp
-// to the next transaction. The beginTimestamp is one less than the nextTimestamp.
+// The current implementation uses nextTimestamp which is one more than the last commitTimestamp: the beginTimestamp is one less
+// than the nextTimestamp (the last commitTimestamp), and the commitTimestamp of the next transaction is generated by the
+// timestampSource from the last commitTimestamp (More on this in TimestampSource). With the CounterTimestampSource, the
+// next commitTimestamp is the nextTimestamp itself.
 // beginTimestampMark is used to indicate till what timestamp have the transactions begun. This information is used to clean up
 // the committedTransactions.
 // commitTimestampMark is used to block the new transactions, so all previous commits are visible to a new read.
 // However, the system still reads the keys where commitTimestampOf(Key) < beginTimestampOf(transaction).
+// pinnedTimestamps tracks the timestamps of the ReadonlyTransactions that read at a caller supplied timestamp (time-travel reads),
+// and versionCollectedTill is the highest watermark handed out to the VersionCollector. A timestamp can only be pinned
+// if it is not below versionCollectedTill, and the watermark never goes beyond a pinned timestamp.
+// commitTimestampByKey indexes the keys written by the committedTransactions: it maps the hash of a key to the latest
+// commitTimestamp of the key, so that a conflict check on the point reads (or the writes) costs O(keys of the transaction)
+// instead of a scan of all the committedTransactions. It is pruned along with the committedTransactions.
+// metrics holds the counters and the commit latency histogram, which are a part of the snapshot returned by Metrics.
+// executorSlot is a lock (a channel with a capacity of 1) that ensures that the commits are sent to the TransactionExecutor in
+// the order of their commitTimestamps. Unlike a sync.Mutex, a committer can stop waiting for it when its context is done.
 type Oracle struct {
 	lock                  sync.Mutex
-	executorLock          sync.Mutex
+	executorSlot          chan struct{}
 	nextTimestamp         uint64
+	timestampSource       TimestampSource
 	transactionExecutor   *TransactionExecutor
 	beginTimestampMark    *TransactionTimestampMark
 	commitTimestampMark   *TransactionTimestampMark
 	committedTransactions []CommittedTransaction
+	pinnedTimestamps      map[uint64]int
+	versionCollectedTill  uint64
+	conflictCounter       *ConflictCounter
+	commitTimestampByKey  map[uint64]uint64
+	metrics               *oracleMetrics
 }
 
-// NewOracle creates a new instance of Oracle. It is called once in the entire application.
+// NewOracle creates a new instance of Oracle that generates the commitTimestamps using the timestampSource.
+// It is called once in the entire application.
 // Oracle is initialized with nextTimestamp as 1.
-// If we were to implement durability using WAL, we would load the value of the nextTimestamp from WAL.
-// Every segment of WAL can contain the last commitTimestamp. In order to recover nextTimestamp, we can read the latest
-// WAL segment (only the footer where we place the last commitTimestamp), get the last commitTimestamp and add 1 to it.
 // As a part creating a new instance of NewOracle, we also mark beginTimestampMark and commitTimestampMark as finished for timestamp 0.
-func NewOracle(transactionExecutor *TransactionExecutor) *Oracle {
+func NewOracle(transactionExecutor *TransactionExecutor, timestampSource TimestampSource) *Oracle {
+	return NewOracleResumingFrom(transactionExecutor, timestampSource, 0)
+}
+
+// NewOracleResumingFrom creates a new instance of Oracle that resumes from the lastCommitTimestamp.
+// The lastCommitTimestamp is recovered from the durable state (the WAL), after all the commits till lastCommitTimestamp
+// are applied to the mvcc.MemTable.
+// Oracle is initialized with nextTimestamp as lastCommitTimestamp + 1, and beginTimestampMark and commitTimestampMark
+// are marked as finished for lastCommitTimestamp.
+func NewOracleResumingFrom(
+	transactionExecutor *TransactionExecutor,
+	timestampSource TimestampSource,
+	lastCommitTimestamp uint64,
+) *Oracle {
 	oracle := &Oracle{
-		nextTimestamp:       1,
-		transactionExecutor: transactionExecutor,
-		beginTimestampMark:  NewTransactionTimestampMark(),
-		commitTimestampMark: NewTransactionTimestampMark(),
+		nextTimestamp:        lastCommitTimestamp + 1,
+		timestampSource:      timestampSource,
+		transactionExecutor:  transactionExecutor,
+		beginTimestampMark:   NewTransactionTimestampMark(),
+		commitTimestampMark:  NewTransactionTimestampMark(),
+		pinnedTimestamps:     make(map[uint64]int),
+		executorSlot:         make(chan struct{}, 1),
+		commitTimestampByKey: make(map[uint64]uint64),
+		metrics:              newOracleMetrics(),
 	}
 
 	oracle.beginTimestampMark.Finish(oracle.nextTimestamp - 1)
@@ -56,25 +91,167 @@ func (oracle *Oracle) CommittedTransactionLength() int {
 	return len(oracle.committedTransactions)
 }
 
+// EnableConflictCounter enables the counting of the conflicts per key, and returns the ConflictCounter.
+// It must be invoked before any transaction starts.
+func (oracle *Oracle) EnableConflictCounter() *ConflictCounter {
+	oracle.conflictCounter = NewConflictCounter()
+	return oracle.conflictCounter
+}
+
+// ConflictCounter returns the ConflictCounter, nil if the counting of the conflicts is not enabled.
+func (oracle *Oracle) ConflictCounter() *ConflictCounter {
+	return oracle.conflictCounter
+}
+
+// Metrics returns a point-in-time snapshot of the metrics of the Oracle, its timestamp marks, the TransactionExecutor and
+// the mvcc.Storage. (More on this in Metrics).
+func (oracle *Oracle) Metrics() Metrics {
+	oracle.lock.Lock()
+	committedTransactions := len(oracle.committedTransactions)
+	nextTimestamp := oracle.nextTimestamp
+	oracle.lock.Unlock()
+
+	return Metrics{
+		Commits:                      oracle.metrics.commits.Value(),
+		FailedCommits:                oracle.metrics.failedCommits.Value(),
+		Conflicts:                    oracle.metrics.conflicts.Value(),
+		EmptyTransactionRejections:   oracle.metrics.emptyTransactionRejections.Value(),
+		ReadonlyTransactionsStarted:  oracle.metrics.readonlyTransactionsStarted.Value(),
+		ReadWriteTransactionsStarted: oracle.metrics.readWriteTransactionsStarted.Value(),
+		CommittedTransactions:        uint64(committedTransactions),
+		BeginTimestampDoneTill:       oracle.beginTimestampMark.DoneTill(),
+		CommitTimestampDoneTill:      oracle.commitTimestampMark.DoneTill(),
+		NextTimestamp:                nextTimestamp,
+		MemTableNodes:                oracle.transactionExecutor.storage.MemTableNodeCount(),
+		SubmittedBatches:             uint64(oracle.transactionExecutor.SubmittedBatches()),
+		BlockedTransactions:          uint64(oracle.BlockedTransactions()),
+		CommitLatency:                oracle.metrics.commitLatency.Snapshot(),
+		WaitForMarkDuration:          oracle.commitTimestampMark.WaitDurations(),
+	}
+}
+
+// SetMaxWaitForCommits bounds the time a new transaction waits for the commits before its beginTimestamp to be applied.
+// A transaction that waits longer is not created, txnErrors.WaitForMarkTimeoutErr is returned instead. A maxWait of 0
+// removes the bound.
+func (oracle *Oracle) SetMaxWaitForCommits(maxWait time.Duration) {
+	oracle.commitTimestampMark.SetMaxWait(maxWait)
+}
+
+// BlockedTransactions returns the number of new transactions that are blocked, waiting for the commits before their
+// beginTimestamps to be applied.
+func (oracle *Oracle) BlockedTransactions() int {
+	return oracle.commitTimestampMark.BlockedWaiters()
+}
+
+// WaitForCommits waits till all the transactions that got a commitTimestamp so far are applied, or returns the error of
+// the context (or of the commitTimestampMark) if the wait ends before that.
+func (oracle *Oracle) WaitForCommits(ctx context.Context) error {
+	oracle.lock.Lock()
+	lastCommitTimestamp := oracle.nextTimestamp - 1
+	oracle.lock.Unlock()
+
+	return oracle.commitTimestampMark.WaitForMark(ctx, lastCommitTimestamp)
+}
+
 // Stop stops `beginTimestampMark`, `commitTimestampMark` and `transactionExecutor`.
-func (oracle *Oracle) Stop() {
+// The timestamp marks are stopped while holding the executorSlot, so no commit is between getting its commitTimestamp and
+// being submitted to the transactionExecutor; the transactionExecutor then applies all the submitted commits before it stops.
+// The transactions that begin (or commit) after Stop get txnErrors.MarkStoppedErr.
+// Stop returns the error of stopping the transactionExecutor (More on this in TransactionExecutor.Stop).
+func (oracle *Oracle) Stop() error {
+	oracle.executorSlot <- struct{}{}
 	oracle.beginTimestampMark.Stop()
 	oracle.commitTimestampMark.Stop()
-	oracle.transactionExecutor.Stop()
+	oracle.releaseExecutorSlot()
+	return oracle.transactionExecutor.Stop()
 }
 
 // beginTimestamp returns the beginTimestamp of a transaction.
 // beginTimestamp = nextTimestamp - 1
 // Before returning the beginTimestamp, the system performs a wait on the commitTimestampMark.
 // This wait is to ensure that all the commits till beginTimestamp are applied.
-func (oracle *Oracle) beginTimestamp() uint64 {
+// If the context is done before (or while waiting for) the commits, the wait exceeds the max wait for the commits, or the
+// timestamp marks are stopped, the beginTimestamp is finished right away and the error is returned, so an abandoned
+// transaction does not hold back the beginTimestampMark.
+func (oracle *Oracle) beginTimestamp(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	oracle.lock.Lock()
 	beginTimestamp := oracle.nextTimestamp - 1
-	oracle.beginTimestampMark.Begin(beginTimestamp)
+	if err := oracle.beginTimestampMark.Begin(beginTimestamp); err != nil {
+		oracle.lock.Unlock()
+		return 0, err
+	}
 	oracle.lock.Unlock()
 
-	_ = oracle.commitTimestampMark.WaitForMark(context.Background(), beginTimestamp)
-	return beginTimestamp
+	if err := oracle.commitTimestampMark.WaitForMark(ctx, beginTimestamp); err != nil {
+		oracle.beginTimestampMark.Finish(beginTimestamp)
+		return 0, err
+	}
+	return beginTimestamp, nil
+}
+
+// acquireExecutorSlot acquires the executorSlot, or returns the error of the context if it is done before the slot is acquired.
+func (oracle *Oracle) acquireExecutorSlot(ctx context.Context) error {
+	select {
+	case oracle.executorSlot <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseExecutorSlot releases the executorSlot.
+func (oracle *Oracle) releaseExecutorSlot() {
+	<-oracle.executorSlot
+}
+
+// pinTimestamp pins the timestamp for a ReadonlyTransaction that reads at a caller supplied timestamp.
+// It returns TimestampBeyondCommitWatermarkErr if the commits till the timestamp are not applied yet, and
+// TimestampBelowVersionWatermarkErr if the versions visible at the timestamp may already be collected.
+// A pinned timestamp holds back the version collection till it is unpinned.
+func (oracle *Oracle) pinTimestamp(timestamp uint64) error {
+	oracle.lock.Lock()
+	defer oracle.lock.Unlock()
+
+	if timestamp > oracle.commitTimestampMark.DoneTill() {
+		return txnErrors.TimestampBeyondCommitWatermarkErr
+	}
+	if timestamp < oracle.versionCollectedTill {
+		return txnErrors.TimestampBelowVersionWatermarkErr
+	}
+	oracle.pinnedTimestamps[timestamp]++
+	return nil
+}
+
+// unpinTimestamp unpins the timestamp that was pinned by pinTimestamp.
+func (oracle *Oracle) unpinTimestamp(timestamp uint64) {
+	oracle.lock.Lock()
+	defer oracle.lock.Unlock()
+
+	oracle.pinnedTimestamps[timestamp]--
+	if oracle.pinnedTimestamps[timestamp] <= 0 {
+		delete(oracle.pinnedTimestamps, timestamp)
+	}
+}
+
+// versionWatermark returns the timestamp below which no transaction is running or will begin: the DoneTill of beginTimestampMark,
+// or the smallest pinned timestamp if it is lower. It is used by the VersionCollector.
+func (oracle *Oracle) versionWatermark() uint64 {
+	oracle.lock.Lock()
+	defer oracle.lock.Unlock()
+
+	watermark := oracle.beginTimestampMark.DoneTill()
+	for timestamp := range oracle.pinnedTimestamps {
+		if timestamp < watermark {
+			watermark = timestamp
+		}
+	}
+	if watermark > oracle.versionCollectedTill {
+		oracle.versionCollectedTill = watermark
+	}
+	return watermark
 }
 
 // mayBeCommitTimestampFor returns the commitTimestamp for a  transaction if there are no conflicts.
@@ -83,82 +260,168 @@ func (oracle *Oracle) beginTimestamp() uint64 {
 // If there are no conflicts:
 // 1. the current transaction is marked as `beginFinished` by invoking finishBeginTimestampForReadWriteTransaction.
 // 2. committedTransactions are cleaned up.
-// 3. commitTimestamp is assigned to the transaction and the nextTimestamp is increased by 1
-// 4. The current transaction is tracked as CommittedTransaction
-// 5. commitTimestampMark is used to indicate that a transaction with the `commitTimestamp` has begun.
+// 3. commitTimestamp is generated by the timestampSource (it is greater than the beginTimestamp of every running transaction),
+// and the nextTimestamp becomes commitTimestamp + 1
+// 4. commitTimestampMark is used to indicate that a transaction with the `commitTimestamp` has begun (if the commitTimestampMark
+// is stopped, txnErrors.MarkStoppedErr is returned and the commitTimestamp is not used).
+// 5. The current transaction is tracked as CommittedTransaction
 // The cleanup of committedTransactions removes all the committed transactions Ti...Tj where the commitTimestamp of Ti <= maxBeginTransactionTimestamp.
 func (oracle *Oracle) mayBeCommitTimestampFor(transaction *ReadWriteTransaction) (uint64, error) {
 	oracle.lock.Lock()
 	defer oracle.lock.Unlock()
 
-	if oracle.hasConflictFor(transaction) {
-		return 0, txnErrors.ConflictErr
+	if conflictErr := oracle.conflictFor(transaction); conflictErr != nil {
+		oracle.metrics.conflicts.Increment()
+		if oracle.conflictCounter != nil {
+			oracle.conflictCounter.record(conflictErr.Keys)
+		}
+		return 0, conflictErr
 	}
 
 	oracle.finishBeginTimestampForReadWriteTransaction(transaction)
 	oracle.cleanupCommittedTransactions()
 
-	commitTimestamp := oracle.nextTimestamp
-	oracle.nextTimestamp = oracle.nextTimestamp + 1
+	commitTimestamp := oracle.timestampSource.Next(oracle.nextTimestamp - 1)
+	if err := oracle.commitTimestampMark.Begin(commitTimestamp); err != nil {
+		return 0, err
+	}
+	oracle.nextTimestamp = commitTimestamp + 1
 
 	oracle.trackReadyToCommitTransaction(transaction, commitTimestamp)
-	oracle.commitTimestampMark.Begin(commitTimestamp)
 	return commitTimestamp, nil
 }
 
-// hasConflictFor determines of the transaction has a conflict with other concurrent transactions.
-// A ReadWriteTransaction Tx conflicts with other transaction if:
+// conflictFor determines if the transaction has a conflict with other concurrent transactions, and returns a
+// txnErrors.ConflictError describing the conflict, nil if there is no conflict.
+// The conflicts that are checked depend on the IsolationLevel of the transaction.
+//
+// With SerializableSnapshotIsolation, a ReadWriteTransaction Tx conflicts with other transaction if:
 // the keys read by the transaction Tx are modified by another transaction that has the commitTimestamp > beginTimestampOf(Tx).
 // ReadWriteTransaction tracks its read keys in the `reads` property.
-func (oracle *Oracle) hasConflictFor(transaction *ReadWriteTransaction) bool {
-	for _, committedTransaction := range oracle.committedTransactions {
-		if committedTransaction.commitTimestamp <= transaction.beginTimestamp {
-			continue
+// Deleted keys are a part of the Batch of the committed transaction, so a delete conflicts with a read the same way a put does.
+// ReadWriteTransaction also tracks the key ranges that it reads in the `rangeReads` property. The transaction Tx conflicts
+// if any key written by another transaction with the commitTimestamp > beginTimestampOf(Tx) falls in one of these ranges.
+// This prevents phantoms: the keys inserted in a range after the range was read.
+//
+// With SnapshotIsolation, a ReadWriteTransaction Tx conflicts with other transaction if:
+// the keys written (or deleted) by the transaction Tx, which are in its Batch, are modified by another transaction that has
+// the commitTimestamp > beginTimestampOf(Tx). The reads are not checked.
+//
+// The point reads (and the writes) are looked up in `commitTimestampByKey`. Two different keys may share a hash, which
+// can only result in a false conflict (the transaction aborts and can be retried), never in a missed conflict.
+// A hash does not help with a key range, so the range reads are still checked against the Batches of the committedTransactions.
+// The ConflictError carries all the conflicting keys (each key once), each with the commitTimestamp of the transaction that
+// wrote it: the commitTimestamp from `commitTimestampByKey` for a point read (or write), and the commitTimestamp of the
+// committed transaction for a key in a range read. A key found more than once keeps the latest commitTimestamp.
+func (oracle *Oracle) conflictFor(transaction *ReadWriteTransaction) *txnErrors.ConflictError {
+	var conflictingKeys []txnErrors.ConflictingKey
+	positionByKey := make(map[string]int)
+	addConflictingKey := func(key []byte, commitTimestamp uint64) {
+		position, ok := positionByKey[string(key)]
+		if !ok {
+			positionByKey[string(key)] = len(conflictingKeys)
+			conflictingKeys = append(conflictingKeys, txnErrors.ConflictingKey{Key: key, CommitTimestamp: commitTimestamp})
+			return
+		}
+		if commitTimestamp > conflictingKeys[position].CommitTimestamp {
+			conflictingKeys[position].CommitTimestamp = commitTimestamp
 		}
+	}
 
-		for _, key := range transaction.reads {
-			if committedTransaction.transaction.batch.Contains(key) {
-				return true
+	pointKeys := transaction.reads
+	if transaction.isolationLevel == SnapshotIsolation {
+		pointKeys = transaction.batch.keys()
+	}
+	for _, key := range pointKeys {
+		if commitTimestamp, ok := oracle.commitTimestampByKey[hashOf(key)]; ok && commitTimestamp > transaction.beginTimestamp {
+			addConflictingKey(key, commitTimestamp)
+		}
+	}
+	if transaction.isolationLevel == SerializableSnapshotIsolation && len(transaction.rangeReads) > 0 {
+		for _, committedTransaction := range oracle.committedTransactions {
+			if committedTransaction.commitTimestamp <= transaction.beginTimestamp {
+				continue
+			}
+			for _, keyRange := range transaction.rangeReads {
+				for _, key := range committedTransaction.transaction.batch.KeysIn(keyRange) {
+					addConflictingKey(key, committedTransaction.commitTimestamp)
+				}
 			}
 		}
 	}
-	return false
+	if len(conflictingKeys) == 0 {
+		return nil
+	}
+	return &txnErrors.ConflictError{
+		Keys:           conflictingKeys,
+		BeginTimestamp: transaction.beginTimestamp,
+	}
 }
 
 // finishBeginTimestampForReadWriteTransaction indicates that the beginTimestamp of the transaction is finished.
 // This is an indication to the TransactionTimestampMark that all the transactions upto a given `beginTimestamp`
 // are done. This information will be used in cleaning up the committed transactions.
+// The beginTimestamp of a transaction is finished only once, even if this method is invoked more than once.
 func (oracle *Oracle) finishBeginTimestampForReadWriteTransaction(transaction *ReadWriteTransaction) {
-	oracle.beginTimestampMark.Finish(transaction.beginTimestamp)
+	if transaction.beginTimestampFinished.CompareAndSwap(false, true) {
+		oracle.beginTimestampMark.Finish(transaction.beginTimestamp)
+	}
 }
 
 // finishBeginTimestampForReadonlyTransaction indicates that the beginTimestamp of the transaction is finished.
+// The beginTimestamp of a transaction is finished only once, even if this method is invoked more than once.
+// A ReadonlyTransaction with a pinned timestamp does not take part in beginTimestampMark, its timestamp is unpinned instead.
 func (oracle *Oracle) finishBeginTimestampForReadonlyTransaction(transaction *ReadonlyTransaction) {
-	oracle.beginTimestampMark.Finish(transaction.beginTimestamp)
+	if transaction.beginTimestampFinished.CompareAndSwap(false, true) {
+		if transaction.pinned {
+			oracle.unpinTimestamp(transaction.beginTimestamp)
+			return
+		}
+		oracle.beginTimestampMark.Finish(transaction.beginTimestamp)
+	}
 }
 
 // cleanupCommittedTransactions cleans up the committed transactions.
 // In order to clean up the committed transactions we do the following:
 // 1. Get the latest beginTimestampMark
-// 2. For all the committed transactions, if the transaction.commitTimestamp <= maxBeginTransactionTimestamp, skip this transaction
-// 3. Create a new array (or slice) of CommittedTransaction excluding the transactions from step 2.
+// 2. The committed transactions are tracked in the increasing order of their commitTimestamps, so all the transactions with
+// transaction.commitTimestamp <= maxBeginTransactionTimestamp are at the front; no running or future transaction can conflict with them.
+// 3. Remove these transactions, along with their keys from `commitTimestampByKey` (unless a later transaction wrote the key).
 func (oracle *Oracle) cleanupCommittedTransactions() {
-	updatedCommittedTransactions := oracle.committedTransactions[:0]
 	maxBeginTransactionTimestamp := oracle.beginTimestampMark.DoneTill()
 
-	for _, transaction := range oracle.committedTransactions {
-		if transaction.commitTimestamp <= maxBeginTransactionTimestamp {
-			continue
+	removed := 0
+	for ; removed < len(oracle.committedTransactions); removed++ {
+		committedTransaction := oracle.committedTransactions[removed]
+		if committedTransaction.commitTimestamp > maxBeginTransactionTimestamp {
+			break
+		}
+		for _, key := range committedTransaction.transaction.batch.keys() {
+			hash := hashOf(key)
+			if oracle.commitTimestampByKey[hash] == committedTransaction.commitTimestamp {
+				delete(oracle.commitTimestampByKey, hash)
+			}
 		}
-		updatedCommittedTransactions = append(updatedCommittedTransactions, transaction)
+		oracle.committedTransactions[removed] = CommittedTransaction{}
 	}
-	oracle.committedTransactions = updatedCommittedTransactions
+	oracle.committedTransactions = oracle.committedTransactions[removed:]
 }
 
-// trackReadyToCommitTransaction tracks all the transactions that are ready to be committed.
+// trackReadyToCommitTransaction tracks all the transactions that are ready to be committed, and indexes their keys
+// in `commitTimestampByKey`.
 func (oracle *Oracle) trackReadyToCommitTransaction(transaction *ReadWriteTransaction, commitTimestamp uint64) {
 	oracle.committedTransactions = append(oracle.committedTransactions, CommittedTransaction{
 		commitTimestamp: commitTimestamp,
 		transaction:     transaction,
 	})
+	for _, key := range transaction.batch.keys() {
+		oracle.commitTimestampByKey[hashOf(key)] = commitTimestamp
+	}
+}
+
+// hashOf returns the 64-bit FNV-1a hash of the key.
+func hashOf(key []byte) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write(key)
+	return hash.Sum64()
 }
@@ -0,0 +1,74 @@
+package txn
+
+import (
+	"context"
+	"fmt"
+	"serialized-snapshot-isolation/mvcc"
+	"testing"
+)
+
+const (
+	benchmarkInFlightTransactions = 5_000
+	benchmarkWritesPerTransaction = 4
+	benchmarkReadsPerTransaction  = 16
+)
+
+// linearScanHasConflictFor checks for the RW conflicts by scanning all the committed transactions, and the Batch of every
+// committed transaction for every read key, the way Oracle did before it indexed the keys of the committed transactions.
+// It is the baseline for the conflict check with thousands of in-flight transactions.
+func linearScanHasConflictFor(oracle *Oracle, transaction *ReadWriteTransaction) bool {
+	for _, committedTransaction := range oracle.committedTransactions {
+		if committedTransaction.commitTimestamp <= transaction.beginTimestamp {
+			continue
+		}
+		for _, key := range transaction.reads {
+			if committedTransaction.transaction.batch.Contains(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// oracleWithInFlightTransactions creates an Oracle that tracks benchmarkInFlightTransactions committed transactions, which
+// can not be cleaned up because a transaction that began before all of them is still running. It returns the Oracle
+// and that transaction, which has read benchmarkReadsPerTransaction keys that none of the committed transactions wrote.
+func oracleWithInFlightTransactions(b *testing.B) (*Oracle, *ReadWriteTransaction) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(16)), NewCounterTimestampSource())
+	b.Cleanup(func() { _ = oracle.Stop() })
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	for count := 0; count < benchmarkReadsPerTransaction; count++ {
+		transaction.reads = append(transaction.reads, []byte(fmt.Sprintf("read-%d", count)))
+	}
+	for count := 1; count <= benchmarkInFlightTransactions; count++ {
+		committedTransaction := &ReadWriteTransaction{batch: NewBatch()}
+		for write := 0; write < benchmarkWritesPerTransaction; write++ {
+			_ = committedTransaction.PutOrUpdate([]byte(fmt.Sprintf("write-%d-%d", count, write)), []byte("value"))
+		}
+		oracle.trackReadyToCommitTransaction(committedTransaction, uint64(count))
+	}
+	return oracle, transaction
+}
+
+func BenchmarkConflictCheckWithLinearScanOfInFlightTransactions(b *testing.B) {
+	oracle, transaction := oracleWithInFlightTransactions(b)
+
+	b.ResetTimer()
+	for count := 0; count < b.N; count++ {
+		if linearScanHasConflictFor(oracle, transaction) {
+			b.Fatal("unexpected conflict")
+		}
+	}
+}
+
+func BenchmarkConflictCheckWithIndexOfInFlightTransactions(b *testing.B) {
+	oracle, transaction := oracleWithInFlightTransactions(b)
+
+	b.ResetTimer()
+	for count := 0; count < b.N; count++ {
+		if oracle.conflictFor(transaction) != nil {
+			b.Fatal("unexpected conflict")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package txn
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"serialized-snapshot-isolation/mvcc"
 	"testing"
@@ -9,11 +10,11 @@ import (
 
 func TestBeginTimestampMarkWithASingleTransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
 	beginMark := oracle.beginTimestampMark
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	transaction.Get([]byte("HDD"))
 	transaction.FinishBeginTimestampForReadWriteTransaction()
 
@@ -28,18 +29,18 @@ func TestBeginTimestampMarkWithASingleTransaction(t *testing.T) {
 
 func TestBeginTimestampMarkWithTwoTransactions(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
 	beginMark := oracle.beginTimestampMark
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(transaction)
 
 	oracle.commitTimestampMark.Finish(commitTimestamp)
 	transaction.FinishBeginTimestampForReadWriteTransaction()
 	assert.Equal(t, uint64(1), commitTimestamp)
 
-	anotherTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(anotherTransaction)
 	oracle.commitTimestampMark.Finish(commitTimestamp)
 	anotherTransaction.FinishBeginTimestampForReadWriteTransaction()
@@ -51,17 +52,17 @@ func TestBeginTimestampMarkWithTwoTransactions(t *testing.T) {
 
 func TestCleanUpOfCommittedTransactions(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
 	beginMark := oracle.beginTimestampMark
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(transaction)
 	oracle.commitTimestampMark.Finish(commitTimestamp)
 	transaction.FinishBeginTimestampForReadWriteTransaction()
 	assert.Equal(t, uint64(1), commitTimestamp)
 
-	anotherTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(anotherTransaction)
 	oracle.commitTimestampMark.Finish(commitTimestamp)
 	anotherTransaction.FinishBeginTimestampForReadWriteTransaction()
@@ -70,7 +71,7 @@ func TestCleanUpOfCommittedTransactions(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 	assert.Equal(t, uint64(1), beginMark.DoneTill())
 
-	thirdTransaction := NewReadWriteTransaction(oracle)
+	thirdTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(thirdTransaction)
 	oracle.commitTimestampMark.Finish(commitTimestamp)
 	thirdTransaction.FinishBeginTimestampForReadWriteTransaction()
@@ -83,3 +84,57 @@ func TestCleanUpOfCommittedTransactions(t *testing.T) {
 	assert.Equal(t, 1, len(committedTransactions))
 	assert.Equal(t, uint64(3), committedTransactions[0].commitTimestamp)
 }
+
+func TestCleanUpOfTheIndexedKeysOfCommittedTransactions(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	beginMark := oracle.beginTimestampMark
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	_ = transaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(transaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+	assert.Equal(t, 2, len(oracle.commitTimestampByKey))
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
+	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(anotherTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	assert.Eventually(t, func() bool {
+		return beginMark.DoneTill() == 1
+	}, time.Second, 5*time.Millisecond)
+
+	oracle.lock.Lock()
+	oracle.cleanupCommittedTransactions()
+	oracle.lock.Unlock()
+
+	assert.Equal(t, 1, len(oracle.committedTransactions))
+	assert.Equal(t, map[uint64]uint64{hashOf([]byte("HDD")): 2}, oracle.commitTimestampByKey)
+}
+
+func TestBeginTimestampMarkWithATransactionFinishedTwice(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 3
+	oracle.commitTimestampMark.Finish(2)
+
+	beginMark := oracle.beginTimestampMark
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	anotherTransaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+
+	transaction.FinishBeginTimestampForReadWriteTransaction()
+	transaction.FinishBeginTimestampForReadWriteTransaction()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, uint64(0), beginMark.DoneTill())
+
+	anotherTransaction.FinishBeginTimestampForReadonlyTransaction()
+	anotherTransaction.FinishBeginTimestampForReadonlyTransaction()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, uint64(2), beginMark.DoneTill())
+}
@@ -1,6 +1,7 @@
 package txn
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"serialized-snapshot-isolation/mvcc"
 	"serialized-snapshot-isolation/txn/errors"
@@ -9,29 +10,32 @@ import (
 
 func TestGetsTheBeginTimestamp(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
-	assert.Equal(t, uint64(0), oracle.beginTimestamp())
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	beginTimestamp, err := oracle.beginTimestamp(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), beginTimestamp)
 }
 
 func TestGetsTheBeginTimestampAfterACommit(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	transaction.Get([]byte("HDD"))
 
 	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(transaction)
 	oracle.commitTimestampMark.Finish(commitTimestamp)
 
 	assert.Equal(t, uint64(1), commitTimestamp)
-	assert.Equal(t, uint64(1), oracle.beginTimestamp())
+	beginTimestamp, _ := oracle.beginTimestamp(context.Background())
+	assert.Equal(t, uint64(1), beginTimestamp)
 }
 
 func TestGetsCommitTimestampForTransactionGivenNoTransactionsAreCurrentlyTracked(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	transaction.Get([]byte("HDD"))
 
 	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(transaction)
@@ -40,9 +44,9 @@ func TestGetsCommitTimestampForTransactionGivenNoTransactionsAreCurrentlyTracked
 
 func TestGetsCommitTimestampFor2Transactions(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
-	aTransaction := NewReadWriteTransaction(oracle)
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	aTransaction.Get([]byte("HDD"))
 
 	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(aTransaction)
@@ -50,7 +54,7 @@ func TestGetsCommitTimestampFor2Transactions(t *testing.T) {
 
 	assert.Equal(t, uint64(1), commitTimestamp)
 
-	anotherTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	anotherTransaction.Get([]byte("SSD"))
 
 	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(anotherTransaction)
@@ -61,9 +65,9 @@ func TestGetsCommitTimestampFor2Transactions(t *testing.T) {
 
 func TestGetsCommitTimestampFor2TransactionsGivenOneTransactionReadTheKeyThatTheOtherWrites(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
-	aTransaction := NewReadWriteTransaction(oracle)
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	_ = aTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 
 	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(aTransaction)
@@ -72,7 +76,7 @@ func TestGetsCommitTimestampFor2TransactionsGivenOneTransactionReadTheKeyThatThe
 	assert.Equal(t, uint64(1), commitTimestamp)
 	assert.Equal(t, 1, len(oracle.committedTransactions))
 
-	anotherTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	anotherTransaction.Get([]byte("HDD"))
 
 	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(anotherTransaction)
@@ -83,9 +87,9 @@ func TestGetsCommitTimestampFor2TransactionsGivenOneTransactionReadTheKeyThatThe
 
 func TestErrorsForOneTransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
-	aTransaction := NewReadWriteTransaction(oracle)
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	_ = aTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 
 	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(aTransaction)
@@ -94,11 +98,11 @@ func TestErrorsForOneTransaction(t *testing.T) {
 	assert.Equal(t, uint64(1), commitTimestamp)
 	assert.Equal(t, 1, len(oracle.committedTransactions))
 
-	anotherTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	_ = anotherTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
 	anotherTransaction.Get([]byte("HDD"))
 
-	thirdTransaction := NewReadWriteTransaction(oracle)
+	thirdTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	thirdTransaction.Get([]byte("HDD"))
 
 	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(anotherTransaction)
@@ -108,5 +112,186 @@ func TestErrorsForOneTransaction(t *testing.T) {
 
 	_, err := oracle.mayBeCommitTimestampFor(thirdTransaction)
 	assert.Error(t, err)
-	assert.Equal(t, errors.ConflictErr, err)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+}
+
+func TestErrorsForOneTransactionGivenItReadTheKeyThatTheOtherDeletes(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = aTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(aTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.Delete([]byte("HDD"))
+
+	thirdTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	thirdTransaction.Get([]byte("HDD"))
+
+	commitTimestamp, _ = oracle.mayBeCommitTimestampFor(anotherTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	assert.Equal(t, uint64(2), commitTimestamp)
+
+	_, err := oracle.mayBeCommitTimestampFor(thirdTransaction)
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+}
+
+func TestErrorsForOneTransactionGivenItReadTheKeyRangeThatTheOtherWritesIn(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	aTransaction.NewRangeIterator([]byte("order/42/"), []byte("order/43/")).Close()
+	_ = aTransaction.PutOrUpdate([]byte("order/42/total"), []byte("0"))
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.PutOrUpdate([]byte("order/42/item/1"), []byte("Hard disk"))
+
+	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(anotherTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	assert.Equal(t, uint64(1), commitTimestamp)
+
+	_, err := oracle.mayBeCommitTimestampFor(aTransaction)
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+}
+
+func TestErrorsForOneTransactionGivenItIteratedOverAllTheKeysAndTheOtherInsertsAKey(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	iterator := aTransaction.NewIterator()
+	for iterator.Seek(nil); iterator.Valid(); iterator.Next() {
+	}
+	iterator.Close()
+	_ = aTransaction.PutOrUpdate([]byte("count"), []byte("0"))
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+
+	_, err := aTransaction.Commit(context.Background())
+	assert.ErrorIs(t, err, errors.ConflictErr)
+}
+
+func TestReportsTheDetailsOfAConflict(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	aTransaction.Get([]byte("HDD"))
+	aTransaction.Get([]byte("SSD"))
+	aTransaction.NewRangeIterator([]byte("order/42/"), []byte("order/43/")).Close()
+	_ = aTransaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	_ = anotherTransaction.PutOrUpdate([]byte("order/42/item/1"), []byte("Hard disk"))
+	_ = anotherTransaction.PutOrUpdate([]byte("order/99/item/1"), []byte("Solid state"))
+
+	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(anotherTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	_, err := oracle.mayBeCommitTimestampFor(aTransaction)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+
+	var conflictError *errors.ConflictError
+	assert.ErrorAs(t, err, &conflictError)
+	assert.Equal(t, []errors.ConflictingKey{
+		{Key: []byte("HDD"), CommitTimestamp: 1},
+		{Key: []byte("order/42/item/1"), CommitTimestamp: 1},
+	}, conflictError.Keys)
+	assert.Equal(t, uint64(0), conflictError.BeginTimestamp)
+}
+
+func TestReportsTheCommitTimestampOfEveryConflictingKey(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	aTransaction.Get([]byte("HDD"))
+	aTransaction.Get([]byte("SSD"))
+	aTransaction.NewRangeIterator([]byte("order/42/"), []byte("order/43/")).Close()
+	_ = aTransaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+
+	commitWriting := func(keys ...string) uint64 {
+		transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+		for _, key := range keys {
+			_ = transaction.PutOrUpdate([]byte(key), []byte("Hard disk"))
+		}
+		commitTimestamp, err := oracle.mayBeCommitTimestampFor(transaction)
+		assert.Nil(t, err)
+		oracle.commitTimestampMark.Finish(commitTimestamp)
+		return commitTimestamp
+	}
+	hddCommitTimestamp := commitWriting("HDD")
+	orderCommitTimestamp := commitWriting("order/42/item/1")
+	ssdCommitTimestamp := commitWriting("SSD", "order/42/item/1")
+
+	_, err := oracle.mayBeCommitTimestampFor(aTransaction)
+
+	var conflictError *errors.ConflictError
+	assert.ErrorAs(t, err, &conflictError)
+	assert.Less(t, orderCommitTimestamp, ssdCommitTimestamp)
+	assert.Equal(t, []errors.ConflictingKey{
+		{Key: []byte("HDD"), CommitTimestamp: hddCommitTimestamp},
+		{Key: []byte("SSD"), CommitTimestamp: ssdCommitTimestamp},
+		{Key: []byte("order/42/item/1"), CommitTimestamp: ssdCommitTimestamp},
+	}, conflictError.Keys)
+}
+
+func TestCountsTheConflictsPerKey(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	counter := oracle.EnableConflictCounter()
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	aTransaction.Get([]byte("HDD"))
+	_ = aTransaction.PutOrUpdate([]byte("isolation"), []byte("Snapshot"))
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	anotherTransaction.Get([]byte("HDD"))
+	anotherTransaction.Get([]byte("SSD"))
+	_ = anotherTransaction.PutOrUpdate([]byte("isolation"), []byte("Serializable"))
+
+	thirdTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = thirdTransaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	_ = thirdTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+
+	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(thirdTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	_, err := oracle.mayBeCommitTimestampFor(aTransaction)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+	_, err = oracle.mayBeCommitTimestampFor(anotherTransaction)
+	assert.ErrorIs(t, err, errors.ConflictErr)
+
+	assert.Equal(t, uint64(2), counter.ConflictsOf([]byte("HDD")))
+	assert.Equal(t, uint64(1), counter.ConflictsOf([]byte("SSD")))
+	assert.Equal(t, uint64(0), counter.ConflictsOf([]byte("isolation")))
+	assert.Equal(t, []KeyConflicts{{Key: []byte("HDD"), Conflicts: 2}}, counter.HotKeys(1))
+}
+
+func TestGetsCommitTimestampForTransactionGivenTheOtherWritesOutsideTheKeyRangeItRead(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	aTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	aTransaction.NewRangeIterator([]byte("order/42/"), []byte("order/43/")).Close()
+	_ = aTransaction.PutOrUpdate([]byte("order/42/total"), []byte("0"))
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.PutOrUpdate([]byte("order/43/item/1"), []byte("Hard disk"))
+
+	commitTimestamp, _ := oracle.mayBeCommitTimestampFor(anotherTransaction)
+	oracle.commitTimestampMark.Finish(commitTimestamp)
+
+	commitTimestamp, err := oracle.mayBeCommitTimestampFor(aTransaction)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), commitTimestamp)
 }
@@ -0,0 +1,102 @@
+package txn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// hybridLogicalClockLogicalBits is the number of the lower bits of a hybrid logical clock timestamp that hold the logical counter.
+const hybridLogicalClockLogicalBits = 16
+
+// TimestampSource generates the commitTimestamps that the Oracle assigns to the ReadWriteTransactions.
+// Next is invoked by the Oracle (holding its lock) with the last assigned commitTimestamp, and it must return a timestamp
+// greater than lastCommitTimestamp. Every TimestampSource honors this, even if the clock it is based on goes backwards,
+// so the commitTimestamps are strictly increasing and a transaction always begins at (or after) the last commitTimestamp.
+// The timestamps need not be consecutive.
+type TimestampSource interface {
+	Next(lastCommitTimestamp uint64) uint64
+}
+
+// CounterTimestampSource is a monotonic counter: the next commitTimestamp is always lastCommitTimestamp + 1.
+// It is the default TimestampSource.
+type CounterTimestampSource struct{}
+
+// NewCounterTimestampSource creates a new instance of CounterTimestampSource.
+func NewCounterTimestampSource() *CounterTimestampSource {
+	return &CounterTimestampSource{}
+}
+
+// Next returns lastCommitTimestamp + 1.
+func (source *CounterTimestampSource) Next(lastCommitTimestamp uint64) uint64 {
+	return lastCommitTimestamp + 1
+}
+
+// WallClockTimestampSource derives the commitTimestamps from the wall clock: a commitTimestamp is the number of nanoseconds
+// since the Unix epoch, so it can be compared against the real time.
+// If the clock does not move ahead of the lastCommitTimestamp (two commits within the resolution of the clock, or the
+// clock going backwards), the next commitTimestamp is lastCommitTimestamp + 1.
+type WallClockTimestampSource struct {
+	clock func() time.Time
+}
+
+// NewWallClockTimestampSource creates a new instance of WallClockTimestampSource that reads time.Now.
+func NewWallClockTimestampSource() *WallClockTimestampSource {
+	return &WallClockTimestampSource{clock: time.Now}
+}
+
+// Next returns the current time in nanoseconds, or lastCommitTimestamp + 1 if the current time is not after the lastCommitTimestamp.
+func (source *WallClockTimestampSource) Next(lastCommitTimestamp uint64) uint64 {
+	now := uint64(source.clock().UnixNano())
+	if now <= lastCommitTimestamp {
+		return lastCommitTimestamp + 1
+	}
+	return now
+}
+
+// HybridLogicalClockTimestampSource is a hybrid logical clock (HLC), which makes the commitTimestamps comparable
+// with the timestamps of other processes.
+// A timestamp holds the physical time in milliseconds in its upper 48 bits and a logical counter in its lower 16 bits.
+// The next timestamp is the current physical time (with a logical counter of 0) if it is ahead of the lastCommitTimestamp
+// and the last observed timestamp, else the greater of the two + 1 (the logical counter moves ahead). More than 65536
+// commits within a millisecond carry over into the physical time, which only moves the clock ahead.
+// Observe is invoked with the timestamps received from other processes, so that the following commitTimestamps are
+// greater than them (causality across the processes).
+type HybridLogicalClockTimestampSource struct {
+	clock    func() time.Time
+	observed atomic.Uint64
+}
+
+// NewHybridLogicalClockTimestampSource creates a new instance of HybridLogicalClockTimestampSource that reads time.Now.
+func NewHybridLogicalClockTimestampSource() *HybridLogicalClockTimestampSource {
+	return &HybridLogicalClockTimestampSource{clock: time.Now}
+}
+
+// Next returns the next hybrid logical clock timestamp, which is greater than both the lastCommitTimestamp and the
+// timestamps that were observed.
+func (source *HybridLogicalClockTimestampSource) Next(lastCommitTimestamp uint64) uint64 {
+	last := lastCommitTimestamp
+	if observed := source.observed.Load(); observed > last {
+		last = observed
+	}
+	physical := uint64(source.clock().UnixMilli()) << hybridLogicalClockLogicalBits
+	if physical <= last {
+		return last + 1
+	}
+	return physical
+}
+
+// Observe records a timestamp received from another process. Every commitTimestamp that is generated after Observe returns
+// is greater than the timestamp.
+func (source *HybridLogicalClockTimestampSource) Observe(timestamp uint64) {
+	for {
+		observed := source.observed.Load()
+		if timestamp <= observed || source.observed.CompareAndSwap(observed, timestamp) {
+			return
+		}
+	}
+}
+
+// PhysicalTime returns the physical time held by a hybrid logical clock timestamp.
+func (source *HybridLogicalClockTimestampSource) PhysicalTime(timestamp uint64) time.Time {
+	return time.UnixMilli(int64(timestamp >> hybridLogicalClockLogicalBits))
+}
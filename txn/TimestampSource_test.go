@@ -0,0 +1,171 @@
+package txn
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"serialized-snapshot-isolation/mvcc"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// steppingClock returns a clock that moves by the next step (in milliseconds, possibly backwards) every time it is read.
+func steppingClock(steps []int16) func() time.Time {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	index := 0
+	return func() time.Time {
+		if len(steps) > 0 {
+			now = now.Add(time.Duration(steps[index%len(steps)]) * time.Millisecond)
+			index++
+		}
+		return now
+	}
+}
+
+// oracleInvariantsHold runs the operations against an Oracle with the timestampSource, and checks the invariants of
+// beginTimestamp and mayBeCommitTimestampFor:
+// 1. the commitTimestamps are strictly increasing,
+// 2. the commitTimestamp of a transaction is greater than its beginTimestamp,
+// 3. a transaction that begins after a commit, begins at the commitTimestamp of that commit.
+// An operation (modulo 3) begins a transaction, commits the oldest running transaction, or observes a timestamp (if the
+// timestampSource is a HybridLogicalClockTimestampSource).
+func oracleInvariantsHold(timestampSource TimestampSource, operations []uint8) bool {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), timestampSource)
+	defer oracle.Stop()
+
+	var running []*ReadWriteTransaction
+	var lastCommitTimestamp uint64
+	for index, operation := range operations {
+		switch operation % 3 {
+		case 0:
+			transaction, err := NewReadWriteTransaction(context.Background(), oracle)
+			if err != nil || transaction.beginTimestamp != lastCommitTimestamp {
+				return false
+			}
+			running = append(running, transaction)
+		case 1:
+			if len(running) == 0 {
+				continue
+			}
+			transaction := running[0]
+			running = running[1:]
+			_ = transaction.PutOrUpdate([]byte{byte(index), byte(index >> 8)}, []byte("value"))
+
+			commitTimestamp, err := oracle.mayBeCommitTimestampFor(transaction)
+			if err != nil || commitTimestamp <= lastCommitTimestamp || commitTimestamp <= transaction.beginTimestamp {
+				return false
+			}
+			oracle.commitTimestampMark.Finish(commitTimestamp)
+			lastCommitTimestamp = commitTimestamp
+		case 2:
+			if hybridLogicalClock, ok := timestampSource.(*HybridLogicalClockTimestampSource); ok {
+				hybridLogicalClock.Observe(lastCommitTimestamp + uint64(operation)<<hybridLogicalClockLogicalBits)
+			}
+		}
+	}
+	for _, transaction := range running {
+		transaction.FinishBeginTimestampForReadWriteTransaction()
+	}
+	return true
+}
+
+func TestTheOracleInvariantsHoldWithTheCounterTimestampSource(t *testing.T) {
+	property := func(operations []uint8) bool {
+		return oracleInvariantsHold(NewCounterTimestampSource(), operations)
+	}
+	assert.Nil(t, quick.Check(property, &quick.Config{MaxCount: 50}))
+}
+
+func TestTheOracleInvariantsHoldWithTheWallClockTimestampSource(t *testing.T) {
+	property := func(operations []uint8, steps []int16) bool {
+		return oracleInvariantsHold(&WallClockTimestampSource{clock: steppingClock(steps)}, operations)
+	}
+	assert.Nil(t, quick.Check(property, &quick.Config{MaxCount: 50}))
+}
+
+func TestTheOracleInvariantsHoldWithTheHybridLogicalClockTimestampSource(t *testing.T) {
+	property := func(operations []uint8, steps []int16) bool {
+		return oracleInvariantsHold(&HybridLogicalClockTimestampSource{clock: steppingClock(steps)}, operations)
+	}
+	assert.Nil(t, quick.Check(property, &quick.Config{MaxCount: 50}))
+}
+
+func TestTheWallClockTimestampSourceNeverGoesBackwards(t *testing.T) {
+	property := func(steps []int16) bool {
+		timestampSource := &WallClockTimestampSource{clock: steppingClock(steps)}
+		var lastCommitTimestamp uint64
+		for range steps {
+			commitTimestamp := timestampSource.Next(lastCommitTimestamp)
+			if commitTimestamp <= lastCommitTimestamp {
+				return false
+			}
+			lastCommitTimestamp = commitTimestamp
+		}
+		return true
+	}
+	assert.Nil(t, quick.Check(property, nil))
+}
+
+func TestTheHybridLogicalClockTimestampSourceIsAheadOfThePhysicalTimeAndTheObservedTimestamps(t *testing.T) {
+	property := func(steps []int16, observed []uint32) bool {
+		clock := steppingClock(steps)
+		var now time.Time
+		timestampSource := &HybridLogicalClockTimestampSource{clock: func() time.Time {
+			now = clock()
+			return now
+		}}
+		var lastCommitTimestamp uint64
+		for index := range steps {
+			var observedTimestamp uint64
+			if index < len(observed) {
+				observedTimestamp = lastCommitTimestamp + uint64(observed[index])
+				timestampSource.Observe(observedTimestamp)
+			}
+			commitTimestamp := timestampSource.Next(lastCommitTimestamp)
+			if commitTimestamp <= lastCommitTimestamp || commitTimestamp <= observedTimestamp {
+				return false
+			}
+			if timestampSource.PhysicalTime(commitTimestamp).Before(now.Truncate(time.Millisecond)) {
+				return false
+			}
+			lastCommitTimestamp = commitTimestamp
+		}
+		return true
+	}
+	assert.Nil(t, quick.Check(property, nil))
+}
+
+func TestTheWallClockTimestampSourceReturnsTheCurrentTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timestampSource := &WallClockTimestampSource{clock: func() time.Time { return now }}
+
+	assert.Equal(t, uint64(now.UnixNano()), timestampSource.Next(10))
+	assert.Equal(t, uint64(now.UnixNano())+1, timestampSource.Next(uint64(now.UnixNano())))
+}
+
+func TestTheHybridLogicalClockTimestampSourceMovesTheLogicalCounterWithinAMillisecond(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timestampSource := &HybridLogicalClockTimestampSource{clock: func() time.Time { return now }}
+
+	commitTimestamp := timestampSource.Next(0)
+	assert.Equal(t, uint64(now.UnixMilli())<<hybridLogicalClockLogicalBits, commitTimestamp)
+
+	nextCommitTimestamp := timestampSource.Next(commitTimestamp)
+	assert.Equal(t, commitTimestamp+1, nextCommitTimestamp)
+	assert.Equal(t, now, timestampSource.PhysicalTime(nextCommitTimestamp).UTC())
+}
+
+func TestCommitsWithTheWallClockTimestampSource(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewWallClockTimestampSource())
+	defer oracle.Stop()
+
+	before := uint64(time.Now().UnixNano())
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	doneChannel, _ := transaction.Commit(context.Background())
+	<-doneChannel
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	assert.True(t, anotherTransaction.beginTimestamp >= before)
+	anotherTransaction.FinishBeginTimestampForReadWriteTransaction()
+}
@@ -1,75 +1,163 @@
 package txn
 
 import (
+	"context"
 	"serialized-snapshot-isolation/mvcc"
 	"serialized-snapshot-isolation/txn/errors"
+	"sync/atomic"
+	"time"
 )
 
 // ReadonlyTransaction represents a read-only transaction.
 // A ReadonlyTransaction is assigned a beginTimestamp everytime it starts and can only perform a `get` operation.
+// The beginTimestamp of a ReadonlyTransaction is finished exactly once, `beginTimestampFinished` guards against finishing it more than once.
+// A ReadonlyTransaction created by NewReadonlyTransactionAt is `pinned` to a caller supplied timestamp (More on this in NewReadonlyTransactionAt).
 type ReadonlyTransaction struct {
-	beginTimestamp uint64
-	memtable       *mvcc.MemTable
-	oracle         *Oracle
+	beginTimestamp         uint64
+	beginTimestampFinished atomic.Bool
+	pinned                 bool
+	storage                *mvcc.Storage
+	oracle                 *Oracle
 }
 
 // ReadWriteTransaction represents a read-write transaction.
 // A ReadWriteTransaction is assigned a beginTimestamp everytime it starts, and a commitTimestamp every time
 // it is ready to commit and there are not RW conflicts. (More on this in Oracle).
-// A ReadWriteTransaction also tracks the keys that are read in `reads: [][]byte`.
+// A ReadWriteTransaction also tracks the keys that are read in `reads: [][]byte` and the key ranges that are read in
+// `rangeReads: []KeyRange`.
 // This tracking is essential to determine RW conflict.
+// The `isolationLevel` of a ReadWriteTransaction determines whether it is checked for RW or for WW conflicts (More on this in IsolationLevel).
+// The beginTimestamp of a ReadWriteTransaction is finished exactly once, either when the transaction gets a commitTimestamp
+// or when the transaction is done, whichever happens first. `beginTimestampFinished` guards against finishing it more than once.
 type ReadWriteTransaction struct {
-	beginTimestamp uint64
-	batch          *Batch
-	reads          [][]byte
-	memtable       *mvcc.MemTable
-	oracle         *Oracle
+	beginTimestamp         uint64
+	beginTimestampFinished atomic.Bool
+	batch                  *Batch
+	reads                  [][]byte
+	rangeReads             []KeyRange
+	isolationLevel         IsolationLevel
+	storage                *mvcc.Storage
+	oracle                 *Oracle
 }
 
 // NewReadonlyTransaction creates a new instance of ReadonlyTransaction.
-func NewReadonlyTransaction(oracle *Oracle) *ReadonlyTransaction {
+// It waits till all the commits before its beginTimestamp are applied, and returns the error of the context if the context
+// is done before that. (More on this in Oracle).
+func NewReadonlyTransaction(ctx context.Context, oracle *Oracle) (*ReadonlyTransaction, error) {
+	beginTimestamp, err := oracle.beginTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oracle.metrics.readonlyTransactionsStarted.Increment()
 	return &ReadonlyTransaction{
-		beginTimestamp: oracle.beginTimestamp(),
+		beginTimestamp: beginTimestamp,
 		oracle:         oracle,
-		memtable:       oracle.transactionExecutor.memtable,
+		storage:        oracle.transactionExecutor.storage,
+	}, nil
+}
+
+// NewReadonlyTransactionAt creates a new instance of ReadonlyTransaction that is pinned to the timestamp, instead of
+// getting its beginTimestamp from the Oracle. It reads the keys where commitTimestampOf(Key) < timestamp, which is the
+// state of the store right before the commit with the timestamp.
+// It returns errors.TimestampBeyondCommitWatermarkErr if the commits till the timestamp are not applied yet, and
+// errors.TimestampBelowVersionWatermarkErr if the versions visible at the timestamp may have been removed by the VersionCollector.
+func NewReadonlyTransactionAt(oracle *Oracle, timestamp uint64) (*ReadonlyTransaction, error) {
+	if err := oracle.pinTimestamp(timestamp); err != nil {
+		return nil, err
 	}
+	oracle.metrics.readonlyTransactionsStarted.Increment()
+	return &ReadonlyTransaction{
+		beginTimestamp: timestamp,
+		pinned:         true,
+		oracle:         oracle,
+		storage:        oracle.transactionExecutor.storage,
+	}, nil
+}
+
+// NewReadWriteTransaction creates a new instance of ReadWriteTransaction with SerializableSnapshotIsolation.
+// It waits till all the commits before its beginTimestamp are applied, and returns the error of the context if the context
+// is done before that. (More on this in Oracle).
+func NewReadWriteTransaction(ctx context.Context, oracle *Oracle) (*ReadWriteTransaction, error) {
+	return NewReadWriteTransactionWithIsolation(ctx, oracle, SerializableSnapshotIsolation)
 }
 
-// NewReadWriteTransaction creates a new instance of ReadWriteTransaction.
-func NewReadWriteTransaction(oracle *Oracle) *ReadWriteTransaction {
+// NewReadWriteTransactionWithIsolation creates a new instance of ReadWriteTransaction with the IsolationLevel.
+// It behaves like NewReadWriteTransaction otherwise.
+func NewReadWriteTransactionWithIsolation(
+	ctx context.Context,
+	oracle *Oracle,
+	isolationLevel IsolationLevel,
+) (*ReadWriteTransaction, error) {
+	beginTimestamp, err := oracle.beginTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oracle.metrics.readWriteTransactionsStarted.Increment()
 	return &ReadWriteTransaction{
-		beginTimestamp: oracle.beginTimestamp(),
+		beginTimestamp: beginTimestamp,
 		batch:          NewBatch(),
+		isolationLevel: isolationLevel,
 		oracle:         oracle,
-		memtable:       oracle.transactionExecutor.memtable,
-	}
+		storage:        oracle.transactionExecutor.storage,
+	}, nil
 }
 
-// Get performs a get operation from the mvcc.MemTable.
+// Get performs a get operation from the mvcc.Storage.
 // It returns a pair  of (mvcc.Value and true) if the value exists for the key, (nil, false) otherwise.
-func (transaction *ReadonlyTransaction) Get(key []byte) (mvcc.Value, bool) {
+// A key whose visible version is a tombstone is treated as non-existing.
+// It returns the error if the mvcc.Storage fails to read the key (an SSTable block can not be read).
+func (transaction *ReadonlyTransaction) Get(key []byte) (mvcc.Value, bool, error) {
 	versionedKey := mvcc.NewVersionedKey(key, transaction.beginTimestamp)
-	return transaction.memtable.Get(versionedKey)
+	return visibleValue(transaction.storage.Get(versionedKey))
+}
+
+// Versions returns the versions of the key with fromTimestamp <= commitTimestamp <= toTimestamp, in the increasing order of
+// the commitTimestamps, at most limit of them. Only the versions visible to the transaction (commitTimestamp < beginTimestamp)
+// are returned, so the history is consistent with the snapshot of the transaction. Tombstones are returned as they are.
+// The versions removed by the VersionCollector are not a part of the history.
+// It returns the error if the mvcc.Storage fails to read the versions.
+func (transaction *ReadonlyTransaction) Versions(key []byte, fromTimestamp, toTimestamp uint64, limit int) ([]mvcc.KeyVersion, error) {
+	if transaction.beginTimestamp == 0 || limit <= 0 {
+		return nil, nil
+	}
+	if toTimestamp >= transaction.beginTimestamp {
+		toTimestamp = transaction.beginTimestamp - 1
+	}
+	if fromTimestamp > toTimestamp {
+		return nil, nil
+	}
+	return transaction.storage.Versions(key, fromTimestamp, toTimestamp, limit)
+}
+
+// BeginTimestamp returns the beginTimestamp of the ReadonlyTransaction.
+// The transaction reads the keys where commitTimestampOf(Key) < beginTimestamp.
+func (transaction *ReadonlyTransaction) BeginTimestamp() uint64 {
+	return transaction.beginTimestamp
 }
 
 // FinishBeginTimestampForReadonlyTransaction indicates the end of ReadonlyTransaction.
 // It is used to indicate the TransactionTimestampMark inside Oracle that all the transactions upto a given `beginTimestamp`
-// are done. (More on this in Oracle).
+// are done. (More on this in Oracle). It is safe to invoke it more than once, only the first invocation has an effect.
 func (transaction *ReadonlyTransaction) FinishBeginTimestampForReadonlyTransaction() {
 	transaction.oracle.finishBeginTimestampForReadonlyTransaction(transaction)
 }
 
-// Get performs a get operation from the mvcc.MemTable.
+// Get performs a get operation from the mvcc.Storage.
 // It returns a pair  of (mvcc.Value and true) if the value exists for the key, (nil, false) otherwise.
 // Unlike the Get of ReadonlyTransaction, reads are tracked inside the Get of ReadWriteTransaction.
-func (transaction *ReadWriteTransaction) Get(key []byte) (mvcc.Value, bool) {
-	if value, ok := transaction.batch.Get(key); ok {
-		return mvcc.NewValue(value), true
+// A key that is deleted in the same transaction, or whose visible version is a tombstone, is treated as non-existing.
+// It returns the error if the mvcc.Storage fails to read the key (an SSTable block can not be read).
+func (transaction *ReadWriteTransaction) Get(key []byte) (mvcc.Value, bool, error) {
+	if pair, ok := transaction.batch.getPair(key); ok {
+		if pair.isDeleted() {
+			return mvcc.NewDeletedValue(), false, nil
+		}
+		return mvcc.NewValue(pair.getValue()), true, nil
 	}
 	transaction.reads = append(transaction.reads, key)
 
 	versionedKey := mvcc.NewVersionedKey(key, transaction.beginTimestamp)
-	return transaction.memtable.Get(versionedKey)
+	return visibleValue(transaction.storage.Get(versionedKey))
 }
 
 // PutOrUpdate adds the key/value pair to the Batch inside ReadWriteTransaction.
@@ -82,37 +170,102 @@ func (transaction *ReadWriteTransaction) PutOrUpdate(key []byte, value []byte) e
 	return nil
 }
 
+// Delete adds a tombstone for the key to the Batch inside ReadWriteTransaction.
+// When the transaction commits, the tombstone is written to the mvcc.MemTable with the commitTimestamp as its version,
+// so transactions with a beginTimestamp greater than the commitTimestamp do not find the key.
+// Delete takes part in the RW conflict check exactly like PutOrUpdate.
+// It returns an error if an attempt is made to add the duplicate key to the ReadWriteTransaction.
+func (transaction *ReadWriteTransaction) Delete(key []byte) error {
+	err := transaction.batch.Delete(key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // Commit commits the ReadWriteTransaction.
 // Commit involves the following:
-// 1. Acquiring an executorLock to ensure that the transaction are sent to the TransactionExecutor in the order of their commitTimestamp.
+// 1. Acquiring the executorSlot to ensure that the transaction are sent to the TransactionExecutor in the order of their commitTimestamp.
 // 2. Getting the commit timestamp for the transaction. Commit timestamp is only provided if the transaction does not have any RW conflict.
-// 3. Submitting the TimestampedBatch to the TransactionExecutor
+// 3. Submitting the TimestampedBatch to the TransactionExecutor, which does not wait for the previous commits to be applied
 // 4. Passing a commit callback to the TimestampedBatch which is invoked when the entire batch is applied
-// 5. The commit callback informs the `commitTimestampMark` of Oracle that a transaction with `commitTimestamp` is done
-// More details on commitTimestamp are available in Oracle. Commits are executed serially and the details are available in TransactionExecutor.
-func (transaction *ReadWriteTransaction) Commit() (<-chan struct{}, error) {
+// 5. The commit callback informs the `commitTimestampMark` of Oracle that a transaction with `commitTimestamp` is done, and
+// records the commit latency (More on this in Metrics)
+// More details on commitTimestamp are available in Oracle. Commits are executed serially, in groups of the ready commits, and the
+// details are available in TransactionExecutor.
+//
+// If the context is done before the commitTimestamp is assigned, Commit returns the error of the context and the transaction
+// is not committed; like any other failed commit, its beginTimestamp is released by FinishBeginTimestampForReadWriteTransaction.
+// Once the commitTimestamp is assigned, the commit can not be abandoned (the later commits depend on it), so the context is
+// not checked after that. The clients can wait on the returned doneChannel along with their context.
+//
+// The doneChannel receives nil once the commit is applied, or an errors.ExecutorFailedError if the TransactionExecutor
+// failed to write it to the WAL. If the TransactionExecutor has already failed, Commit returns the errors.ExecutorFailedError
+// and the commitTimestamp is finished right away, so that the new transactions do not wait for it.
+func (transaction *ReadWriteTransaction) Commit(ctx context.Context) (<-chan error, error) {
 	if transaction.batch.IsEmpty() {
+		transaction.oracle.metrics.emptyTransactionRejections.Increment()
 		return nil, errors.EmptyTransactionErr
 	}
+	start := time.Now()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// Send the transaction to the executor in the increasing order of the commitTimestamp.
 	// If a commit with the commitTimestamp 102 is applied, it is assumed that the commit with commitTimestamp 101 is already available.
-	transaction.oracle.executorLock.Lock()
-	defer transaction.oracle.executorLock.Unlock()
+	if err := transaction.oracle.acquireExecutorSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer transaction.oracle.releaseExecutorSlot()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	commitTimestamp, err := transaction.oracle.mayBeCommitTimestampFor(transaction)
 	if err != nil {
 		return nil, err
 	}
-	commitCallback := func() {
+	commitCallback := func(err error) {
+		if err != nil {
+			transaction.oracle.metrics.failedCommits.Increment()
+		} else {
+			transaction.oracle.metrics.commits.Increment()
+			transaction.oracle.metrics.commitLatency.Observe(time.Since(start))
+		}
 		transaction.oracle.commitTimestampMark.Finish(commitTimestamp)
 	}
-	return transaction.oracle.transactionExecutor.Submit(transaction.batch.ToTimestampedBatch(commitTimestamp, commitCallback)), nil
+	doneChannel, err := transaction.oracle.transactionExecutor.Submit(transaction.batch.ToTimestampedBatch(commitTimestamp, commitCallback))
+	if err != nil {
+		commitCallback(err)
+		return nil, err
+	}
+	return doneChannel, nil
+}
+
+// IsolationLevel returns the IsolationLevel of the ReadWriteTransaction.
+func (transaction *ReadWriteTransaction) IsolationLevel() IsolationLevel {
+	return transaction.isolationLevel
 }
 
 // FinishBeginTimestampForReadWriteTransaction indicates the end of ReadWriteTransaction.
 // It is used to indicate the TransactionTimestampMark inside Oracle that all the transactions upto a given `beginTimestamp`
-// are done. (More on this in Oracle).
+// are done. (More on this in Oracle). It is safe to invoke it more than once (or after a successful Commit), only the
+// first finish of the beginTimestamp has an effect.
 func (transaction *ReadWriteTransaction) FinishBeginTimestampForReadWriteTransaction() {
 	transaction.oracle.finishBeginTimestampForReadWriteTransaction(transaction)
 }
+
+// visibleValue hides the tombstones from the clients of transactions.
+// It returns (mvcc.Value, true) if the value exists and is not a tombstone, (mvcc.Value, false) otherwise, along with
+// the error of the read.
+func visibleValue(value mvcc.Value, ok bool, err error) (mvcc.Value, bool, error) {
+	if err != nil {
+		return mvcc.Value{}, false, err
+	}
+	if !ok || value.IsDeleted() {
+		return value, false, nil
+	}
+	return value, true, nil
+}
@@ -1,6 +1,23 @@
 package txn
 
-import "serialized-snapshot-isolation/mvcc"
+import (
+	"fmt"
+	"serialized-snapshot-isolation/mvcc"
+	txnErrors "serialized-snapshot-isolation/txn/errors"
+	"serialized-snapshot-isolation/wal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// batchChannelCapacity is the number of TimestampedBatches that can wait for the TransactionExecutor, so that a
+	// ReadWriteTransaction can submit its batch (and release the executorSlot of the Oracle) without waiting for the
+	// previous commits to be applied.
+	batchChannelCapacity = 1024
+	// maxGroupSize is the maximum number of TimestampedBatches that are applied together as a group.
+	maxGroupSize = 256
+)
 
 // TransactionExecutor represents an implementation of [Singular Update Queue](https://martinfowler.com/articles/patterns-of-distributed-systems/singular-update-queue.html).
 // TransactionExecutor applies all the commits sequentially.
@@ -8,19 +25,84 @@ import "serialized-snapshot-isolation/mvcc"
 // It is a single goroutine that reads TimestampedBatch from the `batchChannel`.
 // Anytime a ReadWriteTransaction is ready to commit, its TimestampedBatch is sent to the TransactionExecutor via Submit() method.
 // TransactionExecutor converts all the Keys present in the TimestampedBatch to mvcc.VersionedKey and Value to mvcc.Value and
-// applies all these mvcc.VersionedKey/mvcc.Value pairs to the mvcc.MemTable.
+// applies all these mvcc.VersionedKey/mvcc.Value pairs to the mvcc.Storage. After every group of batches, the mvcc.Storage
+// gets a chance to rotate its active mvcc.MemTable (mvcc.Storage.MayBeRotate), so a commit is never split across MemTables,
+// and to compact it (mvcc.Storage.MayBeCompact), so the memory of the versions removed by the VersionCollector comes back.
+//
+// TransactionExecutor performs group commit: once it receives a TimestampedBatch, it drains every other batch that is already
+// waiting in the `batchChannel` (at most maxGroupSize batches) into a group. The group is appended to the WAL with a single
+// sync, applied to the mvcc.Storage with a single acquisition of its lock, and then the commit callbacks and the doneChannels
+// of all the batches in the group are fired in the order of their commitTimestamps. The batches are submitted in the order
+// of their commitTimestamps (More on this in ReadWriteTransaction.Commit), so a group is always ordered.
+//
+// TransactionExecutor can optionally write every TimestampedBatch to a write-ahead log (wal.WAL) before applying it.
+// With a WAL, a TimestampedBatch is applied (and its commit callback is invoked) only after its record is durable according
+// to the wal.SyncPolicy: right after the append for wal.SyncEveryCommit and wal.SyncNever, and after the next periodic sync
+// for wal.SyncPeriodically. The batches appended between two periodic syncs wait in `awaitingSync`, so a new transaction
+// never reads a commit that a crash could erase.
+//
+// A failure to write to the WAL (append, sync or close) puts the TransactionExecutor in a failed state (`failure`):
+// every batch that is not durable yet is not applied, its commit callback is invoked (the commit never happened, so no new
+// transaction waits for it), and its doneChannel receives a txnErrors.ExecutorFailedError. From then on, Submit rejects
+// all the batches with the same error. The records of the failed batches may still have reached the WAL file, so the WAL is
+// truncated back to `appliedWALSize` (the end of the last record whose batch is applied) before the batches are failed;
+// otherwise a commit that was reported as failed would reappear when the WAL is replayed on the next open. If the
+// truncation fails as well, its error is a part of the failure of the TransactionExecutor.
+//
+// The WAL is split into segments that follow the MemTables of the mvcc.Storage: the WAL is rotated right after the active
+// mvcc.MemTable is rotated, and a segment is removed once all its commits are a part of the flushed SSTables
+// (mvcc.Storage.LastFlushedCommitTimestamp). A failed rotation or removal is retried after the next group; until then the
+// WAL just holds more segments than it needs to.
+//
+// TransactionExecutor can optionally apply a group with `applyWorkers` concurrent workers (NewParallelTransactionExecutor).
+// The group is split into runs of consecutive batches that touch pairwise disjoint keys, and the batches of a run are
+// distributed across the workers; the runs themselves are applied one after the other. Every VersionedKey carries the
+// commitTimestamp of its batch, so the concurrent insertions into the lock-free mvcc.MemTable never collide.
+// The commit callbacks (which finish the commitTimestamps in the Oracle) are still invoked only after the whole group is
+// applied, and in the order of the commitTimestamps, so a reader never sees a later commit without the earlier ones.
 type TransactionExecutor struct {
-	batchChannel chan TimestampedBatch
-	stopChannel  chan struct{}
-	memtable     *mvcc.MemTable
+	batchChannel   chan TimestampedBatch
+	stopChannel    chan struct{}
+	stoppedChannel chan struct{}
+	storage        *mvcc.Storage
+	wal            *wal.WAL
+	applyWorkers   int
+	failure        atomic.Pointer[txnErrors.ExecutorFailedError]
+	stopErr        error
+	rotateWAL      bool
+	appliedWALSize int64
 }
 
-// NewTransactionExecutor creates a new instance of TransactionExecutor. It is called once in the entire application.
+// NewTransactionExecutor creates a new instance of TransactionExecutor that applies the commits to an in-memory mvcc.Storage
+// over the memtable. It is called once in the entire application.
 func NewTransactionExecutor(memtable *mvcc.MemTable) *TransactionExecutor {
+	return NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(memtable), nil)
+}
+
+// NewDurableTransactionExecutor creates a new instance of TransactionExecutor that applies the commits to the storage,
+// and writes every TimestampedBatch to the WAL before applying it. A nil WAL disables the write-ahead logging.
+// The storage is closed when the TransactionExecutor is stopped.
+func NewDurableTransactionExecutor(storage *mvcc.Storage, log *wal.WAL) *TransactionExecutor {
+	return NewParallelTransactionExecutor(storage, log, 1)
+}
+
+// NewParallelTransactionExecutor creates a new instance of TransactionExecutor that behaves like NewDurableTransactionExecutor,
+// but applies the batches of a group that touch disjoint keys with applyWorkers concurrent workers.
+// An applyWorkers of 1 (or less) applies all the batches from the goroutine of the TransactionExecutor.
+func NewParallelTransactionExecutor(storage *mvcc.Storage, log *wal.WAL, applyWorkers int) *TransactionExecutor {
+	if applyWorkers < 1 {
+		applyWorkers = 1
+	}
 	transactionExecutor := &TransactionExecutor{
-		batchChannel: make(chan TimestampedBatch),
-		stopChannel:  make(chan struct{}),
-		memtable:     memtable,
+		batchChannel:   make(chan TimestampedBatch, batchChannelCapacity),
+		stopChannel:    make(chan struct{}),
+		stoppedChannel: make(chan struct{}),
+		storage:        storage,
+		wal:            log,
+		applyWorkers:   applyWorkers,
+	}
+	if log != nil {
+		transactionExecutor.appliedWALSize = log.Size()
 	}
 	go transactionExecutor.spin()
 	return transactionExecutor
@@ -28,49 +110,366 @@ func NewTransactionExecutor(memtable *mvcc.MemTable) *TransactionExecutor {
 
 // Submit submits the TimestampedBatch to TransactionExecutor.
 // Anytime a ReadWriteTransaction is ready to commit, its TimestampedBatch is sent to the TransactionExecutor via Submit() method.
+// Submit blocks only if batchChannelCapacity batches are already waiting for the TransactionExecutor.
 // It also returns a doneChannel that the clients of the Commit() method of the ReadWriteTransaction can wait on to
-// get notified when the transaction is applied.
-func (executor *TransactionExecutor) Submit(batch TimestampedBatch) <-chan struct{} {
+// get notified when the transaction is applied (nil), or has failed (the error).
+// Submit returns a txnErrors.ExecutorFailedError, without submitting the batch, if the TransactionExecutor has failed.
+func (executor *TransactionExecutor) Submit(batch TimestampedBatch) (<-chan error, error) {
+	if err := executor.Err(); err != nil {
+		return nil, err
+	}
 	executor.batchChannel <- batch
-	return batch.doneChannel
+	return batch.doneChannel, nil
+}
+
+// Err returns the txnErrors.ExecutorFailedError if the TransactionExecutor has failed to write to the WAL, nil otherwise.
+func (executor *TransactionExecutor) Err() error {
+	if failure := executor.failure.Load(); failure != nil {
+		return failure
+	}
+	return nil
+}
+
+// SubmittedBatches returns the number of the submitted batches that are waiting for the TransactionExecutor.
+func (executor *TransactionExecutor) SubmittedBatches() int {
+	return len(executor.batchChannel)
 }
 
 // Stop stops the TransactionExecutor.
-func (executor *TransactionExecutor) Stop() {
+// Stop returns after the storage is closed (which flushes its immutable MemTables), and the WAL (if any) is synced and
+// closed. It returns the failure of the TransactionExecutor, if it has failed, else the first error of closing the storage,
+// removing the flushed WAL segments or closing the WAL.
+func (executor *TransactionExecutor) Stop() error {
 	executor.stopChannel <- struct{}{}
+	<-executor.stoppedChannel
+	return executor.stopErr
 }
 
 // spin is invoked as a single goroutine [`go spin()`] and it reads either an event from `stopChannel` or a TimestampedBatch from the `batchChannel`.
-// On receiving a TimestampedBatch, it converts all the Keys present in the TimestampedBatch to mvcc.VersionedKey and Value to mvcc.Value and
-// applies all these mvcc.VersionedKey/mvcc.Value pairs to the mvcc.MemTable.
+// On receiving a TimestampedBatch, it collects a group of all the batches that are ready (see collectGroup), appends the group to
+// the WAL (if any), and applies the group to the mvcc.Storage.
+// With wal.SyncPeriodically, the appended batches wait in `awaitingSync` till the next tick of the sync ticker, and they
+// are applied after the sync.
+// Once the TransactionExecutor has failed, every batch that it receives is failed right away.
+// On stop, the batches that are already submitted are applied, the WAL is synced, all the batches awaiting sync are applied,
+// and the storage and the WAL are closed (see closeAll).
 func (executor *TransactionExecutor) spin() {
+	var syncTicker <-chan time.Time
+	if executor.wal != nil && executor.wal.SyncPolicy().SyncsPeriodically() {
+		ticker := time.NewTicker(executor.wal.SyncPolicy().Interval())
+		defer ticker.Stop()
+		syncTicker = ticker.C
+	}
+
+	defer close(executor.stoppedChannel)
+
+	var awaitingSync []TimestampedBatch
+	execute := func(group []TimestampedBatch) {
+		if executor.Err() != nil {
+			executor.markFailed(group)
+			return
+		}
+		if err := executor.appendToWAL(group); err != nil {
+			executor.fail(err, awaitingSync, group)
+			awaitingSync = awaitingSync[:0]
+			return
+		}
+		if syncTicker != nil {
+			awaitingSync = append(awaitingSync, group...)
+			return
+		}
+		executor.applyAndMarkApplied(group)
+	}
 	for {
 		select {
 		case timestampedBatch := <-executor.batchChannel:
-			executor.apply(timestampedBatch)
-			executor.markApplied(timestampedBatch)
+			execute(executor.collectGroup(timestampedBatch))
+		case <-syncTicker:
+			awaitingSync = executor.syncAndApply(awaitingSync)
 		case <-executor.stopChannel:
+			for group := executor.collectGroup(); len(group) > 0; group = executor.collectGroup() {
+				execute(group)
+			}
+			executor.syncAndApply(awaitingSync)
+			executor.stopErr = executor.closeAll()
 			close(executor.batchChannel)
 			return
 		}
 	}
 }
 
-// apply converts all the Keys present in the TimestampedBatch to mvcc.VersionedKey and Value to mvcc.Value and
-// applies all these mvcc.VersionedKey/mvcc.Value pairs to the mvcc.MemTable.
-// After all the key/value pairs are applied, the commit callback is invoked.
-func (executor *TransactionExecutor) apply(timestampedBatch TimestampedBatch) {
-	for _, keyValuePair := range timestampedBatch.AllPairs() {
-		executor.memtable.PutOrUpdate(
-			mvcc.NewVersionedKey(keyValuePair.getKey(), timestampedBatch.timestamp),
-			mvcc.NewValue(keyValuePair.getValue()),
+// collectGroup returns a group of the incoming batches followed by all the batches that are waiting in the `batchChannel`,
+// at most maxGroupSize of them. It never blocks.
+func (executor *TransactionExecutor) collectGroup(batches ...TimestampedBatch) []TimestampedBatch {
+	group := batches
+	for len(group) < maxGroupSize {
+		select {
+		case timestampedBatch := <-executor.batchChannel:
+			group = append(group, timestampedBatch)
+		default:
+			return group
+		}
+	}
+	return group
+}
+
+// appendToWAL appends all the TimestampedBatches of the group as wal.Records to the WAL, with a single sync.
+func (executor *TransactionExecutor) appendToWAL(group []TimestampedBatch) error {
+	if executor.wal == nil {
+		return nil
+	}
+	records := make([]wal.Record, 0, len(group))
+	for _, timestampedBatch := range group {
+		records = append(records, timestampedBatch.toWALRecord())
+	}
+	if err := executor.wal.AppendAll(records); err != nil {
+		return fmt.Errorf(
+			"failed to append the commits with timestamps %v-%v to the WAL: %w",
+			group[0].timestamp, group[len(group)-1].timestamp, err,
 		)
 	}
-	timestampedBatch.commitCallback()
+	return nil
+}
+
+// syncAndApply syncs the WAL, and applies all the batches that were waiting for the sync. If the sync fails, the
+// TransactionExecutor fails along with all these batches.
+// It returns an empty slice (re-using the incoming slice) to hold the batches waiting for the next sync.
+func (executor *TransactionExecutor) syncAndApply(awaitingSync []TimestampedBatch) []TimestampedBatch {
+	if len(awaitingSync) == 0 {
+		return awaitingSync
+	}
+	if err := executor.syncWAL(); err != nil {
+		executor.fail(err, awaitingSync)
+		return awaitingSync[:0]
+	}
+	executor.applyAndMarkApplied(awaitingSync)
+	return awaitingSync[:0]
 }
 
-// markApplied sends a notification to the doneChannel and closes the channel to indicate that the transaction is applied.
+// syncWAL syncs the WAL.
+func (executor *TransactionExecutor) syncWAL() error {
+	if executor.wal == nil {
+		return nil
+	}
+	if err := executor.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the WAL: %w", err)
+	}
+	return nil
+}
+
+// maintainWAL rotates the WAL if the active mvcc.MemTable was rotated since the last rotation of the WAL, and removes the
+// WAL segments whose commits are all a part of the flushed SSTables. A failure is retried on the next invocation, so the
+// errors are not reported here; closeAll reports the error of the final removal.
+func (executor *TransactionExecutor) maintainWAL() {
+	if executor.wal == nil {
+		return
+	}
+	if executor.rotateWAL && executor.wal.Rotate() == nil {
+		executor.rotateWAL = false
+	}
+	_ = executor.removeFlushedSegments()
+}
+
+// removeFlushedSegments removes the WAL segments with the commits till the last commit timestamp of the flushed SSTables.
+func (executor *TransactionExecutor) removeFlushedSegments() error {
+	if executor.wal == nil {
+		return nil
+	}
+	flushedTill, ok := executor.storage.LastFlushedCommitTimestamp()
+	if !ok {
+		return nil
+	}
+	if err := executor.wal.RemoveSegmentsTill(flushedTill); err != nil {
+		return fmt.Errorf("failed to remove the WAL segments till the commit timestamp %v: %w", flushedTill, err)
+	}
+	return nil
+}
+
+// closeAll closes the storage (which flushes all its immutable memtables), removes the WAL segments that are covered by
+// the flushed SSTables and closes the WAL. It returns the failure of the TransactionExecutor, if it has failed, else the
+// first error.
+// A failure to flush does not lose the commits: they are in the WAL (whose segments are removed only once flushed), and
+// they are replayed on the next open.
+func (executor *TransactionExecutor) closeAll() error {
+	err := executor.closeStorage()
+	if removeErr := executor.removeFlushedSegments(); removeErr != nil && err == nil {
+		err = removeErr
+	}
+	if closeErr := executor.closeWAL(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if failure := executor.Err(); failure != nil {
+		return failure
+	}
+	return err
+}
+
+// closeWAL closes the WAL.
+func (executor *TransactionExecutor) closeWAL() error {
+	if executor.wal == nil {
+		return nil
+	}
+	if err := executor.wal.Close(); err != nil {
+		return fmt.Errorf("failed to close the WAL: %w", err)
+	}
+	return nil
+}
+
+// fail discards the WAL records of the batches that are not applied (see discardUnappliedWALRecords), puts the
+// TransactionExecutor in the failed state with the error (only the first error is kept), and fails all the batches of
+// the groups, which are in the order of their commitTimestamps.
+func (executor *TransactionExecutor) fail(err error, groups ...[]TimestampedBatch) {
+	if discardErr := executor.discardUnappliedWALRecords(); discardErr != nil {
+		err = fmt.Errorf("%w (%v)", err, discardErr)
+	}
+	executor.failure.CompareAndSwap(nil, &txnErrors.ExecutorFailedError{Err: err})
+	for _, group := range groups {
+		executor.markFailed(group)
+	}
+}
+
+// discardUnappliedWALRecords truncates the active WAL segment to the end of the last record whose batch is applied.
+func (executor *TransactionExecutor) discardUnappliedWALRecords() error {
+	if executor.wal == nil {
+		return nil
+	}
+	if err := executor.wal.TruncateTo(executor.appliedWALSize); err != nil {
+		return fmt.Errorf("failed to discard the WAL records of the failed commits: %w", err)
+	}
+	return nil
+}
+
+// closeStorage closes the storage, which flushes all its immutable memtables.
+func (executor *TransactionExecutor) closeStorage() error {
+	if err := executor.storage.Close(); err != nil {
+		return fmt.Errorf("failed to close the storage: %w", err)
+	}
+	return nil
+}
+
+// apply converts all the Keys present in the TimestampedBatches of the group to mvcc.VersionedKey and Value to mvcc.Value and
+// applies all these mvcc.VersionedKey/mvcc.Value pairs to the mvcc.Storage, either in one go or with the apply workers.
+// A deleted key is applied as a tombstone (mvcc.NewDeletedValue()) with the commit timestamp as its version.
+// If the active mvcc.MemTable gets rotated, the WAL is marked to be rotated as well (see maintainWAL); otherwise the active
+// mvcc.MemTable gets compacted if the VersionCollector has removed enough of its versions.
+func (executor *TransactionExecutor) apply(group []TimestampedBatch) {
+	if executor.applyWorkers == 1 {
+		executor.storage.PutOrUpdateAll(versionedKeyValuesOf(group))
+	} else {
+		for _, run := range disjointRuns(group) {
+			executor.applyConcurrently(run)
+		}
+	}
+	if executor.storage.MayBeRotate(group[len(group)-1].timestamp) {
+		executor.rotateWAL = true
+		return
+	}
+	executor.storage.MayBeCompact()
+}
+
+// applyAndMarkApplied applies the group, and then invokes the commit callbacks and marks the batches applied, in the order of
+// the commitTimestamps. The WAL is maintained after the batches are marked applied, so the commits do not wait for it.
+// The records of the group are the last records in the WAL at this point, so the size of the WAL becomes the `appliedWALSize`.
+func (executor *TransactionExecutor) applyAndMarkApplied(group []TimestampedBatch) {
+	executor.apply(group)
+	for _, timestampedBatch := range group {
+		timestampedBatch.commitCallback(nil)
+	}
+	for _, timestampedBatch := range group {
+		executor.markApplied(timestampedBatch)
+	}
+	executor.maintainWAL()
+	if executor.wal != nil {
+		executor.appliedWALSize = executor.wal.Size()
+	}
+}
+
+// applyConcurrently distributes the batches of the run (which touch pairwise disjoint keys) across the apply workers, and
+// returns after all the workers are done.
+func (executor *TransactionExecutor) applyConcurrently(run []TimestampedBatch) {
+	workers := executor.applyWorkers
+	if len(run) < workers {
+		workers = len(run)
+	}
+	if workers == 1 {
+		executor.storage.PutOrUpdateAll(versionedKeyValuesOf(run))
+		return
+	}
+	var workerGroup sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		var batches []TimestampedBatch
+		for index := worker; index < len(run); index = index + workers {
+			batches = append(batches, run[index])
+		}
+		workerGroup.Add(1)
+		go func() {
+			defer workerGroup.Done()
+			executor.storage.PutOrUpdateAll(versionedKeyValuesOf(batches))
+		}()
+	}
+	workerGroup.Wait()
+}
+
+// disjointRuns splits the group into runs of consecutive batches, such that the batches in a run touch pairwise disjoint keys.
+func disjointRuns(group []TimestampedBatch) [][]TimestampedBatch {
+	var runs [][]TimestampedBatch
+	runStart := 0
+	keys := make(map[string]struct{})
+	for index, timestampedBatch := range group {
+		pairs := timestampedBatch.AllPairs()
+		overlaps := false
+		for _, keyValuePair := range pairs {
+			if _, ok := keys[string(keyValuePair.getKey())]; ok {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			runs = append(runs, group[runStart:index])
+			runStart = index
+			keys = make(map[string]struct{})
+		}
+		for _, keyValuePair := range pairs {
+			keys[string(keyValuePair.getKey())] = struct{}{}
+		}
+	}
+	return append(runs, group[runStart:])
+}
+
+// versionedKeyValuesOf converts all the key/value pairs of the batches to mvcc.VersionedKeyValues, with the commit timestamp
+// of the batch as the version.
+func versionedKeyValuesOf(batches []TimestampedBatch) []mvcc.VersionedKeyValue {
+	var pairs []mvcc.VersionedKeyValue
+	for _, timestampedBatch := range batches {
+		for _, keyValuePair := range timestampedBatch.AllPairs() {
+			value := mvcc.NewValue(keyValuePair.getValue())
+			if keyValuePair.isDeleted() {
+				value = mvcc.NewDeletedValue()
+			}
+			pairs = append(pairs, mvcc.NewVersionedKeyValue(
+				mvcc.NewVersionedKey(keyValuePair.getKey(), timestampedBatch.timestamp),
+				value,
+			))
+		}
+	}
+	return pairs
+}
+
+// markApplied sends a nil error to the doneChannel and closes the channel to indicate that the transaction is applied.
 func (executor *TransactionExecutor) markApplied(batch TimestampedBatch) {
-	batch.doneChannel <- struct{}{}
+	batch.doneChannel <- nil
 	close(batch.doneChannel)
 }
+
+// markFailed invokes the commit callbacks of the batches (which are not applied) with the failure of the TransactionExecutor,
+// and then sends the failure to their doneChannels and closes the channels.
+func (executor *TransactionExecutor) markFailed(batches []TimestampedBatch) {
+	err := executor.Err()
+	for _, timestampedBatch := range batches {
+		timestampedBatch.commitCallback(err)
+	}
+	for _, timestampedBatch := range batches {
+		timestampedBatch.doneChannel <- err
+		close(timestampedBatch.doneChannel)
+	}
+}
@@ -0,0 +1,52 @@
+package txn
+
+import (
+	"context"
+	"fmt"
+	"serialized-snapshot-isolation/mvcc"
+	"serialized-snapshot-isolation/wal"
+	"sync/atomic"
+	"testing"
+)
+
+// benchmarkConcurrentCommits runs many concurrent committers, each committing a ReadWriteTransaction with a distinct key
+// (so that there are no conflicts) and waiting for the commit to be applied. It measures the commit throughput.
+func benchmarkConcurrentCommits(b *testing.B, executor *TransactionExecutor) {
+	oracle := NewOracle(executor, NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	var count atomic.Uint64
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+			_ = transaction.PutOrUpdate([]byte(fmt.Sprintf("Key-%d", count.Add(1))), []byte("value"))
+
+			done, err := transaction.Commit(context.Background())
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			<-done
+			transaction.FinishBeginTimestampForReadWriteTransaction()
+		}
+	})
+}
+
+func BenchmarkConcurrentCommitsInMemory(b *testing.B) {
+	benchmarkConcurrentCommits(b, NewTransactionExecutor(mvcc.NewMemTable(16)))
+}
+
+func BenchmarkConcurrentCommitsWithWALSyncEveryCommit(b *testing.B) {
+	log, err := wal.Open(b.TempDir(), wal.SyncEveryCommit())
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkConcurrentCommits(b, NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(mvcc.NewMemTable(16)), log))
+}
+
+func BenchmarkConcurrentCommitsInMemoryWithParallelApplyWorkers(b *testing.B) {
+	benchmarkConcurrentCommits(b, NewParallelTransactionExecutor(mvcc.NewInMemoryStorage(mvcc.NewMemTable(16)), nil, 4))
+}
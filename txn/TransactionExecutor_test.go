@@ -1,9 +1,15 @@
 package txn
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"serialized-snapshot-isolation/mvcc"
+	"serialized-snapshot-isolation/txn/errors"
+	"serialized-snapshot-isolation/wal"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestExecutesABatch(t *testing.T) {
@@ -14,8 +20,8 @@ func TestExecutesABatch(t *testing.T) {
 	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
 	_ = batch.Add([]byte("isolation"), []byte("Snapshot"))
 
-	noCallback := func() {}
-	doneChannel := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
+	noCallback := func(error) {}
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
 	<-doneChannel
 
 	value, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
@@ -34,10 +40,10 @@ func TestExecutesABatchAnInvokesCommitCallback(t *testing.T) {
 	batch := NewBatch()
 	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
 
-	commitCallback := func() {
+	commitCallback := func(error) {
 		memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("commit"), 1), mvcc.NewValue([]byte("applied")))
 	}
-	doneChannel := executor.Submit(batch.ToTimestampedBatch(1, commitCallback))
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, commitCallback))
 	<-doneChannel
 
 	value, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
@@ -57,16 +63,16 @@ func TestExecutes2Batches(t *testing.T) {
 	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
 	_ = batch.Add([]byte("isolation"), []byte("Snapshot"))
 
-	noCallback := func() {}
+	noCallback := func(error) {}
 
-	doneChannel := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
 	<-doneChannel
 
 	anotherBatch := NewBatch()
 	_ = anotherBatch.Add([]byte("HDD"), []byte("Hard disk drive"))
 	_ = anotherBatch.Add([]byte("isolation"), []byte("Serialized Snapshot"))
 
-	doneChannel = executor.Submit(anotherBatch.ToTimestampedBatch(2, noCallback))
+	doneChannel, _ = executor.Submit(anotherBatch.ToTimestampedBatch(2, noCallback))
 	<-doneChannel
 
 	value, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
@@ -94,9 +100,9 @@ func TestExecutesABatchAndStops(t *testing.T) {
 	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
 	_ = batch.Add([]byte("isolation"), []byte("Snapshot"))
 
-	noCallback := func() {}
+	noCallback := func(error) {}
 
-	doneChannel := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
 	<-doneChannel
 
 	executor.Stop()
@@ -109,3 +115,342 @@ func TestExecutesABatchAndStops(t *testing.T) {
 	assert.Equal(t, true, ok)
 	assert.Equal(t, []byte("Snapshot"), value.Slice())
 }
+
+func TestExecutesABatchWithADeletedKey(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	executor := NewTransactionExecutor(memTable)
+
+	noCallback := func(error) {}
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
+	<-doneChannel
+
+	anotherBatch := NewBatch()
+	_ = anotherBatch.Delete([]byte("HDD"))
+	doneChannel, _ = executor.Submit(anotherBatch.ToTimestampedBatch(2, noCallback))
+	<-doneChannel
+
+	value, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, false, value.IsDeleted())
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	value, ok = memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, value.IsDeleted())
+}
+
+func TestExecutesABatchAndWritesItToTheWAL(t *testing.T) {
+	directory := t.TempDir()
+	log, _ := wal.Open(directory, wal.SyncEveryCommit())
+
+	memTable := mvcc.NewMemTable(10)
+	executor := NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(memTable), log)
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	_ = batch.Delete([]byte("SSD"))
+
+	noCallback := func(error) {}
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
+	<-doneChannel
+	executor.Stop()
+
+	var records []wal.Record
+	_ = wal.Replay(directory, func(record wal.Record) error {
+		records = append(records, record)
+		return nil
+	})
+	assert.Equal(t, []wal.Record{{
+		Timestamp: 1,
+		Entries: []wal.Entry{
+			{Key: []byte("HDD"), Value: []byte("Hard disk")},
+			{Key: []byte("SSD"), Deleted: true},
+		},
+	}}, records)
+}
+
+func TestExecutesABatchAndMarksItAppliedAfterThePeriodicSyncOfTheWAL(t *testing.T) {
+	log, _ := wal.Open(t.TempDir(), wal.SyncPeriodically(50*time.Millisecond))
+
+	memTable := mvcc.NewMemTable(10)
+	executor := NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(memTable), log)
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+
+	noCallback := func(error) {}
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, noCallback))
+
+	select {
+	case <-doneChannel:
+		assert.Fail(t, "batch must not be marked applied before the WAL is synced")
+	case <-time.After(10 * time.Millisecond):
+	}
+	<-doneChannel
+
+	value, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	executor.Stop()
+}
+
+func TestDoesNotApplyABatchOrInvokeItsCommitCallbackBeforeThePeriodicSyncOfTheWAL(t *testing.T) {
+	log, _ := wal.Open(t.TempDir(), wal.SyncPeriodically(200*time.Millisecond))
+
+	memTable := mvcc.NewMemTable(10)
+	executor := NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(memTable), log)
+	defer executor.Stop()
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+
+	var committed atomic.Bool
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, func(error) { committed.Store(true) }))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, committed.Load())
+	_, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.False(t, ok)
+
+	assert.Nil(t, <-doneChannel)
+	assert.True(t, committed.Load())
+	_, ok = memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.True(t, ok)
+}
+
+func TestFailsTheBatchesAndRejectsTheNewBatchesIfTheWALCanNotBeAppended(t *testing.T) {
+	log, _ := wal.Open(t.TempDir(), wal.SyncEveryCommit())
+	_ = log.Close()
+
+	memTable := mvcc.NewMemTable(10)
+	executor := NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(memTable), log)
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+
+	var committed atomic.Bool
+	doneChannel, err := executor.Submit(batch.ToTimestampedBatch(1, func(error) { committed.Store(true) }))
+	assert.Nil(t, err)
+
+	err = <-doneChannel
+	assert.ErrorIs(t, err, errors.ExecutorFailedErr)
+	assert.True(t, committed.Load())
+
+	_, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.False(t, ok)
+
+	anotherBatch := NewBatch()
+	_ = anotherBatch.Add([]byte("SSD"), []byte("Solid state drive"))
+	_, err = executor.Submit(anotherBatch.ToTimestampedBatch(2, func(error) {}))
+	assert.ErrorIs(t, err, errors.ExecutorFailedErr)
+
+	assert.ErrorIs(t, executor.Stop(), errors.ExecutorFailedErr)
+}
+
+func TestFailsTheBatchesAwaitingSyncIfTheWALCanNotBeSynced(t *testing.T) {
+	log, _ := wal.Open(t.TempDir(), wal.SyncPeriodically(time.Hour))
+	_ = log.Close()
+
+	memTable := mvcc.NewMemTable(10)
+	executor := NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(memTable), log)
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	timestampedBatch := batch.ToTimestampedBatch(1, func(error) {})
+
+	executor.syncAndApply([]TimestampedBatch{timestampedBatch})
+
+	assert.ErrorIs(t, <-timestampedBatch.doneChannel, errors.ExecutorFailedErr)
+	_, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.False(t, ok)
+	assert.ErrorIs(t, executor.Err(), errors.ExecutorFailedErr)
+	assert.ErrorIs(t, executor.Stop(), errors.ExecutorFailedErr)
+}
+
+func TestDoesNotReplayTheCommitsThatFailedOnAWALSyncAfterARestart(t *testing.T) {
+	directory := t.TempDir()
+	log, _ := wal.Open(directory, wal.SyncPeriodically(time.Hour))
+
+	memTable := mvcc.NewMemTable(10)
+	executor := NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(memTable), log)
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	appliedBatch := batch.ToTimestampedBatch(1, func(error) {})
+	assert.Nil(t, executor.appendToWAL([]TimestampedBatch{appliedBatch}))
+	executor.syncAndApply([]TimestampedBatch{appliedBatch})
+	assert.Nil(t, <-appliedBatch.doneChannel)
+
+	anotherBatch := NewBatch()
+	_ = anotherBatch.Add([]byte("SSD"), []byte("Solid state drive"))
+	failedBatch := anotherBatch.ToTimestampedBatch(2, func(error) {})
+	assert.Nil(t, executor.appendToWAL([]TimestampedBatch{failedBatch}))
+
+	_ = log.Close()
+	executor.syncAndApply([]TimestampedBatch{failedBatch})
+	assert.ErrorIs(t, <-failedBatch.doneChannel, errors.ExecutorFailedErr)
+	assert.ErrorIs(t, executor.Stop(), errors.ExecutorFailedErr)
+
+	var timestamps []uint64
+	err := wal.Replay(directory, func(record wal.Record) error {
+		timestamps = append(timestamps, record.Timestamp)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1}, timestamps)
+}
+
+func TestRemovesTheWALSegmentsOfTheFlushedCommits(t *testing.T) {
+	directory := t.TempDir()
+	storage, _ := mvcc.OpenStorage(directory, 10, 1)
+	log, _ := wal.Open(directory, wal.SyncEveryCommit())
+	executor := NewDurableTransactionExecutor(storage, log)
+
+	for timestamp := uint64(1); timestamp <= 5; timestamp++ {
+		batch := NewBatch()
+		_ = batch.Add([]byte(fmt.Sprintf("Key-%v", timestamp)), []byte(fmt.Sprintf("Value-%v", timestamp)))
+		doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(timestamp, func(error) {}))
+		assert.Nil(t, <-doneChannel)
+	}
+	assert.Nil(t, executor.Stop())
+
+	log, err := wal.Open(directory, wal.SyncEveryCommit())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, log.SegmentCount())
+	assert.Nil(t, log.Close())
+
+	count := 0
+	_ = wal.Replay(directory, func(record wal.Record) error {
+		count++
+		return nil
+	})
+	assert.Equal(t, 0, count)
+}
+
+func TestReturnsTheErrorOfClosingTheStorageOnStop(t *testing.T) {
+	storageDirectory := t.TempDir()
+	storage, _ := mvcc.OpenStorage(storageDirectory, 10, 1)
+	log, _ := wal.Open(t.TempDir(), wal.SyncEveryCommit())
+	executor := NewDurableTransactionExecutor(storage, log)
+	assert.Nil(t, os.RemoveAll(storageDirectory))
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, func(error) {}))
+	assert.Nil(t, <-doneChannel)
+
+	err := executor.Stop()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to close the storage")
+}
+
+func TestExecutesAGroupOfBatchesAndInvokesTheCommitCallbacksInTimestampOrder(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	executor := NewTransactionExecutor(memTable)
+	defer executor.Stop()
+
+	var committedTimestamps []uint64
+	var doneChannels []<-chan error
+	for timestamp := uint64(1); timestamp <= 100; timestamp++ {
+		batch := NewBatch()
+		_ = batch.Add([]byte("HDD"), []byte(fmt.Sprintf("Hard disk %v", timestamp)))
+
+		commitTimestamp := timestamp
+		commitCallback := func(error) {
+			committedTimestamps = append(committedTimestamps, commitTimestamp)
+		}
+		doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(timestamp, commitCallback))
+		doneChannels = append(doneChannels, doneChannel)
+	}
+	for _, doneChannel := range doneChannels {
+		<-doneChannel
+	}
+
+	for index, timestamp := range committedTimestamps {
+		assert.Equal(t, uint64(index+1), timestamp)
+	}
+	assert.Equal(t, 100, len(committedTimestamps))
+
+	value, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 101))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk 100"), value.Slice())
+}
+
+func TestAppliesTheSubmittedBatchesOnStop(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	executor := NewTransactionExecutor(memTable)
+
+	batch := NewBatch()
+	_ = batch.Add([]byte("HDD"), []byte("Hard disk"))
+	doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(1, func(error) {}))
+	executor.Stop()
+	<-doneChannel
+
+	value, ok := memTable.Get(mvcc.NewVersionedKey([]byte("HDD"), 2))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+}
+
+func TestExecutesBatchesWithParallelApplyWorkers(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	executor := NewParallelTransactionExecutor(mvcc.NewInMemoryStorage(memTable), nil, 4)
+	defer executor.Stop()
+
+	var committedTimestamps []uint64
+	var doneChannels []<-chan error
+	for timestamp := uint64(1); timestamp <= 100; timestamp++ {
+		batch := NewBatch()
+		_ = batch.Add([]byte(fmt.Sprintf("Key-%v", timestamp%10)), []byte(fmt.Sprintf("Value-%v", timestamp)))
+
+		commitTimestamp := timestamp
+		commitCallback := func(error) {
+			committedTimestamps = append(committedTimestamps, commitTimestamp)
+		}
+		doneChannel, _ := executor.Submit(batch.ToTimestampedBatch(timestamp, commitCallback))
+		doneChannels = append(doneChannels, doneChannel)
+	}
+	for _, doneChannel := range doneChannels {
+		<-doneChannel
+	}
+
+	assert.Equal(t, 100, len(committedTimestamps))
+	for index, timestamp := range committedTimestamps {
+		assert.Equal(t, uint64(index+1), timestamp)
+	}
+	for timestamp := uint64(1); timestamp <= 100; timestamp++ {
+		value, ok := memTable.Get(mvcc.NewVersionedKey([]byte(fmt.Sprintf("Key-%v", timestamp%10)), timestamp+1))
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte(fmt.Sprintf("Value-%v", timestamp)), value.Slice())
+	}
+}
+
+func TestSplitsAGroupIntoRunsOfBatchesWithDisjointKeys(t *testing.T) {
+	timestampedBatchOf := func(timestamp uint64, keys ...string) TimestampedBatch {
+		batch := NewBatch()
+		for _, key := range keys {
+			_ = batch.Add([]byte(key), []byte("value"))
+		}
+		return batch.ToTimestampedBatch(timestamp, func(error) {})
+	}
+	group := []TimestampedBatch{
+		timestampedBatchOf(1, "HDD", "SSD"),
+		timestampedBatchOf(2, "isolation"),
+		timestampedBatchOf(3, "SSD"),
+		timestampedBatchOf(4, "HDD"),
+		timestampedBatchOf(5, "HDD"),
+	}
+
+	var runTimestamps [][]uint64
+	for _, run := range disjointRuns(group) {
+		var timestamps []uint64
+		for _, timestampedBatch := range run {
+			timestamps = append(timestamps, timestampedBatch.timestamp)
+		}
+		runTimestamps = append(runTimestamps, timestamps)
+	}
+	assert.Equal(t, [][]uint64{{1, 2}, {3, 4}, {5}}, runTimestamps)
+}
@@ -3,7 +3,15 @@ package txn
 import (
 	"container/heap"
 	"context"
+	"serialized-snapshot-isolation/metrics"
+	txnErrors "serialized-snapshot-isolation/txn/errors"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxMarkBatchSize is the maximum number of marks that are processed before doneTill is published.
+	maxMarkBatchSize = 1024
 )
 
 // TransactionTimestampHeap
@@ -22,6 +30,23 @@ func (h *TransactionTimestampHeap) Pop() any {
 	return x
 }
 
+// TransactionTimestampWaiterHeap is a min-heap of the marks that wait for a timestamp (the marks with an outNotification),
+// ordered by their timestamps.
+type TransactionTimestampWaiterHeap []Mark
+
+func (h TransactionTimestampWaiterHeap) Len() int           { return len(h) }
+func (h TransactionTimestampWaiterHeap) Less(i, j int) bool { return h[i].timestamp < h[j].timestamp }
+func (h TransactionTimestampWaiterHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *TransactionTimestampWaiterHeap) Push(x any)        { *h = append(*h, x.(Mark)) }
+func (h *TransactionTimestampWaiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = Mark{}
+	*h = old[0 : n-1]
+	return x
+}
+
 // Mark represents
 type Mark struct {
 	timestamp       uint64
@@ -38,35 +63,50 @@ type Mark struct {
 // This will indicate to the TransactionTimestampMark that transactions up till timestamp = 5 are done.
 // This information can be used for blocking new transactions until transactions upto a given timestamp are done.
 // The idea is from [Badger](https://github.com/dgraph-io/badger).
+//
+// Once the TransactionTimestampMark is stopped (the stopChannel is closed), every method returns txnErrors.MarkStoppedErr,
+// including the WaitForMark calls that are blocked at the time of stopping.
+// maxWait (in nanoseconds) bounds the time a WaitForMark call blocks, 0 means no bound.
+// blockedWaiters is the number of WaitForMark calls that are blocked, and waitDurations is the histogram of the time
+// spent in WaitForMark.
 type TransactionTimestampMark struct {
-	doneTill    atomic.Uint64
-	markChannel chan Mark
-	stopChannel chan struct{}
+	doneTill       atomic.Uint64
+	stopped        atomic.Bool
+	maxWait        atomic.Int64
+	blockedWaiters atomic.Int64
+	waitDurations  *metrics.Histogram
+	markChannel    chan Mark
+	stopChannel    chan struct{}
 }
 
 // NewTransactionTimestampMark creates a new instance of TransactionTimestampMark
 func NewTransactionTimestampMark() *TransactionTimestampMark {
 	transactionMark := &TransactionTimestampMark{
-		markChannel: make(chan Mark),
-		stopChannel: make(chan struct{}),
+		markChannel:   make(chan Mark),
+		stopChannel:   make(chan struct{}),
+		waitDurations: metrics.NewLatencyHistogram(),
 	}
 	go transactionMark.spin()
 	return transactionMark
 }
 
 // Begin sends a mark to the markChannel indicating that a transaction with the given timestamp has started.
-func (transactionTimestampMark *TransactionTimestampMark) Begin(timestamp uint64) {
-	transactionTimestampMark.markChannel <- Mark{timestamp: timestamp, done: false}
+func (transactionTimestampMark *TransactionTimestampMark) Begin(timestamp uint64) error {
+	return transactionTimestampMark.send(Mark{timestamp: timestamp, done: false})
 }
 
 // Finish sends a mark to the markChannel indicating that a transaction with the given timestamp is done.
-func (transactionTimestampMark *TransactionTimestampMark) Finish(timestamp uint64) {
-	transactionTimestampMark.markChannel <- Mark{timestamp: timestamp, done: true}
+func (transactionTimestampMark *TransactionTimestampMark) Finish(timestamp uint64) error {
+	return transactionTimestampMark.send(Mark{timestamp: timestamp, done: true})
 }
 
-// Stop stops the TransactionTimestampMark.
-func (transactionTimestampMark *TransactionTimestampMark) Stop() {
-	transactionTimestampMark.stopChannel <- struct{}{}
+// Stop stops the TransactionTimestampMark. It returns txnErrors.MarkStoppedErr if the TransactionTimestampMark is already stopped.
+func (transactionTimestampMark *TransactionTimestampMark) Stop() error {
+	if !transactionTimestampMark.stopped.CompareAndSwap(false, true) {
+		return txnErrors.MarkStoppedErr
+	}
+	close(transactionTimestampMark.stopChannel)
+	return nil
 }
 
 // DoneTill returns the timestamp till which the processing is done.
@@ -74,26 +114,81 @@ func (transactionTimestampMark *TransactionTimestampMark) DoneTill() uint64 {
 	return transactionTimestampMark.doneTill.Load()
 }
 
+// SetMaxWait bounds the time a WaitForMark call blocks, a maxWait of 0 removes the bound.
+func (transactionTimestampMark *TransactionTimestampMark) SetMaxWait(maxWait time.Duration) {
+	transactionTimestampMark.maxWait.Store(int64(maxWait))
+}
+
+// BlockedWaiters returns the number of WaitForMark calls that are blocked, waiting for their timestamps.
+func (transactionTimestampMark *TransactionTimestampMark) BlockedWaiters() int {
+	return int(transactionTimestampMark.blockedWaiters.Load())
+}
+
+// WaitDurations returns a snapshot of the histogram of the time spent in WaitForMark.
+func (transactionTimestampMark *TransactionTimestampMark) WaitDurations() metrics.HistogramSnapshot {
+	return transactionTimestampMark.waitDurations.Snapshot()
+}
+
 // WaitForMark is used to wait till the transaction timestamp >= timestamp is processed.
 // It does this by sending a mark to the `markChannel` and waiting for a response on the `waitChannel`.
+// WaitForMark returns:
+// - the error of the context, if the context is done before the timestamp is processed,
+// - txnErrors.WaitForMarkTimeoutErr, if the timestamp is not processed within the maxWait (if set),
+// - txnErrors.MarkStoppedErr, if the TransactionTimestampMark is stopped before the timestamp is processed.
 func (transactionTimestampMark *TransactionTimestampMark) WaitForMark(
 	ctx context.Context,
 	timestamp uint64,
 ) error {
+	if transactionTimestampMark.stopped.Load() {
+		return txnErrors.MarkStoppedErr
+	}
+	start := time.Now()
+	defer func() {
+		transactionTimestampMark.waitDurations.Observe(time.Since(start))
+	}()
+
 	if transactionTimestampMark.DoneTill() >= timestamp {
 		return nil
 	}
 	waitChannel := make(chan struct{})
-	transactionTimestampMark.markChannel <- Mark{timestamp: timestamp, outNotification: waitChannel}
+	if err := transactionTimestampMark.send(Mark{timestamp: timestamp, outNotification: waitChannel}); err != nil {
+		return err
+	}
 
+	transactionTimestampMark.blockedWaiters.Add(1)
+	defer transactionTimestampMark.blockedWaiters.Add(-1)
+
+	var timeout <-chan time.Time
+	if maxWait := time.Duration(transactionTimestampMark.maxWait.Load()); maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-timeout:
+		return txnErrors.WaitForMarkTimeoutErr
+	case <-transactionTimestampMark.stopChannel:
+		return txnErrors.MarkStoppedErr
 	case <-waitChannel:
 		return nil
 	}
 }
 
+// send sends the mark to the spin goroutine, or returns txnErrors.MarkStoppedErr if the TransactionTimestampMark is stopped.
+func (transactionTimestampMark *TransactionTimestampMark) send(mark Mark) error {
+	if transactionTimestampMark.stopped.Load() {
+		return txnErrors.MarkStoppedErr
+	}
+	select {
+	case transactionTimestampMark.markChannel <- mark:
+		return nil
+	case <-transactionTimestampMark.stopChannel:
+		return txnErrors.MarkStoppedErr
+	}
+}
+
 // spin is invoked as a single goroutine [`go spin()`].
 // It processes all the marks that are received on the `markChannel`.
 // Any time it receives a mark, it invokes the process function, which determines if the timestamp in the mark is done or not.
@@ -105,13 +200,25 @@ func (transactionTimestampMark *TransactionTimestampMark) WaitForMark(
 // It maintains a binary heap of transaction timestamps and anytime it identifies that a transaction is done,
 // the transaction timestamp is popped off the heap and the doneTill field of TransactionTimestampMark is updated.
 // This ensures that doneTill mark is updated in the following order: 4 followed by 6.
+//
+// The marks are processed in batches: after receiving a mark, spin drains all the marks that are already pending in the
+// `markChannel` (the senders blocked on it, at most maxMarkBatchSize), processes them one by one, and then publishes doneTill and notifies the waiters
+// once for the whole batch. The waiters are kept in a min-heap of their timestamps, so notifying them only looks at the
+// waiters that are done, instead of all the waiters.
 func (transactionTimestampMark *TransactionTimestampMark) spin() {
 	var orderedTransactionTimestamps TransactionTimestampHeap
+	var waiters TransactionTimestampWaiterHeap
 	pendingTransactionRequestsByTimestamp := make(map[uint64]int)
-	notificationChannelsByTimestamp := make(map[uint64][]chan struct{})
 
 	heap.Init(&orderedTransactionTimestamps)
+	heap.Init(&waiters)
+
+	doneTill := transactionTimestampMark.DoneTill()
 	process := func(mark Mark) {
+		if mark.outNotification != nil {
+			heap.Push(&waiters, mark)
+			return
+		}
 		previous, ok := pendingTransactionRequestsByTimestamp[mark.timestamp]
 		if !ok {
 			heap.Push(&orderedTransactionTimestamps, mark.timestamp)
@@ -123,8 +230,6 @@ func (transactionTimestampMark *TransactionTimestampMark) spin() {
 		}
 		pendingTransactionRequestsByTimestamp[mark.timestamp] = previous + pendingTransactionCount
 
-		doneTill := transactionTimestampMark.DoneTill()
-		localDoneTillTimestamp := doneTill
 		for len(orderedTransactionTimestamps) > 0 {
 			minimumTimestamp := orderedTransactionTimestamps[0]
 			if done := pendingTransactionRequestsByTimestamp[minimumTimestamp]; done > 0 {
@@ -133,54 +238,33 @@ func (transactionTimestampMark *TransactionTimestampMark) spin() {
 			heap.Pop(&orderedTransactionTimestamps)
 			delete(pendingTransactionRequestsByTimestamp, minimumTimestamp)
 
-			localDoneTillTimestamp = minimumTimestamp
+			doneTill = minimumTimestamp
 		}
-
-		if localDoneTillTimestamp != doneTill {
-			transactionTimestampMark.doneTill.CompareAndSwap(doneTill, localDoneTillTimestamp)
+	}
+	publish := func() {
+		if doneTill != transactionTimestampMark.DoneTill() {
+			transactionTimestampMark.doneTill.Store(doneTill)
 		}
-		for timestamp, notificationChannels := range notificationChannelsByTimestamp {
-			if timestamp <= localDoneTillTimestamp {
-				for _, channel := range notificationChannels {
-					close(channel)
-				}
-				delete(notificationChannelsByTimestamp, timestamp)
-			}
+		for len(waiters) > 0 && waiters[0].timestamp <= doneTill {
+			close(heap.Pop(&waiters).(Mark).outNotification)
 		}
 	}
 	for {
 		select {
 		case mark := <-transactionTimestampMark.markChannel:
-			if mark.outNotification != nil {
-				doneTill := transactionTimestampMark.doneTill.Load()
-				if doneTill >= mark.timestamp {
-					close(mark.outNotification)
-				} else {
-					channels, ok := notificationChannelsByTimestamp[mark.timestamp]
-					if !ok {
-						notificationChannelsByTimestamp[mark.timestamp] = []chan struct{}{mark.outNotification}
-					} else {
-						notificationChannelsByTimestamp[mark.timestamp] = append(channels, mark.outNotification)
-					}
+			process(mark)
+		drain:
+			for count := 1; count < maxMarkBatchSize; count++ {
+				select {
+				case mark := <-transactionTimestampMark.markChannel:
+					process(mark)
+				default:
+					break drain
 				}
-			} else {
-				process(mark)
 			}
+			publish()
 		case <-transactionTimestampMark.stopChannel:
-			close(transactionTimestampMark.markChannel)
-			close(transactionTimestampMark.stopChannel)
-			closeAll(notificationChannelsByTimestamp)
 			return
 		}
 	}
 }
-
-// closeAll closes all the channels that are waiting on various timestamps.
-func closeAll(notificationChannelsByTimestamp map[uint64][]chan struct{}) {
-	for timestamp, notificationChannels := range notificationChannelsByTimestamp {
-		for _, channel := range notificationChannels {
-			close(channel)
-		}
-		delete(notificationChannelsByTimestamp, timestamp)
-	}
-}
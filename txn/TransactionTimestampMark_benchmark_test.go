@@ -0,0 +1,183 @@
+package txn
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"serialized-snapshot-isolation/mvcc"
+	"sync/atomic"
+	"testing"
+)
+
+// timestampMark is implemented by TransactionTimestampMark and by the unbatchedTimestampMark baseline.
+type timestampMark interface {
+	Begin(timestamp uint64) error
+	Finish(timestamp uint64) error
+	WaitForMark(ctx context.Context, timestamp uint64) error
+	Stop() error
+}
+
+// unbatchedTimestampMark is the baseline for the benchmarks: it publishes doneTill after every mark, and goes through all
+// the waiters (kept in a map by their timestamps) after every mark.
+type unbatchedTimestampMark struct {
+	doneTill    atomic.Uint64
+	markChannel chan Mark
+	stopChannel chan struct{}
+}
+
+func newUnbatchedTimestampMark() *unbatchedTimestampMark {
+	transactionMark := &unbatchedTimestampMark{
+		markChannel: make(chan Mark),
+		stopChannel: make(chan struct{}),
+	}
+	go transactionMark.spin()
+	return transactionMark
+}
+
+func (transactionMark *unbatchedTimestampMark) Begin(timestamp uint64) error {
+	transactionMark.markChannel <- Mark{timestamp: timestamp, done: false}
+	return nil
+}
+
+func (transactionMark *unbatchedTimestampMark) Finish(timestamp uint64) error {
+	transactionMark.markChannel <- Mark{timestamp: timestamp, done: true}
+	return nil
+}
+
+func (transactionMark *unbatchedTimestampMark) Stop() error {
+	transactionMark.stopChannel <- struct{}{}
+	return nil
+}
+
+func (transactionMark *unbatchedTimestampMark) WaitForMark(ctx context.Context, timestamp uint64) error {
+	if transactionMark.doneTill.Load() >= timestamp {
+		return nil
+	}
+	waitChannel := make(chan struct{})
+	transactionMark.markChannel <- Mark{timestamp: timestamp, outNotification: waitChannel}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-waitChannel:
+		return nil
+	}
+}
+
+func (transactionMark *unbatchedTimestampMark) spin() {
+	var orderedTransactionTimestamps TransactionTimestampHeap
+	pendingTransactionRequestsByTimestamp := make(map[uint64]int)
+	notificationChannelsByTimestamp := make(map[uint64][]chan struct{})
+
+	process := func(mark Mark) {
+		previous, ok := pendingTransactionRequestsByTimestamp[mark.timestamp]
+		if !ok {
+			heap.Push(&orderedTransactionTimestamps, mark.timestamp)
+		}
+		pendingTransactionCount := 1
+		if mark.done {
+			pendingTransactionCount = -1
+		}
+		pendingTransactionRequestsByTimestamp[mark.timestamp] = previous + pendingTransactionCount
+
+		doneTill := transactionMark.doneTill.Load()
+		localDoneTillTimestamp := doneTill
+		for len(orderedTransactionTimestamps) > 0 {
+			minimumTimestamp := orderedTransactionTimestamps[0]
+			if done := pendingTransactionRequestsByTimestamp[minimumTimestamp]; done > 0 {
+				break
+			}
+			heap.Pop(&orderedTransactionTimestamps)
+			delete(pendingTransactionRequestsByTimestamp, minimumTimestamp)
+			localDoneTillTimestamp = minimumTimestamp
+		}
+		if localDoneTillTimestamp != doneTill {
+			transactionMark.doneTill.CompareAndSwap(doneTill, localDoneTillTimestamp)
+		}
+		for timestamp, notificationChannels := range notificationChannelsByTimestamp {
+			if timestamp <= localDoneTillTimestamp {
+				for _, channel := range notificationChannels {
+					close(channel)
+				}
+				delete(notificationChannelsByTimestamp, timestamp)
+			}
+		}
+	}
+	for {
+		select {
+		case mark := <-transactionMark.markChannel:
+			if mark.outNotification == nil {
+				process(mark)
+			} else if transactionMark.doneTill.Load() >= mark.timestamp {
+				close(mark.outNotification)
+			} else {
+				notificationChannelsByTimestamp[mark.timestamp] = append(
+					notificationChannelsByTimestamp[mark.timestamp],
+					mark.outNotification,
+				)
+			}
+		case <-transactionMark.stopChannel:
+			for _, notificationChannels := range notificationChannelsByTimestamp {
+				for _, channel := range notificationChannels {
+					close(channel)
+				}
+			}
+			return
+		}
+	}
+}
+
+// benchmarkBeginFinishAndWait runs many concurrent goroutines, each beginning a new timestamp, waiting till the previous
+// timestamp is done and finishing its timestamp (like a commit that waits for the previous commits). The timestamps are done
+// one after the other, so most of the goroutines are waiting at any point in time.
+func benchmarkBeginFinishAndWait(b *testing.B, mark timestampMark, parallelism int) {
+	defer mark.Stop()
+
+	var timestamp atomic.Uint64
+	b.SetParallelism(parallelism)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			nextTimestamp := timestamp.Add(1)
+			mark.Begin(nextTimestamp)
+			_ = mark.WaitForMark(context.Background(), nextTimestamp-1)
+			mark.Finish(nextTimestamp)
+		}
+	})
+}
+
+func BenchmarkBeginFinishAndWait(b *testing.B) {
+	for _, parallelism := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("Unbatched/Parallelism-%d", parallelism), func(b *testing.B) {
+			benchmarkBeginFinishAndWait(b, newUnbatchedTimestampMark(), parallelism)
+		})
+		b.Run(fmt.Sprintf("Batched/Parallelism-%d", parallelism), func(b *testing.B) {
+			benchmarkBeginFinishAndWait(b, NewTransactionTimestampMark(), parallelism)
+		})
+	}
+}
+
+// BenchmarkOracleBeginAndCommit measures the rate of begins and commits through the Oracle, which go through both the
+// beginTimestampMark and the commitTimestampMark. The commits are not applied.
+func BenchmarkOracleBeginAndCommit(b *testing.B) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(16)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	var count atomic.Uint64
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+			_ = transaction.PutOrUpdate([]byte(fmt.Sprintf("Key-%d", count.Add(1))), []byte("value"))
+
+			commitTimestamp, err := oracle.mayBeCommitTimestampFor(transaction)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			oracle.commitTimestampMark.Finish(commitTimestamp)
+		}
+	})
+}
@@ -3,7 +3,9 @@ package txn
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"serialized-snapshot-isolation/txn/errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -126,3 +128,89 @@ func TestTransactionMarkAndTimeoutWaitingForAnUnfinishedTimestamp(t *testing.T)
 	assert.Error(t, err)
 	cancelFunction()
 }
+
+func TestTransactionTimestampMarkNotifiesOnlyTheWaitersThatAreDone(t *testing.T) {
+	transactionTimestampMark := NewTransactionTimestampMark()
+	defer transactionTimestampMark.Stop()
+
+	for timestamp := uint64(1); timestamp <= 10; timestamp++ {
+		transactionTimestampMark.Begin(timestamp)
+	}
+
+	var notified [11]atomic.Bool
+	var wg sync.WaitGroup
+	for timestamp := uint64(10); timestamp >= 1; timestamp-- {
+		wg.Add(1)
+		go func(timestamp uint64) {
+			defer wg.Done()
+			_ = transactionTimestampMark.WaitForMark(context.Background(), timestamp)
+			notified[timestamp].Store(true)
+		}(timestamp)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	for timestamp := uint64(1); timestamp <= 5; timestamp++ {
+		transactionTimestampMark.Finish(timestamp)
+	}
+	assert.Eventually(t, func() bool {
+		for timestamp := 1; timestamp <= 5; timestamp++ {
+			if !notified[timestamp].Load() {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 5*time.Millisecond)
+	for timestamp := 6; timestamp <= 10; timestamp++ {
+		assert.Equal(t, false, notified[timestamp].Load())
+	}
+
+	for timestamp := uint64(6); timestamp <= 10; timestamp++ {
+		transactionTimestampMark.Finish(timestamp)
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(10), transactionTimestampMark.DoneTill())
+}
+
+func TestTransactionTimestampMarkReturnsAnErrorAfterStop(t *testing.T) {
+	transactionTimestampMark := NewTransactionTimestampMark()
+	assert.Nil(t, transactionTimestampMark.Begin(1))
+	assert.Nil(t, transactionTimestampMark.Stop())
+
+	assert.ErrorIs(t, transactionTimestampMark.Begin(2), errors.MarkStoppedErr)
+	assert.ErrorIs(t, transactionTimestampMark.Finish(1), errors.MarkStoppedErr)
+	assert.ErrorIs(t, transactionTimestampMark.WaitForMark(context.Background(), 1), errors.MarkStoppedErr)
+	assert.ErrorIs(t, transactionTimestampMark.Stop(), errors.MarkStoppedErr)
+}
+
+func TestTransactionTimestampMarkReleasesTheBlockedWaitersOnStop(t *testing.T) {
+	transactionTimestampMark := NewTransactionTimestampMark()
+	transactionTimestampMark.Begin(1)
+
+	errorChannel := make(chan error, 2)
+	for count := 0; count < 2; count++ {
+		go func() {
+			errorChannel <- transactionTimestampMark.WaitForMark(context.Background(), 1)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return transactionTimestampMark.BlockedWaiters() == 2
+	}, time.Second, 5*time.Millisecond)
+
+	transactionTimestampMark.Stop()
+
+	assert.ErrorIs(t, <-errorChannel, errors.MarkStoppedErr)
+	assert.ErrorIs(t, <-errorChannel, errors.MarkStoppedErr)
+	assert.Equal(t, 0, transactionTimestampMark.BlockedWaiters())
+}
+
+func TestTransactionTimestampMarkTimesOutWaitingBeyondTheMaxWait(t *testing.T) {
+	transactionTimestampMark := NewTransactionTimestampMark()
+	defer transactionTimestampMark.Stop()
+
+	transactionTimestampMark.SetMaxWait(15 * time.Millisecond)
+	transactionTimestampMark.Begin(1)
+
+	err := transactionTimestampMark.WaitForMark(context.Background(), 1)
+	assert.ErrorIs(t, err, errors.WaitForMarkTimeoutErr)
+	assert.Equal(t, 0, transactionTimestampMark.BlockedWaiters())
+}
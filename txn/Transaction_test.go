@@ -1,17 +1,20 @@
 package txn
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"serialized-snapshot-isolation/mvcc"
 	"serialized-snapshot-isolation/txn/errors"
+	"serialized-snapshot-isolation/wal"
 	"testing"
+	"time"
 )
 
 func TestGetsANonExistingKeyInAReadonlyTransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 
-	transaction := NewReadonlyTransaction(NewOracle(NewTransactionExecutor(memTable)))
-	_, ok := transaction.Get([]byte("non-existing"))
+	transaction, _ := NewReadonlyTransaction(context.Background(), NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource()))
+	_, ok, _ := transaction.Get([]byte("non-existing"))
 
 	assert.Equal(t, false, ok)
 }
@@ -20,13 +23,13 @@ func TestGetsAnExistingKeyInAReadonlyTransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
 
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 	oracle.nextTimestamp = 3
 
 	oracle.commitTimestampMark.Finish(2)
 
-	transaction := NewReadonlyTransaction(oracle)
-	value, ok := transaction.Get([]byte("HDD"))
+	transaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+	value, ok, _ := transaction.Get([]byte("HDD"))
 
 	assert.Equal(t, true, ok)
 	assert.Equal(t, []byte("Hard disk"), value.Slice())
@@ -35,12 +38,12 @@ func TestGetsAnExistingKeyInAReadonlyTransaction(t *testing.T) {
 func TestCommitsAnEmptyReadWriteTransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 	oracle.commitTimestampMark.Finish(2)
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 
-	_, err := transaction.Commit()
+	_, err := transaction.Commit(context.Background())
 
 	assert.Error(t, err)
 	assert.Equal(t, errors.EmptyTransactionErr, err)
@@ -49,10 +52,10 @@ func TestCommitsAnEmptyReadWriteTransaction(t *testing.T) {
 func TestAttemptsToPutDuplicateKeysInATransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 	oracle.commitTimestampMark.Finish(2)
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 
 	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 	err := transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk drive"))
@@ -63,53 +66,53 @@ func TestAttemptsToPutDuplicateKeysInATransaction(t *testing.T) {
 
 func TestGetsAnExistingKeyInAReadWriteTransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
-	oracle := NewOracle(NewTransactionExecutor(memTable))
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
 
-	transaction := NewReadWriteTransaction(oracle)
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
-	done, _ := transaction.Commit()
+	done, _ := transaction.Commit(context.Background())
 	<-done
 
-	anotherTransaction := NewReadWriteTransaction(oracle)
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
 	_ = anotherTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state disk"))
-	done, _ = transaction.Commit()
+	done, _ = transaction.Commit(context.Background())
 	<-done
 
-	readonlyTransaction := NewReadonlyTransaction(oracle)
+	readonlyTransaction, _ := NewReadonlyTransaction(context.Background(), oracle)
 
-	value, ok := readonlyTransaction.Get([]byte("HDD"))
+	value, ok, _ := readonlyTransaction.Get([]byte("HDD"))
 	assert.Equal(t, true, ok)
 	assert.Equal(t, []byte("Hard disk"), value.Slice())
 
-	_, ok = readonlyTransaction.Get([]byte("SSD"))
+	_, ok, _ = readonlyTransaction.Get([]byte("SSD"))
 	assert.Equal(t, false, ok)
 
-	_, ok = readonlyTransaction.Get([]byte("non-existing"))
+	_, ok, _ = readonlyTransaction.Get([]byte("non-existing"))
 	assert.Equal(t, false, ok)
 }
 
 func TestGetsTheValueFromAKeyInAReadWriteTransactionFromBatch(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 
-	transaction := NewReadWriteTransaction(NewOracle(NewTransactionExecutor(memTable)))
+	transaction, _ := NewReadWriteTransaction(context.Background(), NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource()))
 	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 
-	value, ok := transaction.Get([]byte("HDD"))
+	value, ok, _ := transaction.Get([]byte("HDD"))
 	assert.Equal(t, true, ok)
 	assert.Equal(t, []byte("Hard disk"), value.Slice())
 
-	done, _ := transaction.Commit()
+	done, _ := transaction.Commit(context.Background())
 	<-done
 }
 
 func TestTracksReadsInAReadWriteTransaction(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 
-	transaction := NewReadWriteTransaction(NewOracle(NewTransactionExecutor(memTable)))
+	transaction, _ := NewReadWriteTransaction(context.Background(), NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource()))
 	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 	transaction.Get([]byte("SSD"))
 
-	done, _ := transaction.Commit()
+	done, _ := transaction.Commit(context.Background())
 	<-done
 
 	assert.Equal(t, 1, len(transaction.reads))
@@ -121,12 +124,329 @@ func TestTracksReadsInAReadWriteTransaction(t *testing.T) {
 func TestDoesNotTrackReadsInAReadWriteTransactionIfKeysAreReadFromTheBatch(t *testing.T) {
 	memTable := mvcc.NewMemTable(10)
 
-	transaction := NewReadWriteTransaction(NewOracle(NewTransactionExecutor(memTable)))
+	transaction, _ := NewReadWriteTransaction(context.Background(), NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource()))
 	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
 	transaction.Get([]byte("HDD"))
 
-	done, _ := transaction.Commit()
+	done, _ := transaction.Commit(context.Background())
 	<-done
 
 	assert.Equal(t, 0, len(transaction.reads))
 }
+
+func TestGetsADeletedKeyInAReadonlyTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 2), mvcc.NewDeletedValue())
+
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 4
+
+	oracle.commitTimestampMark.Finish(3)
+
+	transaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+	_, ok, _ := transaction.Get([]byte("HDD"))
+
+	assert.Equal(t, false, ok)
+}
+
+func TestGetsAKeyDeletedInTheSameReadWriteTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	memTable.PutOrUpdate(mvcc.NewVersionedKey([]byte("HDD"), 1), mvcc.NewValue([]byte("Hard disk")))
+
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	oracle.nextTimestamp = 3
+
+	oracle.commitTimestampMark.Finish(2)
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.Delete([]byte("HDD"))
+
+	_, ok, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 0, len(transaction.reads))
+}
+
+func TestDeletesAKeyInAReadWriteTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	done, _ := transaction.Commit(context.Background())
+	<-done
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.Delete([]byte("HDD"))
+	done, _ = anotherTransaction.Commit(context.Background())
+	<-done
+
+	thirdTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = thirdTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state disk"))
+	done, _ = thirdTransaction.Commit(context.Background())
+	<-done
+
+	readonlyTransaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+
+	_, ok, _ := readonlyTransaction.Get([]byte("HDD"))
+	assert.Equal(t, false, ok)
+}
+
+func TestGetsTheValuesOfAKeyAtHistoricalTimestampsInAReadonlyTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+	commitUpdateOf(t, oracle, "HDD", "Hard disk drive")
+	commitUpdateOf(t, oracle, "SSD", "Solid state drive")
+
+	awaitCommitWatermark(t, oracle, 3)
+
+	transaction, err := NewReadonlyTransactionAt(oracle, 1)
+	assert.Nil(t, err)
+	_, ok, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, false, ok)
+	transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	transaction, err = NewReadonlyTransactionAt(oracle, 2)
+	assert.Nil(t, err)
+	value, ok, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+	transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	transaction, err = NewReadonlyTransactionAt(oracle, 3)
+	assert.Nil(t, err)
+	value, ok, _ = transaction.Get([]byte("HDD"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk drive"), value.Slice())
+	assert.Equal(t, uint64(3), transaction.BeginTimestamp())
+	transaction.FinishBeginTimestampForReadonlyTransaction()
+}
+
+func TestAttemptsToCreateAReadonlyTransactionAtATimestampBeyondTheCommitWatermark(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+
+	_, err := NewReadonlyTransactionAt(oracle, 2)
+	assert.ErrorIs(t, err, errors.TimestampBeyondCommitWatermarkErr)
+}
+
+func TestAttemptsToCreateAReadonlyTransactionAtATimestampBelowTheVersionWatermark(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	collector := NewVersionCollector(oracle, 0)
+	defer collector.Stop()
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+	commitUpdateOf(t, oracle, "HDD", "Hard disk drive")
+	commitUpdateOf(t, oracle, "HDD", "HDD")
+	commitUpdateOf(t, oracle, "HDD", "Hard drive")
+
+	assert.Eventually(t, func() bool {
+		collector.Collect()
+		return collector.Collected().Versions == 1
+	}, 5*time.Second, time.Millisecond)
+
+	_, err := NewReadonlyTransactionAt(oracle, 1)
+	assert.ErrorIs(t, err, errors.TimestampBelowVersionWatermarkErr)
+}
+
+func TestAPinnedTimestampHoldsBackTheVersionCollection(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	collector := NewVersionCollector(oracle, 0)
+	defer collector.Stop()
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+	commitUpdateOf(t, oracle, "HDD", "Hard disk drive")
+	awaitCommitWatermark(t, oracle, 2)
+
+	transaction, err := NewReadonlyTransactionAt(oracle, 2)
+	assert.Nil(t, err)
+
+	commitUpdateOf(t, oracle, "HDD", "HDD")
+	commitUpdateOf(t, oracle, "HDD", "Hard drive")
+
+	collector.Collect()
+	assert.Equal(t, uint64(0), collector.Collected().Versions)
+
+	value, ok, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+
+	transaction.FinishBeginTimestampForReadonlyTransaction()
+	assert.Eventually(t, func() bool {
+		collector.Collect()
+		return collector.Collected().Versions == 1
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestAttemptsToCreateATransactionWithACancelledContext(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewReadonlyTransaction(ctx, oracle)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = NewReadWriteTransaction(ctx, oracle)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAttemptsToCreateATransactionWhileTheCommitsAreNotAppliedBeforeTheDeadline(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	oracle.nextTimestamp = 2
+	oracle.commitTimestampMark.Begin(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := NewReadonlyTransaction(ctx, oracle)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	oracle.beginTimestampMark.Begin(2)
+	oracle.beginTimestampMark.Finish(2)
+	assert.Eventually(t, func() bool {
+		return oracle.beginTimestampMark.DoneTill() == 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestAttemptsToCommitAReadWriteTransactionWithACancelledContext(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := transaction.Commit(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, uint64(1), oracle.nextTimestamp)
+	assert.Equal(t, 0, oracle.CommittedTransactionLength())
+
+	transaction.FinishBeginTimestampForReadWriteTransaction()
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state"))
+	done, err := anotherTransaction.Commit(context.Background())
+	assert.Nil(t, err)
+	<-done
+}
+
+func TestAttemptsToCommitAReadWriteTransactionWhileTheExecutorSlotIsHeldBeyondTheDeadline(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+
+	_ = oracle.acquireExecutorSlot(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := transaction.Commit(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, uint64(1), oracle.nextTimestamp)
+
+	oracle.releaseExecutorSlot()
+	done, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	<-done
+}
+
+func awaitCommitWatermark(t *testing.T, oracle *Oracle, timestamp uint64) {
+	assert.Eventually(t, func() bool {
+		return oracle.commitTimestampMark.DoneTill() >= timestamp
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestAttemptsToCreateATransactionWhileTheCommitsAreNotAppliedWithinTheMaxWait(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	oracle.SetMaxWaitForCommits(20 * time.Millisecond)
+	oracle.nextTimestamp = 2
+	oracle.commitTimestampMark.Begin(1)
+
+	blockedTransactionChannel := make(chan error)
+	go func() {
+		_, err := NewReadWriteTransaction(context.Background(), oracle)
+		blockedTransactionChannel <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return oracle.BlockedTransactions() == 1
+	}, time.Second, time.Millisecond)
+
+	assert.ErrorIs(t, <-blockedTransactionChannel, errors.WaitForMarkTimeoutErr)
+	assert.Equal(t, 0, oracle.BlockedTransactions())
+}
+
+func TestAttemptsToCreateATransactionAfterTheOracleIsStopped(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	oracle.Stop()
+
+	_, err := NewReadonlyTransaction(context.Background(), oracle)
+	assert.ErrorIs(t, err, errors.MarkStoppedErr)
+
+	_, err = NewReadWriteTransaction(context.Background(), oracle)
+	assert.ErrorIs(t, err, errors.MarkStoppedErr)
+}
+
+func TestCommitsFailAfterTheTransactionExecutorFailsWhileTheReadsContinue(t *testing.T) {
+	log, _ := wal.Open(t.TempDir(), wal.SyncEveryCommit())
+	_ = log.Close()
+
+	oracle := NewOracle(NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(mvcc.NewMemTable(10)), log), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.ErrorIs(t, <-doneChannel, errors.ExecutorFailedErr)
+
+	anotherTransaction, err := NewReadWriteTransaction(context.Background(), oracle)
+	assert.Nil(t, err)
+	_, ok, _ := anotherTransaction.Get([]byte("HDD"))
+	assert.False(t, ok)
+
+	_ = anotherTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	_, err = anotherTransaction.Commit(context.Background())
+	assert.ErrorIs(t, err, errors.ExecutorFailedErr)
+
+	readonlyTransaction, err := NewReadonlyTransaction(context.Background(), oracle)
+	assert.Nil(t, err)
+	readonlyTransaction.FinishBeginTimestampForReadonlyTransaction()
+}
+
+func TestCountsTheFailedCommitsWithoutObservingTheirLatency(t *testing.T) {
+	log, _ := wal.Open(t.TempDir(), wal.SyncEveryCommit())
+	_ = log.Close()
+
+	oracle := NewOracle(NewDurableTransactionExecutor(mvcc.NewInMemoryStorage(mvcc.NewMemTable(10)), log), NewCounterTimestampSource())
+	defer oracle.Stop()
+
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = transaction.PutOrUpdate([]byte("HDD"), []byte("Hard disk"))
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	assert.ErrorIs(t, <-doneChannel, errors.ExecutorFailedErr)
+
+	anotherTransaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	_ = anotherTransaction.PutOrUpdate([]byte("SSD"), []byte("Solid state drive"))
+	_, err = anotherTransaction.Commit(context.Background())
+	assert.ErrorIs(t, err, errors.ExecutorFailedErr)
+
+	metrics := oracle.Metrics()
+	assert.Equal(t, uint64(0), metrics.Commits)
+	assert.Equal(t, uint64(2), metrics.FailedCommits)
+	assert.Equal(t, uint64(0), metrics.CommitLatency.Count)
+}
@@ -0,0 +1,85 @@
+package txn
+
+import (
+	"serialized-snapshot-isolation/mvcc"
+	"sync"
+	"time"
+)
+
+// VersionCollector removes the obsolete versions of the keys from the mvcc.Storage.
+// Every ReadWriteTransaction writes a new version of the keys it modifies, so a key that is updated a million times holds a
+// million versions. A transaction reads the latest version of a key that is less than its beginTimestamp, and
+// beginTimestampMark of the Oracle knows the watermark (DoneTill) below which no beginTimestamp is running or will be
+// assigned. A transaction can still begin at the watermark itself (beginTimestamp = nextTimestamp - 1 is shared by
+// the transactions), so for every key, the newest version that is less than the watermark must be kept, and all the
+// versions older than it can be removed.
+//
+// VersionCollector runs a collection periodically in a goroutine, if it is created with a non-zero interval.
+// A collection can also be run on demand using Collect.
+type VersionCollector struct {
+	oracle         *Oracle
+	lock           sync.Mutex
+	collected      mvcc.CollectedVersions
+	stopChannel    chan struct{}
+	stoppedChannel chan struct{}
+}
+
+// NewVersionCollector creates a new instance of VersionCollector that collects the obsolete versions every interval.
+// An interval of 0 disables the periodic collection.
+func NewVersionCollector(oracle *Oracle, interval time.Duration) *VersionCollector {
+	collector := &VersionCollector{
+		oracle:         oracle,
+		stopChannel:    make(chan struct{}),
+		stoppedChannel: make(chan struct{}),
+	}
+	if interval > 0 {
+		go collector.spin(interval)
+	} else {
+		close(collector.stoppedChannel)
+	}
+	return collector
+}
+
+// Collect removes the obsolete versions below the current watermark, and returns the CollectedVersions of this collection.
+func (collector *VersionCollector) Collect() mvcc.CollectedVersions {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	collectedVersions := collector.oracle.transactionExecutor.storage.CollectVersionsBelow(collector.oracle.versionWatermark())
+	collector.collected = collector.collected.Add(collectedVersions)
+	return collectedVersions
+}
+
+// Collected returns the total CollectedVersions of all the collections so far.
+func (collector *VersionCollector) Collected() mvcc.CollectedVersions {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	return collector.collected
+}
+
+// Stop stops the periodic collection, and returns after the running collection (if any) is done.
+func (collector *VersionCollector) Stop() {
+	select {
+	case <-collector.stoppedChannel:
+	default:
+		close(collector.stopChannel)
+		<-collector.stoppedChannel
+	}
+}
+
+// spin is invoked as a single goroutine [`go spin()`] and it runs a collection on every tick of the ticker.
+func (collector *VersionCollector) spin(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(collector.stoppedChannel)
+
+	for {
+		select {
+		case <-ticker.C:
+			collector.Collect()
+		case <-collector.stopChannel:
+			return
+		}
+	}
+}
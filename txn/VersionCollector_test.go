@@ -0,0 +1,112 @@
+package txn
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"serialized-snapshot-isolation/mvcc"
+	"testing"
+	"time"
+)
+
+func commitUpdateOf(t *testing.T, oracle *Oracle, key, value string) {
+	transaction, _ := NewReadWriteTransaction(context.Background(), oracle)
+	assert.Nil(t, transaction.PutOrUpdate([]byte(key), []byte(value)))
+	doneChannel, err := transaction.Commit(context.Background())
+	assert.Nil(t, err)
+	<-doneChannel
+}
+
+func TestCollectsTheObsoleteVersions(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	collector := NewVersionCollector(oracle, 0)
+	defer collector.Stop()
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+	commitUpdateOf(t, oracle, "HDD", "Hard disk drive")
+	commitUpdateOf(t, oracle, "HDD", "HDD")
+	commitUpdateOf(t, oracle, "HDD", "Hard drive")
+
+	assert.Eventually(t, func() bool {
+		collector.Collect()
+		return collector.Collected().Versions == 1
+	}, 5*time.Second, time.Millisecond)
+
+	transaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	value, ok, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("HDD"), value.Slice())
+}
+
+func TestDoesNotCollectTheVersionsVisibleToAnActiveTransaction(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	collector := NewVersionCollector(oracle, 0)
+	defer collector.Stop()
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+	commitUpdateOf(t, oracle, "SSD", "Solid state drive")
+
+	transaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk drive")
+	commitUpdateOf(t, oracle, "HDD", "HDD")
+	commitUpdateOf(t, oracle, "HDD", "Hard drive")
+
+	collector.Collect()
+	assert.Equal(t, uint64(0), collector.Collected().Versions)
+
+	value, ok, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte("Hard disk"), value.Slice())
+}
+
+func TestCollectsTheObsoleteVersionsPeriodically(t *testing.T) {
+	memTable := mvcc.NewMemTable(10)
+	oracle := NewOracle(NewTransactionExecutor(memTable), NewCounterTimestampSource())
+	collector := NewVersionCollector(oracle, time.Millisecond)
+	defer collector.Stop()
+
+	commitUpdateOf(t, oracle, "HDD", "Hard disk")
+	commitUpdateOf(t, oracle, "HDD", "Hard disk drive")
+	commitUpdateOf(t, oracle, "HDD", "HDD")
+	commitUpdateOf(t, oracle, "HDD", "Hard drive")
+
+	assert.Eventually(t, func() bool {
+		return collector.Collected().Versions == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Greater(t, collector.Collected().UnlinkedBytes, uint64(0))
+}
+
+func TestReclaimsTheMemoryOfTheCollectedVersionsWithTheNextCommit(t *testing.T) {
+	oracle := NewOracle(NewTransactionExecutor(mvcc.NewMemTable(10)), NewCounterTimestampSource())
+	defer oracle.Stop()
+	collector := NewVersionCollector(oracle, 0)
+	defer collector.Stop()
+
+	value := string(make([]byte, 8192))
+	for count := 0; count < 300; count++ {
+		commitUpdateOf(t, oracle, "HDD", value)
+	}
+	storage := oracle.transactionExecutor.storage
+	sizeBeforeCollection := storage.MemTableSize()
+
+	assert.Eventually(t, func() bool {
+		collector.Collect()
+		return collector.Collected().Versions == 297
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, sizeBeforeCollection, storage.MemTableSize())
+
+	commitUpdateOf(t, oracle, "SSD", "Solid state drive")
+	assert.Less(t, storage.MemTableSize(), sizeBeforeCollection/2)
+
+	transaction, _ := NewReadonlyTransaction(context.Background(), oracle)
+	defer transaction.FinishBeginTimestampForReadonlyTransaction()
+
+	hddValue, ok, _ := transaction.Get([]byte("HDD"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []byte(value), hddValue.Slice())
+}
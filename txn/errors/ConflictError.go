@@ -0,0 +1,42 @@
+package errors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictingKey is a key of the aborted transaction that was written by a transaction that committed after it began,
+// along with the commitTimestamp of that transaction. If more than one such transaction wrote the key, CommitTimestamp
+// is the commitTimestamp of the latest of them.
+type ConflictingKey struct {
+	Key             []byte
+	CommitTimestamp uint64
+}
+
+// ConflictError is returned when a ReadWriteTransaction can not commit because it conflicts with the transactions that
+// committed after it began. It carries the details of the conflict:
+// Keys are the keys of the aborted transaction (the keys it read, either as point reads or within the ranges it read, or
+// the keys it wrote, depending on its isolation level), each with the commitTimestamp of the committed transaction that
+// wrote it, and BeginTimestamp is the beginTimestamp of the aborted transaction.
+// ConflictError unwraps to ConflictErr, so errors.Is(err, ConflictErr) holds.
+type ConflictError struct {
+	Keys           []ConflictingKey
+	BeginTimestamp uint64
+}
+
+// Error returns the error message.
+func (err *ConflictError) Error() string {
+	keys := make([]string, 0, len(err.Keys))
+	for _, key := range err.Keys {
+		keys = append(keys, fmt.Sprintf("%q written by the transaction with commitTimestamp %d", key.Key, key.CommitTimestamp))
+	}
+	return fmt.Sprintf(
+		"%v (keys [%v], after the beginTimestamp %d)",
+		ConflictErr, strings.Join(keys, ", "), err.BeginTimestamp,
+	)
+}
+
+// Unwrap returns ConflictErr.
+func (err *ConflictError) Unwrap() error {
+	return ConflictErr
+}
@@ -0,0 +1,29 @@
+package errors
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConflictErrorIsAConflictErr(t *testing.T) {
+	err := error(&ConflictError{Keys: []ConflictingKey{{Key: []byte("HDD"), CommitTimestamp: 5}}, BeginTimestamp: 3})
+
+	assert.True(t, errors.Is(err, ConflictErr))
+	assert.Contains(t, err.Error(), `"HDD"`)
+	assert.Contains(t, err.Error(), "commitTimestamp 5")
+	assert.Contains(t, err.Error(), "beginTimestamp 3")
+}
+
+func TestConflictErrorReportsTheCommitTimestampOfEveryKey(t *testing.T) {
+	err := error(&ConflictError{
+		Keys: []ConflictingKey{
+			{Key: []byte("HDD"), CommitTimestamp: 5},
+			{Key: []byte("SSD"), CommitTimestamp: 7},
+		},
+		BeginTimestamp: 3,
+	})
+
+	assert.Contains(t, err.Error(), `"HDD" written by the transaction with commitTimestamp 5`)
+	assert.Contains(t, err.Error(), `"SSD" written by the transaction with commitTimestamp 7`)
+}
@@ -5,3 +5,8 @@ import "errors"
 var ConflictErr = errors.New("transaction conflicts with other concurrent transaction, retry")
 var EmptyTransactionErr = errors.New("transaction is empty, invoke PutOrUpdate in a transaction before committing")
 var DuplicateKeyInBatchErr = errors.New("batch already contains the key")
+var TimestampBeyondCommitWatermarkErr = errors.New("timestamp is beyond the commit watermark, the commits till the timestamp are not applied yet")
+var TimestampBelowVersionWatermarkErr = errors.New("timestamp is below the version collection watermark, the versions visible at the timestamp may be collected")
+var MarkStoppedErr = errors.New("transaction timestamp mark is stopped, can not perform the operation")
+var WaitForMarkTimeoutErr = errors.New("timed out waiting for the transaction timestamp mark")
+var ExecutorFailedErr = errors.New("transaction executor failed to write the commits to the WAL, can not commit")
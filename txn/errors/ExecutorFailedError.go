@@ -0,0 +1,25 @@
+package errors
+
+import "fmt"
+
+// ExecutorFailedError is returned when the TransactionExecutor could not write the commits to the WAL (for example, the
+// disk is full). Err is the error of the WAL. Once it fails, the TransactionExecutor rejects all the new commits.
+// ExecutorFailedError unwraps to Err, and errors.Is(err, ExecutorFailedErr) holds.
+type ExecutorFailedError struct {
+	Err error
+}
+
+// Error returns the error message.
+func (err *ExecutorFailedError) Error() string {
+	return fmt.Sprintf("%v: %v", ExecutorFailedErr, err.Err)
+}
+
+// Unwrap returns the error of the WAL.
+func (err *ExecutorFailedError) Unwrap() error {
+	return err.Err
+}
+
+// Is returns true if the target is ExecutorFailedErr.
+func (err *ExecutorFailedError) Is(target error) bool {
+	return target == ExecutorFailedErr
+}
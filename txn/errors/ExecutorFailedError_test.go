@@ -0,0 +1,16 @@
+package errors
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExecutorFailedErrorIsAnExecutorFailedErrAndUnwrapsToTheCause(t *testing.T) {
+	cause := errors.New("no space left on device")
+	err := error(&ExecutorFailedError{Err: cause})
+
+	assert.True(t, errors.Is(err, ExecutorFailedErr))
+	assert.True(t, errors.Is(err, cause))
+	assert.Contains(t, err.Error(), "no space left on device")
+}
@@ -0,0 +1,124 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var CorruptRecordErr = errors.New("wal record is corrupt, checksum mismatch")
+
+// headerSize is the size of the header of every record: length (4 bytes) followed by the CRC checksum (4 bytes).
+const headerSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Entry represents a key/value pair that is a part of a Record.
+// An Entry with Deleted set to true represents the deletion of the key, and it does not carry any value.
+type Entry struct {
+	Key     []byte
+	Value   []byte
+	Deleted bool
+}
+
+// Record represents all the key/value pairs of a committed transaction along with its commit timestamp.
+// A Record is encoded as:
+// | length (uint32) | crc32 of the payload (uint32) | payload |
+// where the payload is:
+// | timestamp (uint64) | number of entries (uint32) | entry ... |
+// and every entry is:
+// | deleted (1 byte) | key length (uint32) | key | value length (uint32) | value |
+// All the integers are encoded in little-endian. The length prefix and the checksum allow the detection of torn
+// (partially written) and corrupt records.
+type Record struct {
+	Timestamp uint64
+	Entries   []Entry
+}
+
+// encode encodes the Record along with its header.
+func (record Record) encode() []byte {
+	payloadSize := 8 + 4
+	for _, entry := range record.Entries {
+		payloadSize = payloadSize + 1 + 4 + len(entry.Key) + 4 + len(entry.Value)
+	}
+
+	buffer := make([]byte, headerSize+payloadSize)
+	payload := buffer[headerSize:]
+
+	offset := 0
+	binary.LittleEndian.PutUint64(payload[offset:], record.Timestamp)
+	offset = offset + 8
+	binary.LittleEndian.PutUint32(payload[offset:], uint32(len(record.Entries)))
+	offset = offset + 4
+
+	for _, entry := range record.Entries {
+		if entry.Deleted {
+			payload[offset] = 1
+		}
+		offset = offset + 1
+		offset = offset + putBytes(payload[offset:], entry.Key)
+		offset = offset + putBytes(payload[offset:], entry.Value)
+	}
+
+	binary.LittleEndian.PutUint32(buffer[0:], uint32(payloadSize))
+	binary.LittleEndian.PutUint32(buffer[4:], crc32.Checksum(payload, crcTable))
+	return buffer
+}
+
+// decodeRecord decodes the payload (without the header) into a Record.
+func decodeRecord(payload []byte) (Record, error) {
+	if len(payload) < 12 {
+		return Record{}, CorruptRecordErr
+	}
+	record := Record{Timestamp: binary.LittleEndian.Uint64(payload[0:])}
+	entryCount := binary.LittleEndian.Uint32(payload[8:])
+	offset := 12
+
+	for count := uint32(0); count < entryCount; count++ {
+		if offset >= len(payload) {
+			return Record{}, CorruptRecordErr
+		}
+		entry := Entry{Deleted: payload[offset] == 1}
+		offset = offset + 1
+
+		key, size, ok := getBytes(payload[offset:])
+		if !ok {
+			return Record{}, CorruptRecordErr
+		}
+		offset = offset + size
+
+		value, size, ok := getBytes(payload[offset:])
+		if !ok {
+			return Record{}, CorruptRecordErr
+		}
+		offset = offset + size
+
+		entry.Key, entry.Value = key, value
+		record.Entries = append(record.Entries, entry)
+	}
+	return record, nil
+}
+
+// putBytes writes the length of the source followed by the source in the destination and returns the number of bytes written.
+func putBytes(destination []byte, source []byte) int {
+	binary.LittleEndian.PutUint32(destination, uint32(len(source)))
+	copy(destination[4:], source)
+	return 4 + len(source)
+}
+
+// getBytes reads a length prefixed byte slice from the source and returns it along with the number of bytes read.
+func getBytes(source []byte) ([]byte, int, bool) {
+	if len(source) < 4 {
+		return nil, 0, false
+	}
+	length := int(binary.LittleEndian.Uint32(source))
+	if len(source) < 4+length {
+		return nil, 0, false
+	}
+	if length == 0 {
+		return nil, 4, true
+	}
+	target := make([]byte, length)
+	copy(target, source[4:4+length])
+	return target, 4 + length, true
+}
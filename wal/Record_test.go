@@ -0,0 +1,33 @@
+package wal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEncodesAndDecodesARecord(t *testing.T) {
+	record := Record{
+		Timestamp: 5,
+		Entries: []Entry{
+			{Key: []byte("HDD"), Value: []byte("Hard disk")},
+			{Key: []byte("SSD"), Deleted: true},
+		},
+	}
+	encoded := record.encode()
+
+	decoded, err := decodeRecord(encoded[headerSize:])
+	assert.Nil(t, err)
+	assert.Equal(t, record, decoded)
+}
+
+func TestDecodesATruncatedRecord(t *testing.T) {
+	record := Record{
+		Timestamp: 5,
+		Entries:   []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}},
+	}
+	encoded := record.encode()
+
+	_, err := decodeRecord(encoded[headerSize : len(encoded)-2])
+	assert.Error(t, err)
+	assert.Equal(t, CorruptRecordErr, err)
+}
@@ -0,0 +1,51 @@
+package wal
+
+import "time"
+
+type syncKind uint8
+
+const (
+	syncEveryCommit syncKind = iota
+	syncPeriodically
+	syncNever
+)
+
+// SyncPolicy determines when the WAL is synced (fsync) to the disk.
+// - SyncEveryCommit syncs the WAL after every record; a commit is durable as soon as its record is appended.
+// - SyncPeriodically syncs the WAL every interval; a commit is durable at the next sync after its record is appended.
+// - SyncNever never syncs the WAL explicitly; the records are handed over to the operating system and it is left to the
+// operating system to write them to the disk.
+type SyncPolicy struct {
+	kind     syncKind
+	interval time.Duration
+}
+
+// SyncEveryCommit returns the SyncPolicy that syncs the WAL after every record.
+func SyncEveryCommit() SyncPolicy {
+	return SyncPolicy{kind: syncEveryCommit}
+}
+
+// SyncPeriodically returns the SyncPolicy that syncs the WAL every interval.
+func SyncPeriodically(interval time.Duration) SyncPolicy {
+	return SyncPolicy{kind: syncPeriodically, interval: interval}
+}
+
+// SyncNever returns the SyncPolicy that never syncs the WAL explicitly.
+func SyncNever() SyncPolicy {
+	return SyncPolicy{kind: syncNever}
+}
+
+// SyncsEveryCommit returns true if the WAL needs to be synced after every record.
+func (policy SyncPolicy) SyncsEveryCommit() bool {
+	return policy.kind == syncEveryCommit
+}
+
+// SyncsPeriodically returns true if the WAL needs to be synced periodically.
+func (policy SyncPolicy) SyncsPeriodically() bool {
+	return policy.kind == syncPeriodically
+}
+
+// Interval returns the interval for SyncPeriodically, 0 for other policies.
+func (policy SyncPolicy) Interval() time.Duration {
+	return policy.interval
+}
@@ -0,0 +1,394 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentFilePrefix    = "wal-"
+	segmentFileExtension = ".log"
+)
+
+// segment describes a segment file of the WAL: its sequence number (which orders the segments), and the timestamp of
+// its last record. A segment without any record has `empty` set to true.
+type segment struct {
+	sequence      uint64
+	lastTimestamp uint64
+	empty         bool
+}
+
+// WAL represents a write-ahead log.
+// Every committed transaction is appended to the WAL as a Record (before it is applied to the mvcc.MemTable) by
+// txn.TransactionExecutor. WAL is not safe for concurrent use; txn.TransactionExecutor is its only user and it is a
+// single goroutine.
+//
+// A WAL is a sequence of segment files (wal-<sequence>.log) in its directory. The records are appended to the last
+// (active) segment, and Rotate closes the active segment and starts a new one. Once all the records of a closed segment
+// are a part of the flushed SSTables, the segment is not needed anymore and RemoveSegmentsTill deletes it. This keeps
+// the WAL (and the time to replay it) bounded by the commits that are not flushed yet.
+// When a WAL is opened, all the segments are scanned and any torn (partially written) record at the tail of the active
+// segment is truncated, so that the new records are appended right after the last valid record. A closed segment is
+// synced before the next segment is created, so a torn record in a closed segment is treated as corruption.
+//
+// `size` is the size of the active segment, including the records that are still buffered in the `writer`. If an append
+// or a sync fails part-way, some of the records may have reached the segment file anyway, and TruncateTo discards them.
+type WAL struct {
+	directory  string
+	segments   []segment
+	active     segment
+	file       *os.File
+	writer     *bufio.Writer
+	size       int64
+	syncPolicy SyncPolicy
+}
+
+// Open opens (or creates) the WAL in the directory with the given SyncPolicy.
+func Open(directory string, syncPolicy SyncPolicy) (*WAL, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+	segments, err := scanSegments(directory, func(record Record) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		file, err := createSegment(directory, 1)
+		if err != nil {
+			return nil, err
+		}
+		return newWAL(directory, nil, segment{sequence: 1, empty: true}, file, 0, syncPolicy), nil
+	}
+
+	active := segments[len(segments)-1]
+	file, err := os.OpenFile(filepath.Join(directory, segmentFileNameFor(active.sequence)), os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	validSize, err := scan(file, func(record Record) error { return nil })
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(validSize); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return newWAL(directory, segments[:len(segments)-1], active, file, validSize, syncPolicy), nil
+}
+
+// newWAL creates a new instance of WAL with the closed segments, and the active segment of the size that is open in the file.
+func newWAL(directory string, segments []segment, active segment, file *os.File, size int64, syncPolicy SyncPolicy) *WAL {
+	return &WAL{
+		directory:  directory,
+		segments:   segments,
+		active:     active,
+		file:       file,
+		writer:     bufio.NewWriter(file),
+		size:       size,
+		syncPolicy: syncPolicy,
+	}
+}
+
+// Append appends the Record to the WAL and hands it over to the operating system.
+// Append syncs the WAL if the SyncPolicy is SyncEveryCommit. For the other policies, the record is durable only after
+// the next Sync.
+func (wal *WAL) Append(record Record) error {
+	return wal.AppendAll([]Record{record})
+}
+
+// AppendAll appends all the Records to the WAL (in the given order) and hands them over to the operating system.
+// AppendAll syncs the WAL once, after all the records are written, if the SyncPolicy is SyncEveryCommit. This allows a
+// group of commits to share a single sync.
+func (wal *WAL) AppendAll(records []Record) error {
+	for _, record := range records {
+		written, err := wal.writer.Write(record.encode())
+		wal.size = wal.size + int64(written)
+		if err != nil {
+			return err
+		}
+		wal.active.lastTimestamp, wal.active.empty = record.Timestamp, false
+	}
+	if err := wal.writer.Flush(); err != nil {
+		return err
+	}
+	if wal.syncPolicy.SyncsEveryCommit() {
+		return wal.file.Sync()
+	}
+	return nil
+}
+
+// Sync flushes the buffered records and syncs the active segment of the WAL to the disk.
+func (wal *WAL) Sync() error {
+	if err := wal.writer.Flush(); err != nil {
+		return err
+	}
+	return wal.file.Sync()
+}
+
+// Rotate syncs and closes the active segment, and starts a new segment for the next records. It does nothing if the
+// active segment does not have any record.
+// If the new segment can not be created, the records continue to go to the current segment and Rotate can be retried.
+func (wal *WAL) Rotate() error {
+	if wal.active.empty {
+		return nil
+	}
+	if err := wal.Sync(); err != nil {
+		return err
+	}
+	next := segment{sequence: wal.active.sequence + 1, empty: true}
+	file, err := createSegment(wal.directory, next.sequence)
+	if err != nil {
+		return err
+	}
+	if err := syncDirectory(wal.directory); err != nil {
+		_ = file.Close()
+		_ = os.Remove(filepath.Join(wal.directory, segmentFileNameFor(next.sequence)))
+		return err
+	}
+
+	closed := wal.file
+	wal.segments = append(wal.segments, wal.active)
+	wal.active, wal.file, wal.writer, wal.size = next, file, bufio.NewWriter(file), 0
+	return closed.Close()
+}
+
+// Size returns the size of the active segment, including the appended records that are not handed over to the operating
+// system yet. It drops to 0 when the WAL is rotated.
+func (wal *WAL) Size() int64 {
+	return wal.size
+}
+
+// TruncateTo discards all the records of the active segment after the size, which is a Size of the WAL taken before these
+// records were appended. It is meant for an append or a sync that fails part-way: the records of the failed commits may
+// have reached the segment file anyway, and they must not be replayed on the next open.
+// The active segment is reopened (the file of a failed write may not be usable anymore), truncated and synced; the
+// buffered records are dropped. The last timestamp of the active segment is not rolled back, which only delays the
+// removal of the segment (see RemoveSegmentsTill).
+func (wal *WAL) TruncateTo(size int64) error {
+	_ = wal.file.Close()
+	wal.writer.Reset(wal.file)
+
+	file, err := os.OpenFile(filepath.Join(wal.directory, segmentFileNameFor(wal.active.sequence)), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(size); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		_ = file.Close()
+		return err
+	}
+	wal.file, wal.writer, wal.size = file, bufio.NewWriter(file), size
+	wal.active.empty = size == 0
+	return nil
+}
+
+// RemoveSegmentsTill deletes the closed segments (oldest first) whose last record has a timestamp less than or equal to
+// the timestamp. The active segment is never deleted.
+// It is invoked with the last commit timestamp of the flushed SSTables, the commits of such segments are never replayed.
+// A segment that can not be deleted (along with all the newer segments) is kept, and it is deleted by the next invocation.
+func (wal *WAL) RemoveSegmentsTill(timestamp uint64) error {
+	for len(wal.segments) > 0 && (wal.segments[0].empty || wal.segments[0].lastTimestamp <= timestamp) {
+		err := os.Remove(filepath.Join(wal.directory, segmentFileNameFor(wal.segments[0].sequence)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		wal.segments = wal.segments[1:]
+	}
+	return nil
+}
+
+// SegmentCount returns the number of the segments of the WAL, including the active segment.
+func (wal *WAL) SegmentCount() int {
+	return len(wal.segments) + 1
+}
+
+// SyncPolicy returns the SyncPolicy of the WAL.
+func (wal *WAL) SyncPolicy() SyncPolicy {
+	return wal.syncPolicy
+}
+
+// Close syncs and closes the WAL.
+func (wal *WAL) Close() error {
+	if err := wal.Sync(); err != nil {
+		_ = wal.file.Close()
+		return err
+	}
+	return wal.file.Close()
+}
+
+// Replay reads all the valid records from the segments of the WAL in the directory, in the order they were appended,
+// and invokes the callback for each of them. A torn record at the tail of the last segment is ignored. Replay does
+// nothing if there is no WAL in the directory.
+func Replay(directory string, callback func(record Record) error) error {
+	_, err := scanSegments(directory, callback)
+	return err
+}
+
+// scanSegments reads the records of all the segments in the directory (in the order of their sequence numbers), and
+// invokes the callback for each valid record. It returns the segments along with the timestamps of their last records.
+// A torn record is ignored only at the tail of the last segment, it returns CorruptRecordErr for any other segment.
+func scanSegments(directory string, callback func(record Record) error) ([]segment, error) {
+	sequences, err := segmentSequencesIn(directory)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]segment, 0, len(sequences))
+	for index, sequence := range sequences {
+		scanned := segment{sequence: sequence, empty: true}
+		err := scanSegment(directory, scanned.sequence, index == len(sequences)-1, func(record Record) error {
+			scanned.lastTimestamp, scanned.empty = record.Timestamp, false
+			return callback(record)
+		})
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, scanned)
+	}
+	return segments, nil
+}
+
+// scanSegment reads the records of the segment with the sequence and invokes the callback for each valid record.
+// A torn record at the tail is ignored only if the segment is the last one.
+func scanSegment(directory string, sequence uint64, last bool, callback func(record Record) error) error {
+	file, err := os.Open(filepath.Join(directory, segmentFileNameFor(sequence)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	validSize, err := scan(file, callback)
+	if err != nil {
+		return err
+	}
+	if last {
+		return nil
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if validSize != info.Size() {
+		return CorruptRecordErr
+	}
+	return nil
+}
+
+// segmentSequencesIn returns the sequence numbers of all the segments in the directory, in the increasing order.
+// It returns no sequence if the directory does not exist.
+func segmentSequencesIn(directory string) ([]uint64, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sequences []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentFilePrefix) || !strings.HasSuffix(name, segmentFileExtension) {
+			continue
+		}
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentFilePrefix), segmentFileExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		sequences = append(sequences, sequence)
+	}
+	sort.Slice(sequences, func(i, j int) bool { return sequences[i] < sequences[j] })
+	return sequences, nil
+}
+
+// createSegment creates the segment file with the sequence, and opens it for appending the records.
+func createSegment(directory string, sequence uint64) (*os.File, error) {
+	return os.OpenFile(filepath.Join(directory, segmentFileNameFor(sequence)), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+}
+
+// segmentFileNameFor returns the name of the segment file for the sequence.
+func segmentFileNameFor(sequence uint64) string {
+	return fmt.Sprintf("%s%020d%s", segmentFilePrefix, sequence, segmentFileExtension)
+}
+
+// syncDirectory syncs the directory, so that the creation of a segment file is durable.
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dir.Close()
+	}()
+	return dir.Sync()
+}
+
+// scan reads the records from the beginning of the file and invokes the callback for each valid record.
+// It returns the size of the file till the end of the last valid record.
+// A record that is truncated, or a record with a checksum mismatch that is the last record in the file, is treated as a torn
+// write and the scan stops there. A checksum mismatch in any other record returns CorruptRecordErr.
+func scan(file *os.File, callback func(record Record) error) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	fileSize := info.Size()
+	reader := bufio.NewReader(file)
+
+	var validSize int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return validSize, nil
+		}
+		length := int64(binary.LittleEndian.Uint32(header[0:]))
+		checksum := binary.LittleEndian.Uint32(header[4:])
+		recordEnd := validSize + headerSize + length
+		if recordEnd > fileSize {
+			return validSize, nil
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return validSize, nil
+		}
+		if crc32.Checksum(payload, crcTable) != checksum {
+			if recordEnd == fileSize {
+				return validSize, nil
+			}
+			return validSize, CorruptRecordErr
+		}
+		record, err := decodeRecord(payload)
+		if err != nil {
+			return validSize, err
+		}
+		if err := callback(record); err != nil {
+			return validSize, err
+		}
+		validSize = recordEnd
+	}
+}
@@ -0,0 +1,225 @@
+package wal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendsAndReplaysRecords(t *testing.T) {
+	directory := t.TempDir()
+	wal, err := Open(directory, SyncEveryCommit())
+	assert.Nil(t, err)
+
+	_ = wal.Append(Record{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}})
+	_ = wal.Append(Record{Timestamp: 2, Entries: []Entry{{Key: []byte("HDD"), Deleted: true}}})
+	assert.Nil(t, wal.Close())
+
+	var records []Record
+	err = Replay(directory, func(record Record) error {
+		records = append(records, record)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []Record{
+		{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}},
+		{Timestamp: 2, Entries: []Entry{{Key: []byte("HDD"), Deleted: true}}},
+	}, records)
+}
+
+func TestAppendsAllAndReplaysRecords(t *testing.T) {
+	directory := t.TempDir()
+	wal, err := Open(directory, SyncEveryCommit())
+	assert.Nil(t, err)
+
+	err = wal.AppendAll([]Record{
+		{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}},
+		{Timestamp: 2, Entries: []Entry{{Key: []byte("SSD"), Value: []byte("Solid state")}}},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, wal.Close())
+
+	var timestamps []uint64
+	err = Replay(directory, func(record Record) error {
+		timestamps = append(timestamps, record.Timestamp)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, timestamps)
+}
+
+func TestReplaysANonExistingWAL(t *testing.T) {
+	count := 0
+	err := Replay(t.TempDir(), func(record Record) error {
+		count++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestIgnoresATornRecordAtTheTailAndAppendsAfterTheLastValidRecord(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := Open(directory, SyncNever())
+	_ = wal.Append(Record{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}})
+	_ = wal.Append(Record{Timestamp: 2, Entries: []Entry{{Key: []byte("SSD"), Value: []byte("Solid state")}}})
+	_ = wal.Close()
+
+	path := filepath.Join(directory, segmentFileNameFor(1))
+	info, _ := os.Stat(path)
+	_ = os.Truncate(path, info.Size()-3)
+
+	wal, err := Open(directory, SyncNever())
+	assert.Nil(t, err)
+	_ = wal.Append(Record{Timestamp: 3, Entries: []Entry{{Key: []byte("NVMe"), Value: []byte("Non volatile memory")}}})
+	_ = wal.Close()
+
+	var timestamps []uint64
+	err = Replay(directory, func(record Record) error {
+		timestamps = append(timestamps, record.Timestamp)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 3}, timestamps)
+}
+
+func TestReplaysAWALWithACorruptRecord(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := Open(directory, SyncNever())
+	_ = wal.Append(Record{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}})
+	_ = wal.Append(Record{Timestamp: 2, Entries: []Entry{{Key: []byte("SSD"), Value: []byte("Solid state")}}})
+	_ = wal.Close()
+
+	path := filepath.Join(directory, segmentFileNameFor(1))
+	contents, _ := os.ReadFile(path)
+	contents[headerSize+1] = contents[headerSize+1] + 1
+	_ = os.WriteFile(path, contents, 0644)
+
+	err := Replay(directory, func(record Record) error { return nil })
+	assert.Error(t, err)
+	assert.Equal(t, CorruptRecordErr, err)
+}
+
+func TestRotatesAndReplaysTheRecordsAcrossTheSegments(t *testing.T) {
+	directory := t.TempDir()
+	wal, err := Open(directory, SyncNever())
+	assert.Nil(t, err)
+
+	_ = wal.Append(Record{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}})
+	assert.Nil(t, wal.Rotate())
+	_ = wal.Append(Record{Timestamp: 2, Entries: []Entry{{Key: []byte("SSD"), Value: []byte("Solid state")}}})
+	assert.Nil(t, wal.Rotate())
+	assert.Equal(t, 3, wal.SegmentCount())
+	assert.Nil(t, wal.Close())
+
+	wal, err = Open(directory, SyncNever())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, wal.SegmentCount())
+	_ = wal.Append(Record{Timestamp: 3, Entries: []Entry{{Key: []byte("NVMe"), Value: []byte("Non volatile memory")}}})
+	assert.Nil(t, wal.Close())
+
+	var timestamps []uint64
+	err = Replay(directory, func(record Record) error {
+		timestamps = append(timestamps, record.Timestamp)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2, 3}, timestamps)
+}
+
+func TestDoesNotRotateAnEmptySegment(t *testing.T) {
+	wal, err := Open(t.TempDir(), SyncNever())
+	assert.Nil(t, err)
+	defer func() {
+		_ = wal.Close()
+	}()
+
+	assert.Nil(t, wal.Rotate())
+	assert.Equal(t, 1, wal.SegmentCount())
+}
+
+func TestRemovesTheSegmentsTillTheTimestamp(t *testing.T) {
+	directory := t.TempDir()
+	wal, err := Open(directory, SyncNever())
+	assert.Nil(t, err)
+
+	_ = wal.AppendAll([]Record{{Timestamp: 1}, {Timestamp: 2}})
+	_ = wal.Rotate()
+	_ = wal.AppendAll([]Record{{Timestamp: 3}, {Timestamp: 4}})
+	_ = wal.Rotate()
+	_ = wal.Append(Record{Timestamp: 5})
+
+	assert.Nil(t, wal.RemoveSegmentsTill(3))
+	assert.Equal(t, 2, wal.SegmentCount())
+
+	assert.Nil(t, wal.RemoveSegmentsTill(10))
+	assert.Equal(t, 1, wal.SegmentCount())
+	assert.Nil(t, wal.Close())
+
+	var timestamps []uint64
+	err = Replay(directory, func(record Record) error {
+		timestamps = append(timestamps, record.Timestamp)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{5}, timestamps)
+}
+
+func TestReplaysAWALWithATornRecordInAClosedSegment(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := Open(directory, SyncNever())
+	_ = wal.Append(Record{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}})
+	_ = wal.Rotate()
+	_ = wal.Append(Record{Timestamp: 2, Entries: []Entry{{Key: []byte("SSD"), Value: []byte("Solid state")}}})
+	_ = wal.Close()
+
+	path := filepath.Join(directory, segmentFileNameFor(1))
+	info, _ := os.Stat(path)
+	_ = os.Truncate(path, info.Size()-3)
+
+	err := Replay(directory, func(record Record) error { return nil })
+	assert.ErrorIs(t, err, CorruptRecordErr)
+
+	_, err = Open(directory, SyncNever())
+	assert.ErrorIs(t, err, CorruptRecordErr)
+}
+
+func TestTruncatesTheRecordsAppendedAfterASize(t *testing.T) {
+	directory := t.TempDir()
+	wal, err := Open(directory, SyncNever())
+	assert.Nil(t, err)
+
+	_ = wal.Append(Record{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}})
+	size := wal.Size()
+	_ = wal.AppendAll([]Record{{Timestamp: 2}, {Timestamp: 3}})
+	assert.Greater(t, wal.Size(), size)
+
+	assert.Nil(t, wal.TruncateTo(size))
+	assert.Equal(t, size, wal.Size())
+	_ = wal.Append(Record{Timestamp: 4, Entries: []Entry{{Key: []byte("SSD"), Value: []byte("Solid state")}}})
+	assert.Nil(t, wal.Close())
+
+	var timestamps []uint64
+	err = Replay(directory, func(record Record) error {
+		timestamps = append(timestamps, record.Timestamp)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 4}, timestamps)
+}
+
+func TestReopensTheWALWithTheSizeOfTheActiveSegment(t *testing.T) {
+	directory := t.TempDir()
+	wal, _ := Open(directory, SyncNever())
+	_ = wal.Append(Record{Timestamp: 1, Entries: []Entry{{Key: []byte("HDD"), Value: []byte("Hard disk")}}})
+	size := wal.Size()
+	_ = wal.Close()
+
+	wal, err := Open(directory, SyncNever())
+	assert.Nil(t, err)
+	assert.Equal(t, size, wal.Size())
+	assert.Nil(t, wal.Rotate())
+	assert.Equal(t, int64(0), wal.Size())
+	assert.Nil(t, wal.Close())
+}